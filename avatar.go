@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+const (
+	avatarOff    = "off"
+	avatarBlocks = "blocks"
+	avatarSixel  = "sixel"
+	avatarKitty  = "kitty"
+)
+
+// avatarMode is how profile pictures are drawn. It comes from the
+// FLIGHTLESS_AVATARS environment variable (auto, kitty, sixel, blocks or off),
+// auto picks the best protocol the terminal advertises.
+var avatarMode = detectAvatarMode(os.Getenv("FLIGHTLESS_AVATARS"))
+
+// avatarsEnabled can be flipped at runtime with the (I)mages key
+var avatarsEnabled = avatarMode != avatarOff
+
+// limits applied before and while decoding untrusted images
+var avatarMaxBytes int64 = 2 << 20
+var avatarMaxSide = 4096
+var avatarThumbSize = 64
+var avatarRetry = 6 * time.Hour
+
+// graphics protocols are sized in cells, assume a common cell aspect
+const avatarCellWidthPx = 10
+const avatarCellHeightPx = 20
+
+// kitty image id, reusing it replaces the previous avatar instead of stacking them
+const avatarKittyID = 4242
+
+var avatarHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+// avatarFetching holds the pubkeys with a download in flight
+var avatarFetching sync.Map
+
+func detectAvatarMode(setting string) string {
+	setting = strings.ToLower(strings.TrimSpace(setting))
+	switch setting {
+	case avatarOff, "0", "false", "no":
+		return avatarOff
+	case avatarBlocks, avatarSixel, avatarKitty:
+		return setting
+	}
+
+	term := os.Getenv("TERM")
+	program := os.Getenv("TERM_PROGRAM")
+	switch {
+	case os.Getenv("KITTY_WINDOW_ID") != "" || term == "xterm-kitty" || term == "xterm-ghostty" ||
+		program == "WezTerm" || program == "ghostty":
+		return avatarKitty
+	case strings.Contains(term, "sixel") || strings.HasPrefix(term, "foot") || strings.HasPrefix(term, "mlterm") ||
+		program == "iTerm.app":
+		return avatarSixel
+	}
+	return avatarBlocks
+}
+
+// toggleAvatars switches profile pictures on and off for this session
+func toggleAvatars(g *gocui.Gui, v *gocui.View) error {
+	if avatarMode == avatarOff {
+		// disabled from the environment, there's no protocol to fall back on
+		avatarMode = avatarBlocks
+	}
+	avatarsEnabled = !avatarsEnabled
+	TheLog.Printf("avatars enabled: %v (%s)", avatarsEnabled, avatarMode)
+	return refreshAllViews(g, v)
+}
+
+// cachedAvatar returns the stored thumbnail for pubkey if it was made from picture
+func cachedAvatar(pubkey string, picture string) image.Image {
+	var a Avatar
+	if err := DB.First(&a, "pubkey_hex = ?", pubkey).Error; err != nil {
+		return nil
+	}
+	if a.Url != picture || len(a.Thumbnail) == 0 {
+		return nil
+	}
+	img, err := png.Decode(bytes.NewReader(a.Thumbnail))
+	if err != nil {
+		return nil
+	}
+	return img
+}
+
+// avatarDue reports if pubkey's picture has never been fetched, changed, or
+// failed long enough ago to try again
+func avatarDue(pubkey string, picture string) bool {
+	if picture == "" {
+		return false
+	}
+	var a Avatar
+	if err := DB.First(&a, "pubkey_hex = ?", pubkey).Error; err != nil {
+		return true
+	}
+	if a.Url != picture {
+		return true
+	}
+	return len(a.Thumbnail) == 0 && time.Since(a.FetchedAt) > avatarRetry
+}
+
+// requestAvatar downloads pubkey's picture in the background when it is due
+// and calls done once a new thumbnail has been stored
+func requestAvatar(pubkey string, picture string, done func()) {
+	if !avatarsEnabled || !avatarDue(pubkey, picture) {
+		return
+	}
+	if _, busy := avatarFetching.LoadOrStore(pubkey, true); busy {
+		return
+	}
+	go func() {
+		defer avatarFetching.Delete(pubkey)
+		if err := fetchAvatar(pubkey, picture); err != nil {
+			return
+		}
+		if done != nil {
+			done()
+		}
+	}()
+}
+
+// fetchAvatar downloads, decodes and shrinks a profile picture, recording
+// failures so broken urls aren't retried on every redraw
+func fetchAvatar(pubkey string, picture string) error {
+	a := Avatar{PubkeyHex: pubkey, Url: picture, FetchedAt: time.Now()}
+	thumb, err := downloadAvatar(picture)
+	if err != nil {
+		TheLog.Printf("avatar for %s not loaded: %v", pubkey, err)
+		a.Error = err.Error()
+	} else {
+		a.Thumbnail = thumb
+	}
+	if dbErr := DB.Save(&a).Error; dbErr != nil {
+		TheLog.Printf("error saving avatar: %v", dbErr)
+	}
+	return err
+}
+
+func downloadAvatar(picture string) (thumb []byte, err error) {
+	u, err := url.Parse(picture)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("unsupported picture url")
+	}
+
+	resp, err := avatarHTTPClient.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if resp.ContentLength > avatarMaxBytes {
+		return nil, fmt.Errorf("picture is %d bytes, limit is %d", resp.ContentLength, avatarMaxBytes)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, avatarMaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > avatarMaxBytes {
+		return nil, fmt.Errorf("picture is larger than %d bytes", avatarMaxBytes)
+	}
+
+	// check the declared dimensions before allocating the full image
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported image: %w", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > avatarMaxSide || cfg.Height > avatarMaxSide {
+		return nil, fmt.Errorf("%s is %dx%d, limit is %dpx per side", format, cfg.Width, cfg.Height, avatarMaxSide)
+	}
+
+	// the decoders are not expected to panic, but the input is untrusted
+	defer func() {
+		if r := recover(); r != nil {
+			thumb, err = nil, fmt.Errorf("decoding %s panicked: %v", format, r)
+		}
+	}()
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, squareThumbnail(img, avatarThumbSize)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// squareThumbnail crops the centre square of img and box-scales it to size x size
+func squareThumbnail(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+
+	out := image.NewRGBA(image.Rect(0, 0, size, size))
+	for ty := 0; ty < size; ty++ {
+		sy0, sy1 := y0+ty*side/size, y0+(ty+1)*side/size
+		if sy1 <= sy0 {
+			sy1 = sy0 + 1
+		}
+		for tx := 0; tx < size; tx++ {
+			sx0, sx1 := x0+tx*side/size, x0+(tx+1)*side/size
+			if sx1 <= sx0 {
+				sx1 = sx0 + 1
+			}
+			var r, g, bl, a, n uint32
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+pr, g+pg, bl+pb, a+pa, n+1
+				}
+			}
+			out.Set(tx, ty, color.RGBA64{uint16(r / n), uint16(g / n), uint16(bl / n), uint16(a / n)})
+		}
+	}
+	return out
+}
+
+// avatarPixel samples img at the centre of cell (x, y) of a w x h grid,
+// blending transparency into the theme background
+func avatarPixel(img image.Image, x, y, w, h int) (uint8, uint8, uint8) {
+	b := img.Bounds()
+	px := b.Min.X + (2*x+1)*b.Dx()/(2*w)
+	py := b.Min.Y + (2*y+1)*b.Dy()/(2*h)
+	c := color.NRGBAModel.Convert(img.At(px, py)).(color.NRGBA)
+	bg := [3]uint8{0x14, 0x14, 0x14}
+	blend := func(v, back uint8) uint8 {
+		return uint8((uint32(v)*uint32(c.A) + uint32(back)*(255-uint32(c.A))) / 255)
+	}
+	return blend(c.R, bg[0]), blend(c.G, bg[1]), blend(c.B, bg[2])
+}
+
+// halfBlockAvatar draws img as cols x rows cells of upper half blocks, each
+// cell carrying two pixels in its fore and background colours
+func halfBlockAvatar(img image.Image, cols, rows int) []string {
+	lines := make([]string, rows)
+	for row := 0; row < rows; row++ {
+		var sb strings.Builder
+		for col := 0; col < cols; col++ {
+			tr, tg, tb := avatarPixel(img, col, row*2, cols, rows*2)
+			br, bg, bb := avatarPixel(img, col, row*2+1, cols, rows*2)
+			fmt.Fprintf(&sb, "\x1b[38;2;%d;%d;%dm\x1b[48;2;%d;%d;%dm▀", tr, tg, tb, br, bg, bb)
+		}
+		sb.WriteString("\x1b[0m")
+		lines[row] = sb.String()
+	}
+	return lines
+}
+
+// kittyAvatar encodes img for the kitty graphics protocol, scaled to cols x rows cells
+func kittyAvatar(img image.Image, cols, rows int) string {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return ""
+	}
+	payload := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	var sb strings.Builder
+	for i := 0; i < len(payload); i += 4096 {
+		end := i + 4096
+		more := 1
+		if end >= len(payload) {
+			end, more = len(payload), 0
+		}
+		if i == 0 {
+			fmt.Fprintf(&sb, "\x1b_Ga=T,f=100,i=%d,c=%d,r=%d,q=2,C=1,m=%d;%s\x1b\\", avatarKittyID, cols, rows, more, payload[i:end])
+		} else {
+			fmt.Fprintf(&sb, "\x1b_Gm=%d;%s\x1b\\", more, payload[i:end])
+		}
+	}
+	return sb.String()
+}
+
+// sixelAvatar encodes img as sixel data on a 6x6x6 colour cube
+func sixelAvatar(img image.Image, cols, rows int) string {
+	w, h := cols*avatarCellWidthPx, rows*avatarCellHeightPx
+	idx := make([]int, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, b := avatarPixel(img, x, y, w, h)
+			idx[y*w+x] = int(r)*6/256*36 + int(g)*6/256*6 + int(b)*6/256
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\x1bP0;1;0q\"1;1;%d;%d", w, h)
+	for i := 0; i < 216; i++ {
+		fmt.Fprintf(&sb, "#%d;2;%d;%d;%d", i, i/36*100/5, i/6%6*100/5, i%6*100/5)
+	}
+	for band := 0; band < h; band += 6 {
+		used := make(map[int]bool)
+		for y := band; y < band+6 && y < h; y++ {
+			for x := 0; x < w; x++ {
+				used[idx[y*w+x]] = true
+			}
+		}
+		first := true
+		for c := 0; c < 216; c++ {
+			if !used[c] {
+				continue
+			}
+			if !first {
+				sb.WriteByte('$')
+			}
+			first = false
+			fmt.Fprintf(&sb, "#%d", c)
+			// run-length encode the sixel columns for this colour
+			prev, run := byte(0), 0
+			flush := func() {
+				switch {
+				case run > 3:
+					fmt.Fprintf(&sb, "!%d%c", run, prev)
+				case run > 0:
+					sb.WriteString(strings.Repeat(string(prev), run))
+				}
+			}
+			for x := 0; x < w; x++ {
+				bits := 0
+				for dy := 0; dy < 6 && band+dy < h; dy++ {
+					if idx[(band+dy)*w+x] == c {
+						bits |= 1 << dy
+					}
+				}
+				ch := byte(63 + bits)
+				if ch == prev {
+					run++
+					continue
+				}
+				flush()
+				prev, run = ch, 1
+			}
+			flush()
+		}
+		sb.WriteByte('-')
+	}
+	sb.WriteString("\x1b\\")
+	return sb.String()
+}
+
+// avatarLines returns the lines to print where an avatar goes. With half
+// blocks that's the picture itself, with a graphics protocol it's blank room
+// for drawAvatarGraphics to paint over once the frame is on screen.
+func avatarLines(img image.Image, cols, rows int) []string {
+	if avatarMode == avatarSixel || avatarMode == avatarKitty {
+		return make([]string, rows)
+	}
+	return halfBlockAvatar(img, cols, rows)
+}
+
+// drawAvatarGraphics paints img with sixel or kitty graphics at the top left of
+// view. gocui has no hook after a flush, so it waits for the frame to be drawn
+// and writes straight to the terminal.
+func drawAvatarGraphics(g *gocui.Gui, viewName string, img image.Image, cols, rows int) {
+	if avatarMode != avatarSixel && avatarMode != avatarKitty {
+		return
+	}
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		g.Update(func(g *gocui.Gui) error {
+			v, err := g.View(viewName)
+			if err != nil {
+				return nil
+			}
+			// the reserved lines have scrolled away
+			if _, oy := v.Origin(); oy != 0 {
+				return nil
+			}
+			x0, y0, _, _ := v.Dimensions()
+			data := kittyAvatar(img, cols, rows)
+			if avatarMode == avatarSixel {
+				data = sixelAvatar(img, cols, rows)
+			}
+			go writeToTerminal(fmt.Sprintf("\x1b7\x1b[%d;%dH%s\x1b8", y0+2, x0+2, data))
+			return nil
+		})
+	}()
+}
+
+// clearAvatarGraphics removes a kitty avatar, text redraws cover sixel ones
+func clearAvatarGraphics() {
+	if avatarMode == avatarKitty {
+		writeToTerminal(fmt.Sprintf("\x1b_Ga=d,d=I,i=%d,q=2\x1b\\", avatarKittyID))
+	}
+}
+
+func writeToTerminal(data string) {
+	// give the pending flush a moment so it doesn't interleave with us
+	time.Sleep(50 * time.Millisecond)
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			TheLog.Printf("error opening terminal for avatar: %v", err)
+		}
+		return
+	}
+	defer tty.Close()
+	if _, err := io.WriteString(tty, data); err != nil {
+		TheLog.Printf("error writing avatar: %v", err)
+	}
+}
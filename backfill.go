@@ -0,0 +1,129 @@
+package main
+
+import (
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// backfillPageDelay is the pause between pages, to go easy on the relay
+var backfillPageDelay = 2 * time.Second
+
+// backfillPageTimeout bounds one page of the backfill
+var backfillPageTimeout = 30 * time.Second
+
+// giftWrapBackfill loads the stored progress of pubkey's backfill on url
+func giftWrapBackfill(url string, pubkey string) GiftWrapBackfill {
+	var bf GiftWrapBackfill
+	if err := DB.Where("url = ? AND pubkey_hex = ?", normalizeRelayURL(url), pubkey).First(&bf).Error; err != nil {
+		return GiftWrapBackfill{Url: normalizeRelayURL(url), PubkeyHex: pubkey, Until: int64(nostr.Now())}
+	}
+	return bf
+}
+
+// finishGiftWrapBackfill marks the backfill of url as complete
+func finishGiftWrapBackfill(url string, pubkey string) {
+	bf := giftWrapBackfill(url, pubkey)
+	bf.Done = true
+	bf.LastError = ""
+	if err := DB.Save(&bf).Error; err != nil {
+		TheLog.Printf("error saving backfill progress for %s: %v", url, err)
+	}
+	refreshV4Retries()
+}
+
+// backfillGiftWraps pages backwards through the gift wraps for pubkey on a
+// DM relay, one until window at a time, until the relay has nothing older.
+// Progress is saved after every page and a later run resumes from it.
+func backfillGiftWraps(url string, pubkey string) {
+	done, ok := startSync(url, "backfill")
+	if !ok {
+		return
+	}
+	defer done()
+
+	bf := giftWrapBackfill(url, pubkey)
+	if bf.Done {
+		return
+	}
+
+	// the page size has to fit the relay's max_limit, so know it before the first page
+	getRelayInfo(url)
+	limit := syncLimit(url)
+	TheLog.Printf("backfill: gift wraps from %s, resuming at %s", url, time.Unix(bf.Until, 0).Format("2006-01-02"))
+
+	// ids at the oldest second of the last page, which the next page repeats
+	boundary := make(map[string]bool)
+	for {
+		until := nostr.Timestamp(bf.Until)
+		oldest := until
+		fresh := 0
+		var page []*nostr.Event
+		filter := nostr.Filter{
+			Kinds: []int{1059},
+			Tags:  nostr.TagMap{"p": []string{pubkey}},
+			Until: &until,
+			Limit: limit,
+		}
+		n, err := fetchUntilEOSEEach(url, nostr.Filters{filter}, backfillPageTimeout, func(ev *nostr.Event) {
+			if ev.CreatedAt < oldest {
+				oldest = ev.CreatedAt
+			}
+			if !boundary[ev.ID] {
+				fresh++
+			}
+			page = append(page, ev)
+		})
+		if err != nil {
+			TheLog.Printf("backfill: %s: %v", url, err)
+			bf.LastError = err.Error()
+			DB.Save(&bf)
+			refreshV4Retries()
+			return
+		}
+
+		bf.Pages++
+		bf.Fetched += fresh
+		bf.LastError = ""
+		switch {
+		case n == 0:
+			bf.Done = true
+		case oldest < until:
+			bf.Until = int64(oldest)
+		default:
+			// a whole page in one second, step past it
+			bf.Until = int64(until) - 1
+		}
+		if err := DB.Save(&bf).Error; err != nil {
+			TheLog.Printf("error saving backfill progress for %s: %v", url, err)
+		}
+		refreshV4Retries()
+
+		boundary = make(map[string]bool)
+		for _, ev := range page {
+			if int64(ev.CreatedAt) == bf.Until {
+				boundary[ev.ID] = true
+			}
+		}
+
+		if bf.Done {
+			TheLog.Printf("backfill: %d gift wraps from %s, reached the start of history", bf.Fetched, url)
+			refreshNow()
+			return
+		}
+		time.Sleep(backfillPageDelay)
+	}
+}
+
+// backfillProgress is the short form of a backfill shown in v4
+func backfillProgress(bf GiftWrapBackfill) string {
+	switch {
+	case bf.Done:
+		return "history:complete"
+	case bf.LastError != "":
+		return "history:error"
+	case bf.Pages == 0:
+		return "history:pending"
+	}
+	return "history:" + time.Unix(bf.Until, 0).Format("2006-01-02")
+}
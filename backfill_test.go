@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestBackfillOnlyCompletesAfterEOSE(t *testing.T) {
+	backfillPageDelay, backfillPageTimeout = 0, 500*time.Millisecond
+	relay := newFakeRelay(t)
+	url := normalizeRelayURL(relay.URL)
+	pubkey, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	t.Cleanup(func() { DB.Where("url = ?", url).Delete(&GiftWrapBackfill{}) })
+
+	relay.Refuse("auth-required: gift wraps are only for their recipient")
+	backfillGiftWraps(url, pubkey)
+	if bf := giftWrapBackfill(url, pubkey); bf.Done || bf.LastError == "" {
+		t.Fatalf("after CLOSED: done %v, error %q", bf.Done, bf.LastError)
+	}
+
+	relay.Refuse("")
+	relay.Stall(true)
+	backfillGiftWraps(url, pubkey)
+	if bf := giftWrapBackfill(url, pubkey); bf.Done || bf.LastError == "" {
+		t.Fatalf("after a timeout: done %v, error %q", bf.Done, bf.LastError)
+	}
+
+	relay.Stall(false)
+	backfillGiftWraps(url, pubkey)
+	if bf := giftWrapBackfill(url, pubkey); !bf.Done || bf.LastError != "" {
+		t.Fatalf("after EOSE: done %v, error %q", bf.Done, bf.LastError)
+	}
+}
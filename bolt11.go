@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+)
+
+// bolt11Invoice holds the BOLT11 fields the zap flow cares about
+type bolt11Invoice struct {
+	Network         string // bc, tb, bcrt, ...
+	AmountMsat      int64  // 0 when the invoice leaves the amount open
+	Timestamp       time.Time
+	Expiry          time.Duration
+	PaymentHash     string
+	DescriptionHash string
+	Description     string
+	Payee           string // only set when the invoice carries an n field
+}
+
+// bolt11 tagged field types, as bech32 values
+const (
+	bolt11FieldPaymentHash     = 1  // p
+	bolt11FieldDescription     = 13 // d
+	bolt11FieldDescriptionHash = 23 // h
+	bolt11FieldExpiry          = 6  // x
+	bolt11FieldPayee           = 19 // n
+)
+
+// bolt11SignatureLen is the 65 byte recoverable signature in 5 bit groups
+const bolt11SignatureLen = 104
+
+func (inv bolt11Invoice) ExpiresAt() time.Time {
+	return inv.Timestamp.Add(inv.Expiry)
+}
+
+// decodeBolt11 parses an invoice without checking its signature
+func decodeBolt11(pr string) (bolt11Invoice, error) {
+	var inv bolt11Invoice
+	pr = strings.ToLower(strings.TrimSpace(pr))
+	pr = strings.TrimPrefix(pr, "lightning:")
+
+	hrp, data, err := bech32.DecodeNoLimit(pr)
+	if err != nil {
+		return inv, fmt.Errorf("invoice is not valid bech32: %w", err)
+	}
+	if !strings.HasPrefix(hrp, "ln") {
+		return inv, fmt.Errorf("not a lightning invoice")
+	}
+	hrp = hrp[2:]
+	split := strings.IndexAny(hrp, "0123456789")
+	if split < 0 {
+		inv.Network = hrp
+	} else {
+		inv.Network = hrp[:split]
+		if inv.AmountMsat, err = bolt11Amount(hrp[split:]); err != nil {
+			return inv, err
+		}
+	}
+
+	if len(data) < 7+bolt11SignatureLen {
+		return inv, fmt.Errorf("invoice is too short")
+	}
+	inv.Timestamp = time.Unix(int64(bolt11Int(data[:7])), 0)
+	inv.Expiry = time.Hour // BOLT11 default when there is no x field
+
+	fields := data[7 : len(data)-bolt11SignatureLen]
+	for len(fields) >= 3 {
+		typ := fields[0]
+		length := int(fields[1])<<5 | int(fields[2])
+		if len(fields) < 3+length {
+			return inv, fmt.Errorf("invoice field %d is truncated", typ)
+		}
+		value := fields[3 : 3+length]
+		fields = fields[3+length:]
+
+		switch typ {
+		case bolt11FieldPaymentHash:
+			if length == 52 {
+				inv.PaymentHash, _ = bolt11Hex(value)
+			}
+		case bolt11FieldDescriptionHash:
+			if length == 52 {
+				inv.DescriptionHash, _ = bolt11Hex(value)
+			}
+		case bolt11FieldPayee:
+			if length == 53 {
+				inv.Payee, _ = bolt11Hex(value)
+			}
+		case bolt11FieldDescription:
+			b, err := bech32.ConvertBits(value, 5, 8, false)
+			if err == nil {
+				inv.Description = string(b)
+			}
+		case bolt11FieldExpiry:
+			inv.Expiry = time.Duration(bolt11Int(value)) * time.Second
+		}
+	}
+	if inv.PaymentHash == "" {
+		return inv, fmt.Errorf("invoice has no payment hash")
+	}
+	return inv, nil
+}
+
+// bolt11Amount converts the hrp amount (e.g. 2500u) to millisats
+func bolt11Amount(s string) (int64, error) {
+	multiplier := int64(100_000_000_000) // msat per bitcoin
+	divisor := int64(1)
+	switch s[len(s)-1] {
+	case 'm':
+		multiplier = 100_000_000
+	case 'u':
+		multiplier = 100_000
+	case 'n':
+		multiplier = 100
+	case 'p':
+		multiplier, divisor = 1, 10
+	}
+	if multiplier != 100_000_000_000 || divisor != 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid invoice amount %q", s)
+	}
+	if divisor > 1 && n%divisor != 0 {
+		return 0, fmt.Errorf("invoice amount has sub-millisat precision")
+	}
+	if n > (1<<62)/multiplier {
+		return 0, fmt.Errorf("invoice amount is too large")
+	}
+	return n * multiplier / divisor, nil
+}
+
+func bolt11Int(groups []byte) uint64 {
+	var n uint64
+	for _, g := range groups {
+		n = n<<5 | uint64(g)
+	}
+	return n
+}
+
+func bolt11Hex(groups []byte) (string, error) {
+	b, err := bech32.ConvertBits(groups, 5, 8, false)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// BOLT11 test vectors, all made at 1496314658 with the same payment hash
+const bolt11SpecPaymentHash = "0001020304050607080900010203040506070809000102030405060708090102"
+
+func TestDecodeBolt11SpecVectors(t *testing.T) {
+	tests := []struct {
+		name            string
+		invoice         string
+		network         string
+		amountMsat      int64
+		expiry          time.Duration
+		description     string
+		descriptionHash string
+	}{
+		{
+			name:        "donation of any amount",
+			invoice:     "lnbc1pvjluezsp5zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zygspp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqdpl2pkx2ctnv5sxxmmwwd5kgetjypeh2ursdae8g6twvus8g6rfwvs8qun0dfjkxaq9qrsgq357wnc5r2ueh7ck6q93dj32dlqnls087fxdwk8qakdyafkq3yap9us6v52vjjsrvywa6rt52cm9r9zqt8r2t7mlcwspyetp5h2tztugp9lfyql",
+			network:     "bc",
+			expiry:      time.Hour,
+			description: "Please consider supporting this project",
+		},
+		{
+			name:        "$3 for a cup of coffee within one minute",
+			invoice:     "lnbc2500u1pvjluezsp5zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zygspp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqdq5xysxxatsyp3k7enxv4jsxqzpu9qrsgquk0rl77nj30yxdy8j9vdx85fkpmdla2087ne0xh8nhedh8w27kyke0lp53ut353s06fv3qfegext0eh0ymjpf39tuven09sam30g4vgpfna3rh",
+			network:     "bc",
+			amountMsat:  250_000_000,
+			expiry:      time.Minute,
+			description: "1 cup coffee",
+		},
+		{
+			name:        "utf-8 description",
+			invoice:     "lnbc2500u1pvjluezsp5zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zygspp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqdpquwpc4curk03c9wlrswe78q4eyqc7d8d0xqzpu9qrsgqhtjpauu9ur7fw2thcl4y9vfvh4m9wlfyz2gem29g5ghe2aak2pm3ps8fdhtceqsaagty2vph7utlgj48u0ged6a337aewvraedendscp573dxr",
+			network:     "bc",
+			amountMsat:  250_000_000,
+			expiry:      time.Minute,
+			description: "ナンセンス 1杯",
+		},
+		{
+			name:            "hashed description",
+			invoice:         "lnbc20m1pvjluezsp5zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zygspp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqhp58yjmdan79s6qqdhdzgynm4zwqd5d7xmw5fk98klysy043l2ahrqs9qrsgq7ea976txfraylvgzuxs8kgcw23ezlrszfnh8r6qtfpr6cxga50aj6txm9rxrydzd06dfeawfk6swupvz4erwnyutnjq7x39ymw6j38gp7ynn44",
+			network:         "bc",
+			amountMsat:      2_000_000_000,
+			expiry:          time.Hour,
+			descriptionHash: "3925b6f67e2c340036ed12093dd44e0368df1b6ea26c53dbe4811f58fd5db8c1",
+		},
+		{
+			name:            "testnet with a fallback address",
+			invoice:         "lntb20m1pvjluezsp5zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zygshp58yjmdan79s6qqdhdzgynm4zwqd5d7xmw5fk98klysy043l2ahrqspp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqfpp3x9et2e20v6pu37c5d9vax37wxq72un989qrsgqdj545axuxtnfemtpwkc45hx9d2ft7x04mt8q7y6t0k2dge9e7h8kpy9p34ytyslj3yu569aalz2xdk8xkd7ltxqld94u8h2esmsmacgpghe9k8",
+			network:         "tb",
+			amountMsat:      2_000_000_000,
+			expiry:          time.Hour,
+			descriptionHash: "3925b6f67e2c340036ed12093dd44e0368df1b6ea26c53dbe4811f58fd5db8c1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv, err := decodeBolt11(tt.invoice)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if inv.Network != tt.network {
+				t.Errorf("network = %q, want %q", inv.Network, tt.network)
+			}
+			if inv.AmountMsat != tt.amountMsat {
+				t.Errorf("amount = %d msat, want %d", inv.AmountMsat, tt.amountMsat)
+			}
+			if inv.Timestamp.Unix() != 1496314658 {
+				t.Errorf("timestamp = %d, want 1496314658", inv.Timestamp.Unix())
+			}
+			if inv.Expiry != tt.expiry {
+				t.Errorf("expiry = %v, want %v", inv.Expiry, tt.expiry)
+			}
+			if inv.PaymentHash != bolt11SpecPaymentHash {
+				t.Errorf("payment hash = %s", inv.PaymentHash)
+			}
+			if inv.Description != tt.description {
+				t.Errorf("description = %q, want %q", inv.Description, tt.description)
+			}
+			if inv.DescriptionHash != tt.descriptionHash {
+				t.Errorf("description hash = %q, want %q", inv.DescriptionHash, tt.descriptionHash)
+			}
+		})
+	}
+}
+
+func TestDecodeBolt11Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		invoice string
+		want    string
+	}{
+		{
+			name:    "invalid checksum",
+			invoice: "lnbc2500u1vjluezsp5zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zygspp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqdpquwpc4curk03c9wlrswe78q4eyqc7d8d0xqzpu9qrsgqhtjpauu9ur7fw2thcl4y9vfvh4m9wlfyz2gem29g5ghe2aak2pm3ps8fdhtceqsaagty2vph7utlgj48u0ged6a337aewvraedendscp573dxr",
+			want:    "not valid bech32",
+		},
+		{
+			name:    "no separator",
+			invoice: "pvjluezpp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqdpl2pkx2ctnv5sxxmmwwd5kgetjypeh2ursdae8g6twvus8g6rfwvs8qun0dfjkxaq9qrsgq357wnc5r2ueh7ck6q93dj32dlqnls087fxdwk8qakdyafkq3yap9us6v52vjjsrvywa6rt52cm9r9zqt8r2t7mlcwspyetp5h2tztugp9lfyql",
+			want:    "not valid bech32",
+		},
+		{
+			name:    "not a lightning hrp",
+			invoice: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+			want:    "not a lightning invoice",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeBolt11(tt.invoice)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBolt11Amount(t *testing.T) {
+	tests := []struct {
+		amount string
+		msat   int64
+		err    bool
+	}{
+		{amount: "1", msat: 100_000_000_000},
+		{amount: "20m", msat: 2_000_000_000},
+		{amount: "2500u", msat: 250_000_000},
+		{amount: "10n", msat: 1_000},
+		{amount: "9678785340p", msat: 967_878_534},
+		{amount: "10p", msat: 1},
+		// BOLT11: amounts below a millisatoshi are invalid
+		{amount: "2500000001p", err: true},
+		{amount: "1p", err: true},
+		{amount: "2500x", err: true},
+		{amount: "0u", err: true},
+		{amount: "-1m", err: true},
+	}
+	for _, tt := range tests {
+		msat, err := bolt11Amount(tt.amount)
+		if tt.err {
+			if err == nil {
+				t.Errorf("bolt11Amount(%q) = %d, want an error", tt.amount, msat)
+			}
+			continue
+		}
+		if err != nil || msat != tt.msat {
+			t.Errorf("bolt11Amount(%q) = %d, %v, want %d", tt.amount, msat, err, tt.msat)
+		}
+	}
+}
+
+func TestBolt11ExpiresAt(t *testing.T) {
+	inv, err := decodeBolt11("LNBC2500U1PVJLUEZSP5ZYG3ZYG3ZYG3ZYG3ZYG3ZYG3ZYG3ZYG3ZYG3ZYG3ZYG3ZYG3ZYGSPP5QQQSYQCYQ5RQWZQFQQQSYQCYQ5RQWZQFQQQSYQCYQ5RQWZQFQYPQDQ5XYSXXATSYP3K7ENXV4JSXQZPU9QRSGQUK0RL77NJ30YXDY8J9VDX85FKPMDLA2087NE0XH8NHEDH8W27KYKE0LP53UT353S06FV3QFEGEXT0EH0YMJPF39TUVEN09SAM30G4VGPFNA3RH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Unix(1496314658+60, 0); !inv.ExpiresAt().Equal(want) {
+		t.Errorf("expires at %v, want %v", inv.ExpiresAt(), want)
+	}
+}
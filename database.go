@@ -11,12 +11,15 @@ import (
 )
 
 type Account struct {
-	ID           int64  `gorm:"primaryKey;autoIncrement"`
-	Pubkey       string `gorm:"size:65"`
-	PubkeyNpub   string `gorm:"size:65"`
-	Privatekey   string `gorm:"size:1024"` // encrypted
-	Active       bool
-	ChatMessages []ChatMessage `gorm:"foreignKey:AccountID;references:ID"`
+	ID            int64  `gorm:"primaryKey;autoIncrement"`
+	Pubkey        string `gorm:"size:65"`
+	PubkeyNpub    string `gorm:"size:65"`
+	Privatekey    string `gorm:"size:1024"` // encrypted
+	NwcConnection string `gorm:"size:2048"` // encrypted nostr+walletconnect:// string
+	ZapPresets    string `gorm:"size:256"`  // comma separated sats, empty for the defaults
+	ZapComment    string `gorm:"size:1024"` // prefilled in the zap comment input
+	Active        bool
+	ChatMessages  []ChatMessage `gorm:"foreignKey:AccountID;references:ID"`
 }
 
 type Login struct {
@@ -58,6 +61,18 @@ type RelayStatus struct {
 	// change these defaults to something closer to zero
 	LastEOSE  time.Time `gorm:"default:CURRENT_TIMESTAMP"`
 	LastDisco time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+	// reconnect attempts since the connection was lost, and when the next one is due
+	RetryCount int
+	NextRetry  time.Time
+	// SOCKS5 proxy for this relay instead of FLIGHTLESS_PROXY, "direct" to bypass it
+	Proxy string `gorm:"size:512"`
+	// comma separated roles (see relayRoles), empty for the defaults
+	Roles string `gorm:"size:128"`
+	// AUTH policy: empty for automatic, "always" or "never"
+	AuthMode string `gorm:"size:16"`
+	// most subscriptions opened on the relay at once, 0 for no limit
+	MaxSubscriptions int  `gorm:"default:0"`
+	Disabled         bool `gorm:"default:false"`
 }
 
 type ChatMessage struct {
@@ -72,15 +87,173 @@ type ChatMessage struct {
 }
 
 type RelayList struct {
+	ID        int64  `gorm:"primaryKey;autoIncrement"`
+	PubkeyHex string `gorm:"size:65;index"`
+	Url       string `gorm:"size:512"`
+	Read      bool   `gorm:"default:true"`
+	Write     bool   `gorm:"default:true"`
+	// created_at of the kind 10002 the row came from, older lists are ignored
+	EventCreatedAt time.Time
+	UpdatedAt      time.Time `gorm:"autoUpdateTime"`
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+}
+
+// ConversationState records what the account decided about a sender that
+// showed up in the message requests inbox
+type ConversationState struct {
 	ID        int64     `gorm:"primaryKey;autoIncrement"`
+	AccountID int64     `gorm:"index"`
 	PubkeyHex string    `gorm:"size:65;index"`
-	Url       string    `gorm:"size:512"`
-	Read      bool      `gorm:"default:true"`
-	Write     bool      `gorm:"default:true"`
+	State     string    `gorm:"size:32"` // accepted, muted or deleted
+	ClearedAt time.Time // messages at or before this were deleted by the user
 	UpdatedAt time.Time `gorm:"autoUpdateTime"`
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 }
 
+// WotScore is the web-of-trust standing of a pubkey as seen from an account,
+// rebuilt periodically from metadata_follows
+type WotScore struct {
+	AccountPubkey    string `gorm:"primaryKey;size:65"`
+	PubkeyHex        string `gorm:"primaryKey;size:65"`
+	Hops             int
+	TrustedFollowers int
+	Score            int       `gorm:"index"`
+	UpdatedAt        time.Time `gorm:"autoUpdateTime"`
+}
+
+// FollowSet is a NIP-51 kind 30000 follow set, used as a contact group
+type FollowSet struct {
+	ID             int64  `gorm:"primaryKey;autoIncrement"`
+	PubkeyHex      string `gorm:"size:65;index"`
+	Identifier     string `gorm:"size:512"` // d tag
+	Title          string `gorm:"size:512"`
+	Content        string `gorm:"size:65535"` // kept as-is, may hold encrypted private items
+	ExtraTags      string `gorm:"size:65535"` // json of tags we don't interpret, republished untouched
+	EventCreatedAt time.Time
+	// Deleted keeps a deleted set as a tombstone, so relays redelivering the
+	// old event don't bring it back
+	Deleted   bool              `gorm:"default:false"`
+	Members   []FollowSetMember `gorm:"foreignKey:FollowSetID;references:ID"`
+	UpdatedAt time.Time         `gorm:"autoUpdateTime"`
+}
+
+type FollowSetMember struct {
+	ID          int64  `gorm:"primaryKey;autoIncrement"`
+	FollowSetID int64  `gorm:"index"`
+	PubkeyHex   string `gorm:"size:65"`
+	Tag         string `gorm:"size:65535"` // json of the p tag as received, with relay hint and petname
+}
+
+// Nip05Check caches the outcome of verifying a pubkey's NIP-05 identifier
+type Nip05Check struct {
+	PubkeyHex   string `gorm:"primaryKey;size:65"`
+	Identifier  string `gorm:"size:512"` // the nip05 value that was checked
+	Status      string `gorm:"size:32"`  // verified, failed or unchecked
+	Error       string `gorm:"size:1024"`
+	Attempts    int    `gorm:"default:0"` // network or HTTP failures in a row, for backoff
+	LastChecked time.Time
+	ExpiresAt   time.Time `gorm:"index"`
+}
+
+// Avatar caches a downscaled copy of a profile picture so it can be drawn
+// without hitting the network again
+type Avatar struct {
+	PubkeyHex string `gorm:"primaryKey;size:65"`
+	Url       string `gorm:"size:65535"` // the picture url the thumbnail was made from
+	Thumbnail []byte // png, avatarThumbSize pixels square, empty on error
+	Error     string `gorm:"size:1024"`
+	FetchedAt time.Time
+}
+
+// CachedEvent keeps events referenced from messages (nostr:note, nevent and
+// naddr links) so they can be previewed without refetching
+type CachedEvent struct {
+	ID         string `gorm:"primaryKey;size:65"`
+	PubkeyHex  string `gorm:"size:65;index"`
+	Kind       int
+	Identifier string `gorm:"size:512"` // d tag, for addressable events
+	Content    string `gorm:"size:65535"`
+	Raw        string `gorm:"size:512000"`
+	CreatedAt  time.Time
+	FetchedAt  time.Time
+}
+
+// Zap is a kind 9735 zap receipt, checked against NIP-57 before it counts
+type Zap struct {
+	ID              string `gorm:"primaryKey;size:65"` // receipt event id, or the request id while pending
+	RequestID       string `gorm:"size:65;index"`      // the kind 9734 inside the receipt
+	SenderPubkey    string `gorm:"size:65;index"`
+	RecipientPubkey string `gorm:"size:65;index"`
+	EventID         string `gorm:"size:65;index"`
+	Address         string `gorm:"size:1024"`
+	ProviderPubkey  string `gorm:"size:65"` // pubkey that signed the receipt
+	AmountMsat      int64
+	Comment         string `gorm:"size:4096"`
+	Bolt11          string `gorm:"size:4096"`
+	Verified        bool
+	Pending         bool   // we sent the request and no receipt has arrived yet
+	Error           string `gorm:"size:1024"`
+	Unchecked       bool   `gorm:"default:false;index"` // all good but the signer, zapVerifier checks it later
+	Attempts        int    `gorm:"default:0"`           // failed signer checks, for backoff
+	RetryAt         time.Time
+	PaidAt          time.Time
+	CreatedAt       time.Time `gorm:"autoCreateTime"`
+}
+
+// RelayInfoCache is a relay's NIP-11 information document, refetched after relayInfoTTL
+type RelayInfoCache struct {
+	Url       string `gorm:"primaryKey;size:512"`
+	Document  string `gorm:"size:65535"` // raw json of the last good fetch
+	Error     string `gorm:"size:1024"`  // why the last fetch failed, empty when it worked
+	FetchedAt time.Time
+}
+
+// RelayHealthDay is one day of a relay's health counters, the rolling history
+// behind the relay dashboard
+type RelayHealthDay struct {
+	Url           string `gorm:"primaryKey;size:512"`
+	Day           string `gorm:"primaryKey;size:10"` // 2006-01-02, local time
+	Connects      int
+	ConnectFails  int
+	Disconnects   int
+	ConnectMillis int64 // summed over Connects
+	EOSEs         int
+	EOSEMillis    int64 // summed over EOSEs
+	Events        int
+	PublishOK     int
+	PublishFail   int
+	Closed        int
+	Notices       int
+	AuthOK        int
+	AuthFail      int
+	Errors        int
+	LastError     string `gorm:"size:512"`
+}
+
+// SyncedEvent is an event we already have, kept by id and created_at so a
+// NIP-77 sync with a relay only fetches what is missing
+type SyncedEvent struct {
+	EventId string `gorm:"primaryKey;size:65"`
+	Kind    int    `gorm:"index:idx_synced_kind_owner"`
+	// the author, or the recipient of a gift wrap
+	Owner          string `gorm:"size:65;index:idx_synced_kind_owner"`
+	EventCreatedAt int64
+}
+
+// GiftWrapBackfill is how far back the gift wraps of an account have been
+// loaded from one DM relay
+type GiftWrapBackfill struct {
+	Url       string `gorm:"primaryKey;size:512"`
+	PubkeyHex string `gorm:"primaryKey;size:65"`
+	// created_at of the oldest gift wrap reached, the next page ends there
+	Until     int64
+	Fetched   int
+	Pages     int
+	Done      bool
+	LastError string    `gorm:"size:512"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
 func GetGormConnection() *gorm.DB {
 	file, err := os.OpenFile("flightless.log", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
 	if err != nil {
@@ -136,4 +309,40 @@ func RunMigrations() {
 	if err := DB.AutoMigrate(&RelayList{}); err != nil {
 		log.Fatalf("Failed to migrate RelayList table: %v", err)
 	}
+	if err := DB.AutoMigrate(&ConversationState{}); err != nil {
+		log.Fatalf("Failed to migrate ConversationState table: %v", err)
+	}
+	if err := DB.AutoMigrate(&WotScore{}); err != nil {
+		log.Fatalf("Failed to migrate WotScore table: %v", err)
+	}
+	if err := DB.AutoMigrate(&FollowSet{}); err != nil {
+		log.Fatalf("Failed to migrate FollowSet table: %v", err)
+	}
+	if err := DB.AutoMigrate(&FollowSetMember{}); err != nil {
+		log.Fatalf("Failed to migrate FollowSetMember table: %v", err)
+	}
+	if err := DB.AutoMigrate(&Nip05Check{}); err != nil {
+		log.Fatalf("Failed to migrate Nip05Check table: %v", err)
+	}
+	if err := DB.AutoMigrate(&Avatar{}); err != nil {
+		log.Fatalf("Failed to migrate Avatar table: %v", err)
+	}
+	if err := DB.AutoMigrate(&CachedEvent{}); err != nil {
+		log.Fatalf("Failed to migrate CachedEvent table: %v", err)
+	}
+	if err := DB.AutoMigrate(&Zap{}); err != nil {
+		log.Fatalf("Failed to migrate Zap table: %v", err)
+	}
+	if err := DB.AutoMigrate(&RelayHealthDay{}); err != nil {
+		log.Fatalf("Failed to migrate RelayHealthDay table: %v", err)
+	}
+	if err := DB.AutoMigrate(&RelayInfoCache{}); err != nil {
+		log.Fatalf("Failed to migrate RelayInfoCache table: %v", err)
+	}
+	if err := DB.AutoMigrate(&SyncedEvent{}); err != nil {
+		log.Fatalf("Failed to migrate SyncedEvent table: %v", err)
+	}
+	if err := DB.AutoMigrate(&GiftWrapBackfill{}); err != nil {
+		log.Fatalf("Failed to migrate GiftWrapBackfill table: %v", err)
+	}
 }
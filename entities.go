@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// stripNostrURI removes a NIP-21 nostr: prefix, if any
+func stripNostrURI(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > 6 && strings.EqualFold(s[:6], "nostr:") {
+		return s[6:]
+	}
+	return s
+}
+
+// looksLikeNip05 tells identifiers (name@domain or a bare domain) apart from
+// hex and bech32, neither of which can contain '@' or '.'
+func looksLikeNip05(s string) bool {
+	return strings.ContainsAny(s, "@.")
+}
+
+// resolvePubkeyInput turns what people paste into a pubkey lookup into a hex
+// pubkey and any relay hints that came with it. It accepts hex, npub,
+// nprofile, nostr: URIs of those, and NIP-05 identifiers, which are resolved
+// over HTTP so this can block.
+func resolvePubkeyInput(input string) (string, []string, error) {
+	s := stripNostrURI(input)
+	if s == "" {
+		return "", nil, fmt.Errorf("nothing entered")
+	}
+
+	if len(s) == 64 && isHex(s) {
+		return strings.ToLower(s), nil, nil
+	}
+
+	if looksLikeNip05(s) {
+		pubkey, relays, err := fetchNip05(s)
+		if err != nil {
+			return "", nil, fmt.Errorf("could not resolve %s: %w", s, err)
+		}
+		return pubkey, relayHints(relays), nil
+	}
+
+	prefix, value, err := nip19.Decode(strings.ToLower(s))
+	if err != nil {
+		return "", nil, fmt.Errorf("unrecognized input, expected a hex pubkey, npub, nprofile, nostr: URI or name@domain")
+	}
+	switch prefix {
+	case "npub":
+		return value.(string), nil, nil
+	case "nprofile":
+		pointer := value.(nostr.ProfilePointer)
+		return pointer.PublicKey, relayHints(pointer.Relays), nil
+	case "nsec":
+		return "", nil, fmt.Errorf("that is a private key (nsec), enter a public key instead")
+	case "note", "nevent", "naddr":
+		return "", nil, fmt.Errorf("%s points to an event, not a profile", prefix)
+	}
+	return "", nil, fmt.Errorf("unsupported %s entity", prefix)
+}
+
+// resolvePrivateKeyInput accepts an nsec, a nostr:nsec URI or hex
+func resolvePrivateKeyInput(input string) (string, error) {
+	s := stripNostrURI(input)
+	if s == "" {
+		return "", fmt.Errorf("no private key entered")
+	}
+	if len(s) == 64 && isHex(s) {
+		return strings.ToLower(s), nil
+	}
+
+	prefix, value, err := nip19.Decode(strings.ToLower(s))
+	if err != nil {
+		return "", fmt.Errorf("unrecognized private key, expected an nsec or 64 hex characters")
+	}
+	if prefix != "nsec" {
+		return "", fmt.Errorf("%s is not a private key, enter an nsec or hex", prefix)
+	}
+	return value.(string), nil
+}
+
+// relayHints keeps the hints that are usable websocket urls
+func relayHints(urls []string) []string {
+	var hints []string
+	for _, u := range urls {
+		lower := strings.ToLower(strings.TrimSpace(u))
+		if strings.HasPrefix(lower, "wss://") || strings.HasPrefix(lower, "ws://") {
+			hints = append(hints, nostr.NormalizeURL(u))
+		}
+	}
+	return uniqueRelayURLs(hints)
+}
+
+// nostrURIPattern matches NIP-21 links to profiles and events in message text
+var nostrURIPattern = regexp.MustCompile(`(?i)nostr:(npub|nprofile|note|nevent|naddr)1[02-9ac-hj-np-z]+`)
+
+// nostrEntity is a decoded nostr: link
+type nostrEntity struct {
+	URI        string
+	Prefix     string
+	Pubkey     string // profile, or the author when known
+	EventID    string // note and nevent
+	Kind       int    // naddr
+	Identifier string // naddr d tag
+	Relays     []string
+}
+
+func (e nostrEntity) isProfile() bool {
+	return e.Prefix == "npub" || e.Prefix == "nprofile"
+}
+
+func parseNostrEntity(uri string) (nostrEntity, error) {
+	e := nostrEntity{URI: uri}
+	prefix, value, err := nip19.Decode(strings.ToLower(stripNostrURI(uri)))
+	if err != nil {
+		return e, err
+	}
+	e.Prefix = prefix
+	switch v := value.(type) {
+	case string:
+		if prefix == "npub" {
+			e.Pubkey = v
+		} else if prefix == "note" {
+			e.EventID = v
+		} else {
+			return e, fmt.Errorf("unsupported %s entity", prefix)
+		}
+	case nostr.ProfilePointer:
+		e.Pubkey = v.PublicKey
+		e.Relays = relayHints(v.Relays)
+	case nostr.EventPointer:
+		e.EventID = v.ID
+		e.Pubkey = v.Author
+		e.Kind = v.Kind
+		e.Relays = relayHints(v.Relays)
+	case nostr.EntityPointer:
+		e.Pubkey = v.PublicKey
+		e.Kind = v.Kind
+		e.Identifier = v.Identifier
+		e.Relays = relayHints(v.Relays)
+	default:
+		return e, fmt.Errorf("unsupported %s entity", prefix)
+	}
+	return e, nil
+}
+
+// filter is the query that fetches the event or profile an entity points to
+func (e nostrEntity) filter() nostr.Filter {
+	switch {
+	case e.isProfile():
+		return nostr.Filter{Kinds: []int{0}, Authors: []string{e.Pubkey}, Limit: 1}
+	case e.Prefix == "naddr":
+		return nostr.Filter{Kinds: []int{e.Kind}, Authors: []string{e.Pubkey}, Tags: nostr.TagMap{"d": []string{e.Identifier}}, Limit: 1}
+	}
+	return nostr.Filter{IDs: []string{e.EventID}, Limit: 1}
+}
+
+// matches checks a fetched event really is what the entity points to
+func (e nostrEntity) matches(ev *nostr.Event) bool {
+	if ev == nil {
+		return false
+	}
+	if ok, err := ev.CheckSignature(); err != nil || !ok {
+		return false
+	}
+	switch {
+	case e.isProfile():
+		return ev.Kind == 0 && ev.PubKey == e.Pubkey
+	case e.Prefix == "naddr":
+		return ev.Kind == e.Kind && ev.PubKey == e.Pubkey && ev.Tags.GetD() == e.Identifier
+	}
+	return ev.ID == e.EventID
+}
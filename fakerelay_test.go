@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/coder/websocket"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip77"
+	"github.com/nbd-wtf/go-nostr/nip77/negentropy"
+	"github.com/nbd-wtf/go-nostr/nip77/negentropy/storage/vector"
+)
+
+// fakeRelay is a minimal in-process relay: it stores events, answers REQ with
+// the stored matches and EOSE, sends new events to open subscriptions and
+// reconciles NIP-77 sessions
+type fakeRelay struct {
+	server *httptest.Server
+	URL    string // ws:// address to dial
+
+	// info is the NIP-11 document, set it before the first connection
+	info string
+	// requireAuth makes REQ and NEG-OPEN wait for NIP-42 AUTH, set it before
+	// the first connection
+	requireAuth bool
+
+	// onEvent is called for every accepted EVENT, outside the relay's lock
+	onEvent func(r *fakeRelay, ev nostr.Event)
+
+	mu sync.Mutex
+	// closedReason, when set, answers every REQ with CLOSED
+	closedReason string
+	// silent leaves REQs unanswered, not even an EOSE
+	silent   bool
+	events   []nostr.Event
+	conns    map[*fakeRelayConn]bool
+	accepted int // connections accepted since the start
+	reqs     int // REQ messages received since the start
+	auths    int // AUTH messages received since the start
+}
+
+type fakeRelayConn struct {
+	ws        *websocket.Conn
+	mu        sync.Mutex
+	subs      map[string]nostr.Filters
+	negs      map[string]*negentropy.Negentropy
+	challenge string
+	authed    bool
+}
+
+func newFakeRelay(t *testing.T) *fakeRelay {
+	r := &fakeRelay{info: `{"name":"fake"}`, conns: make(map[*fakeRelayConn]bool)}
+	r.server = httptest.NewServer(http.HandlerFunc(r.serve))
+	r.URL = "ws" + strings.TrimPrefix(r.server.URL, "http")
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *fakeRelay) serve(w http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("Upgrade") == "" {
+		w.Header().Set("Content-Type", "application/nostr+json")
+		w.Write([]byte(r.info))
+		return
+	}
+	ws, err := websocket.Accept(w, req, nil)
+	if err != nil {
+		return
+	}
+	ws.SetReadLimit(1 << 20)
+	c := &fakeRelayConn{ws: ws, subs: make(map[string]nostr.Filters), negs: make(map[string]*negentropy.Negentropy)}
+	r.mu.Lock()
+	r.conns[c] = true
+	r.accepted++
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.conns, c)
+		r.mu.Unlock()
+		ws.CloseNow()
+	}()
+	if r.requireAuth {
+		c.challenge = nostr.GeneratePrivateKey()[:16]
+		c.send([]interface{}{"AUTH", c.challenge})
+	}
+
+	for {
+		_, msg, err := ws.Read(context.Background())
+		if err != nil {
+			return
+		}
+		var raw []json.RawMessage
+		if json.Unmarshal(msg, &raw) != nil || len(raw) < 2 {
+			continue
+		}
+		var typ, id string
+		json.Unmarshal(raw[0], &typ)
+		switch typ {
+		case "REQ":
+			json.Unmarshal(raw[1], &id)
+			var filters nostr.Filters
+			for _, f := range raw[2:] {
+				var filter nostr.Filter
+				json.Unmarshal(f, &filter)
+				filters = append(filters, filter)
+			}
+			r.mu.Lock()
+			r.reqs++
+			closedReason, silent := r.closedReason, r.silent
+			var matches []nostr.Event
+			for _, filter := range filters {
+				matches = append(matches, r.matching(filter)...)
+			}
+			r.mu.Unlock()
+			if !c.isAuthed() {
+				closedReason = "auth-required: we only serve authenticated users"
+			}
+			if closedReason != "" {
+				c.send([]interface{}{"CLOSED", id, closedReason})
+				continue
+			}
+			if silent {
+				continue
+			}
+			c.mu.Lock()
+			c.subs[id] = filters
+			c.mu.Unlock()
+			for _, ev := range matches {
+				c.send([]interface{}{"EVENT", id, ev})
+			}
+			c.send([]interface{}{"EOSE", id})
+		case "CLOSE":
+			json.Unmarshal(raw[1], &id)
+			c.mu.Lock()
+			delete(c.subs, id)
+			c.mu.Unlock()
+		case "AUTH":
+			r.mu.Lock()
+			r.auths++
+			r.mu.Unlock()
+			var ev nostr.Event
+			json.Unmarshal(raw[1], &ev)
+			ok, _ := ev.CheckSignature()
+			ok = ok && ev.Kind == nostr.KindClientAuthentication && ev.Tags.GetFirst([]string{"challenge", c.challenge}) != nil
+			if ok {
+				c.mu.Lock()
+				c.authed = true
+				c.mu.Unlock()
+			}
+			c.send([]interface{}{"OK", ev.ID, ok, ""})
+		case "NEG-OPEN":
+			var open nip77.OpenEnvelope
+			if open.FromJSON(string(msg)) != nil {
+				continue
+			}
+			if !c.isAuthed() {
+				c.send([]interface{}{"NEG-ERR", open.SubscriptionID, "auth-required: we only serve authenticated users"})
+				continue
+			}
+			vec := vector.New()
+			r.mu.Lock()
+			for _, ev := range r.matching(open.Filter) {
+				vec.Insert(ev.CreatedAt, ev.ID)
+			}
+			r.mu.Unlock()
+			vec.Seal()
+			neg := negentropy.New(vec, 0)
+			c.mu.Lock()
+			c.negs[open.SubscriptionID] = neg
+			c.mu.Unlock()
+			c.reconcile(open.SubscriptionID, neg, open.Message)
+		case "NEG-MSG":
+			var m nip77.MessageEnvelope
+			if m.FromJSON(string(msg)) != nil {
+				continue
+			}
+			c.mu.Lock()
+			neg := c.negs[m.SubscriptionID]
+			c.mu.Unlock()
+			if neg != nil {
+				c.reconcile(m.SubscriptionID, neg, m.Message)
+			}
+		case "NEG-CLOSE":
+			json.Unmarshal(raw[1], &id)
+			c.mu.Lock()
+			delete(c.negs, id)
+			c.mu.Unlock()
+		case "EVENT":
+			var ev nostr.Event
+			json.Unmarshal(raw[1], &ev)
+			ok, _ := ev.CheckSignature()
+			c.send([]interface{}{"OK", ev.ID, ok, ""})
+			if ok {
+				r.Publish(ev)
+				if r.onEvent != nil {
+					r.onEvent(r, ev)
+				}
+			}
+		}
+	}
+}
+
+// matching is the stored events for filter, newest first and up to its
+// limit. r.mu must be held.
+func (r *fakeRelay) matching(filter nostr.Filter) []nostr.Event {
+	var matches []nostr.Event
+	for _, ev := range r.events {
+		if filter.Matches(&ev) {
+			matches = append(matches, ev)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].CreatedAt > matches[j].CreatedAt })
+	if filter.Limit > 0 && len(matches) > filter.Limit {
+		matches = matches[:filter.Limit]
+	}
+	return matches
+}
+
+func (c *fakeRelayConn) isAuthed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.challenge == "" || c.authed
+}
+
+// reconcile answers one message of a NIP-77 session
+func (c *fakeRelayConn) reconcile(id string, neg *negentropy.Negentropy, message string) {
+	next, err := neg.Reconcile(message)
+	if err != nil {
+		c.send([]interface{}{"NEG-ERR", id, "error: " + err.Error()})
+		return
+	}
+	c.send([]interface{}{"NEG-MSG", id, next})
+}
+
+func (c *fakeRelayConn) send(msg interface{}) {
+	b, _ := json.Marshal(msg)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ws.Write(context.Background(), websocket.MessageText, b)
+}
+
+// Publish stores ev and sends it to every open subscription it matches
+func (r *fakeRelay) Publish(ev nostr.Event) {
+	r.mu.Lock()
+	r.events = append(r.events, ev)
+	var conns []*fakeRelayConn
+	for c := range r.conns {
+		conns = append(conns, c)
+	}
+	r.mu.Unlock()
+	for _, c := range conns {
+		c.mu.Lock()
+		var ids []string
+		for id, filters := range c.subs {
+			if filters.Match(&ev) {
+				ids = append(ids, id)
+			}
+		}
+		c.mu.Unlock()
+		for _, id := range ids {
+			c.send([]interface{}{"EVENT", id, ev})
+		}
+	}
+}
+
+// Refuse makes the relay answer REQs with CLOSED and reason, or normally again for ""
+func (r *fakeRelay) Refuse(reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closedReason = reason
+}
+
+// Stall makes the relay ignore REQs, or answer them again
+func (r *fakeRelay) Stall(silent bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.silent = silent
+}
+
+// Drop closes every open connection, as a relay restart would
+func (r *fakeRelay) Drop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for c := range r.conns {
+		c.ws.CloseNow()
+	}
+}
+
+// Subscriptions is the number of open subscriptions across connections
+func (r *fakeRelay) Subscriptions() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for c := range r.conns {
+		c.mu.Lock()
+		n += len(c.subs)
+		c.mu.Unlock()
+	}
+	return n
+}
+
+// Stats returns the connections open now and accepted so far, and the REQs received
+func (r *fakeRelay) Stats() (open int, accepted int, reqs int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.conns), r.accepted, r.reqs
+}
+
+// Auths is the number of AUTH messages received
+func (r *fakeRelay) Auths() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.auths
+}
+
+func (r *fakeRelay) Close() {
+	r.Drop()
+	r.server.Close()
+}
@@ -4,23 +4,24 @@ go 1.24.1
 
 require (
 	github.com/awesome-gocui/gocui v1.1.0
+	github.com/btcsuite/btcd/btcutil v1.1.6
+	github.com/coder/websocket v1.8.13
 	github.com/gdamore/tcell/v2 v2.8.1 // indirect
 	github.com/glebarez/sqlite v1.11.0
 	github.com/jeremyd/crusher17 v0.0.2
 	github.com/nbd-wtf/go-nostr v0.51.7
 	golang.org/x/crypto v0.36.0
+	golang.org/x/net v0.37.0
 	gorm.io/gorm v1.25.12
 )
 
 require (
 	github.com/ImVexed/fasturl v0.0.0-20230304231329-4e41488060f3 // indirect
 	github.com/btcsuite/btcd/btcec/v2 v2.3.4 // indirect
-	github.com/btcsuite/btcd/btcutil v1.1.6 // indirect
 	github.com/btcsuite/btcd/chaincfg/chainhash v1.1.0 // indirect
 	github.com/bytedance/sonic v1.13.2 // indirect
 	github.com/bytedance/sonic/loader v0.2.4 // indirect
 	github.com/cloudwego/base64x v0.1.5 // indirect
-	github.com/coder/websocket v1.8.13 // indirect
 	github.com/decred/dcrd/crypto/blake256 v1.1.0 // indirect
 	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.4.0 // indirect
 	github.com/dustin/go-humanize v1.0.1 // indirect
@@ -56,3 +57,6 @@ require (
 	modernc.org/memory v1.9.1 // indirect
 	modernc.org/sqlite v1.36.2 // indirect
 )
+
+// go-nostr v0.51.7 with its data races on close patched, see third_party/go-nostr/PATCHES.md
+replace github.com/nbd-wtf/go-nostr => ./third_party/go-nostr
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+)
+
+// lnurlTimeout bounds each request to an LNURL server
+var lnurlTimeout = 30 * time.Second
+
+// lnurlMaxBody is more than any pay response or invoice needs
+const lnurlMaxBody = 1 << 20
+
+// lnurlScheme is https per LUD-16; point it at http to test against a local stand-in
+var lnurlScheme = "https"
+
+// lnurlStatus is the error form every LNURL endpoint may answer with
+type lnurlStatus struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// LNURLSuccessAction is shown once an LNURL-pay invoice has been paid (LUD-09/10)
+type LNURLSuccessAction struct {
+	Tag         string `json:"tag"`
+	Message     string `json:"message,omitempty"`
+	Description string `json:"description,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Ciphertext  string `json:"ciphertext,omitempty"`
+	IV          string `json:"iv,omitempty"`
+}
+
+// zapAddress is where a profile takes zaps: the lud16 lightning address,
+// falling back to the lud06 lnurl
+func zapAddress(m Metadata) string {
+	if m.Lud16 != "" {
+		return m.Lud16
+	}
+	return strings.TrimSpace(m.Lud06)
+}
+
+// displayZapAddress shortens lnurl1... strings, which are too long for a menu line
+func displayZapAddress(address string) string {
+	if strings.HasPrefix(strings.ToLower(address), "lnurl") {
+		return shortBech32(strings.ToLower(address))
+	}
+	return address
+}
+
+// lnurlPayURL turns a lightning address (LUD-16) or a bech32 lnurl (LUD-06)
+// into the URL of its pay endpoint
+func lnurlPayURL(address string) (string, error) {
+	address = strings.TrimSpace(address)
+	address = strings.TrimPrefix(strings.TrimPrefix(address, "lightning:"), "LIGHTNING:")
+
+	if strings.HasPrefix(strings.ToLower(address), "lnurl1") {
+		hrp, data, err := bech32.DecodeNoLimit(strings.ToLower(address))
+		if err != nil || hrp != "lnurl" {
+			return "", fmt.Errorf("invalid lnurl")
+		}
+		raw, err := bech32.ConvertBits(data, 5, 8, false)
+		if err != nil {
+			return "", fmt.Errorf("invalid lnurl: %w", err)
+		}
+		if err := checkLnurlURL(string(raw)); err != nil {
+			return "", err
+		}
+		return string(raw), nil
+	}
+
+	parts := strings.Split(address, "@")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("invalid lightning address format")
+	}
+	username, domain := strings.ToLower(parts[0]), strings.ToLower(parts[1])
+	scheme := lnurlScheme
+	if lnurlPlainHTTPAllowed(domain) {
+		// onion services are reached over plain http, the address is the key
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s/.well-known/lnurlp/%s", scheme, domain, url.PathEscape(username)), nil
+}
+
+// lnurlPlainHTTPAllowed is true for hosts LNURL may use without TLS: onion
+// services, and anything while tests point lnurlScheme at http
+func lnurlPlainHTTPAllowed(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return lnurlScheme == "http" || isOnion(host)
+}
+
+// checkLnurlURL rejects anything but https, or http to onion services
+func checkLnurlURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid LNURL address %q", raw)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if lnurlPlainHTTPAllowed(u.Host) {
+			return nil
+		}
+		return fmt.Errorf("refusing plain http LNURL address %s", u.Host)
+	}
+	return fmt.Errorf("unsupported LNURL scheme %q", u.Scheme)
+}
+
+// checkLnurlRedirect holds every redirect hop to checkLnurlURL, so a server
+// can't bounce a request over to plain http
+func checkLnurlRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("too many LNURL redirects")
+	}
+	return checkLnurlURL(req.URL.String())
+}
+
+// checkSuccessAction applies LUD-09 to a pay callback's success action: a
+// url action must point at the callback's own domain
+func checkSuccessAction(sa *LNURLSuccessAction, callback string) error {
+	if sa == nil || !strings.EqualFold(sa.Tag, "url") {
+		return nil
+	}
+	if err := checkLnurlURL(sa.URL); err != nil {
+		return err
+	}
+	actionURL, _ := url.Parse(sa.URL)
+	callbackURL, err := url.Parse(callback)
+	if err != nil || !strings.EqualFold(actionURL.Hostname(), callbackURL.Hostname()) {
+		return fmt.Errorf("success action links to %s, not the callback's domain", actionURL.Hostname())
+	}
+	return nil
+}
+
+// lnurlGet fetches an LNURL endpoint into out, turning status ERROR answers
+// into errors carrying the server's reason
+func lnurlGet(raw string, out interface{}) error {
+	if err := checkLnurlURL(raw); err != nil {
+		return err
+	}
+	client := http.Client{Timeout: lnurlTimeout, CheckRedirect: checkLnurlRedirect}
+	resp, err := client.Get(raw)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, lnurlMaxBody))
+	if err != nil {
+		return fmt.Errorf("error reading LNURL response: %w", err)
+	}
+	var status lnurlStatus
+	if json.Unmarshal(body, &status) == nil && strings.EqualFold(status.Status, "ERROR") {
+		if status.Reason == "" {
+			status.Reason = "no reason given"
+		}
+		return fmt.Errorf("LNURL server error: %s", status.Reason)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("LNURL server answered %s", resp.Status)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("error parsing LNURL response: %w", err)
+	}
+	return nil
+}
+
+// describe renders a success action for the invoice view. aes actions can
+// only be opened with the payment preimage.
+func (sa *LNURLSuccessAction) describe(preimage string) string {
+	if sa == nil {
+		return ""
+	}
+	switch strings.ToLower(sa.Tag) {
+	case "message":
+		return fmt.Sprintf("Message from the recipient: %s\n", sa.Message)
+	case "url":
+		if checkLnurlURL(sa.URL) != nil {
+			return fmt.Sprintf("%s\n(ignored an unsafe link)\n", sa.Description)
+		}
+		return fmt.Sprintf("%s\nOpen: %s\n", sa.Description, sa.URL)
+	case "aes":
+		if preimage == "" {
+			return fmt.Sprintf("%s\n(encrypted, pay with the connected wallet to read it)\n", sa.Description)
+		}
+		plaintext, err := decryptSuccessAction(sa, preimage)
+		if err != nil {
+			TheLog.Printf("could not decrypt success action: %v", err)
+			return fmt.Sprintf("%s\n(could not decrypt: %v)\n", sa.Description, err)
+		}
+		return fmt.Sprintf("%s\n%s\n", sa.Description, plaintext)
+	}
+	return ""
+}
+
+// decryptSuccessAction opens an aes success action: AES-256-CBC keyed with
+// the preimage, PKCS#7 padded (LUD-10)
+func decryptSuccessAction(sa *LNURLSuccessAction, preimage string) (string, error) {
+	key, err := hex.DecodeString(preimage)
+	if err != nil || len(key) != 32 {
+		return "", fmt.Errorf("invalid preimage")
+	}
+	iv, err := base64.StdEncoding.DecodeString(sa.IV)
+	if err != nil || len(iv) != aes.BlockSize {
+		return "", fmt.Errorf("invalid iv")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(sa.Ciphertext)
+	if err != nil || len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return "", fmt.Errorf("invalid ciphertext")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+
+	pad := int(plaintext[len(plaintext)-1])
+	if pad == 0 || pad > aes.BlockSize || pad > len(plaintext) {
+		return "", fmt.Errorf("bad padding")
+	}
+	for _, b := range plaintext[len(plaintext)-pad:] {
+		if int(b) != pad {
+			return "", fmt.Errorf("bad padding")
+		}
+	}
+	return string(plaintext[:len(plaintext)-pad]), nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCheckLnurlURL(t *testing.T) {
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://example.com/.well-known/lnurlp/bob", true},
+		{"http://example.com/.well-known/lnurlp/bob", false},
+		{"http://127.0.0.1:8080/.well-known/lnurlp/bob", false},
+		{"http://192.168.1.10/.well-known/lnurlp/bob", false},
+		{"http://localhost/.well-known/lnurlp/bob", false},
+		{"http://abcdefghijklmnop.onion/.well-known/lnurlp/bob", true},
+		{"ftp://example.com/", false},
+	}
+	for _, tt := range tests {
+		if err := checkLnurlURL(tt.url); (err == nil) != tt.ok {
+			t.Errorf("checkLnurlURL(%s) = %v, want ok %v", tt.url, err, tt.ok)
+		}
+	}
+
+	if u, _ := lnurlPayURL("bob@127.0.0.1:8080"); u != "https://127.0.0.1:8080/.well-known/lnurlp/bob" {
+		t.Errorf("lightning address on a local host resolves to %s", u)
+	}
+}
+
+func TestCheckLnurlRedirect(t *testing.T) {
+	from, _ := http.NewRequest("GET", "https://example.com/.well-known/lnurlp/bob", nil)
+	via := []*http.Request{from}
+	to, _ := http.NewRequest("GET", "https://pay.example.com/lnurlp/bob", nil)
+	if err := checkLnurlRedirect(to, via); err != nil {
+		t.Errorf("redirect to https refused: %v", err)
+	}
+	down, _ := http.NewRequest("GET", "http://pay.example.com/lnurlp/bob", nil)
+	if err := checkLnurlRedirect(down, via); err == nil {
+		t.Error("redirect from https to plain http followed")
+	}
+}
+
+func TestCheckSuccessAction(t *testing.T) {
+	callback := "https://pay.example.com/lnurlp/bob/callback"
+	tests := []struct {
+		name string
+		sa   *LNURLSuccessAction
+		ok   bool
+	}{
+		{"none", nil, true},
+		{"message", &LNURLSuccessAction{Tag: "message", Message: "thanks"}, true},
+		{"same domain", &LNURLSuccessAction{Tag: "url", URL: "https://pay.example.com/thanks"}, true},
+		{"same domain other case", &LNURLSuccessAction{Tag: "url", URL: "https://PAY.example.com/thanks"}, true},
+		{"other domain", &LNURLSuccessAction{Tag: "url", URL: "https://evil.example.net/thanks"}, false},
+		{"parent domain", &LNURLSuccessAction{Tag: "url", URL: "https://example.com/thanks"}, false},
+		{"plain http", &LNURLSuccessAction{Tag: "url", URL: "http://pay.example.com/thanks"}, false},
+	}
+	for _, tt := range tests {
+		if err := checkSuccessAction(tt.sa, callback); (err == nil) != tt.ok {
+			t.Errorf("%s: checkSuccessAction = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
@@ -21,6 +21,7 @@ var TheGui *gocui.Gui
 func main() {
 	DB = GetGormConnection()
 	RunMigrations()
+	setupProxy()
 
 	var login Login
 	loginDbErr := DB.First(&login).Error
@@ -74,6 +75,12 @@ func main() {
 
 	doDMRelays(DB, CTX)
 
+	go wotScoreManager()
+	go nip05Verifier()
+	go zapVerifier()
+	go relayHealthManager()
+	go outboxManager()
+
 	go watchInterrupt()
 
 	g, err := gocui.NewGui(gocui.OutputTrue, true)
@@ -94,43 +101,47 @@ func main() {
 		for {
 			var RelayStatuses []RelayStatus
 			DB.Find(&RelayStatuses)
+			retrying := false
 			for _, relayStatus := range RelayStatuses {
+				if !relayStatus.NextRetry.IsZero() {
+					if nostrPool.Relay(relayStatus.Url) != nil {
+						// reconnected some other way, e.g. by an account switch
+						clearRelayRetry(DB, relayStatus.Url)
+					} else {
+						retrying = true
+					}
+				}
 				if relayStatus.Status == "waiting" {
 					doRelay(DB, CTX, relayStatus.Url)
+				} else if relayNeedsRetry(relayStatus) {
+					// reconnect with exponential backoff, the pool redials
+					// relays it had itself
+					if relayStatus.NextRetry.IsZero() {
+						scheduleRelayRetry(DB, relayStatus.Url, 1, time.Now().Add(relayBackoff(1)))
+					} else if time.Now().After(relayStatus.NextRetry) {
+						attempt := relayStatus.RetryCount + 1
+						scheduleRelayRetry(DB, relayStatus.Url, attempt, time.Now().Add(relayBackoff(attempt)))
+						TheLog.Printf("reconnect attempt %d to relay: %s", attempt, relayStatus.Url)
+						retryRelay(DB, relayStatus.Url)
+					}
 				} else if relayStatus.Status == "deleting" {
 					TheLog.Printf("Processing relay marked for deletion: %s", relayStatus.Url)
-					foundit := false
-					for i, r := range nostrRelays {
-						if r.URL == relayStatus.Url {
-							TheLog.Printf("Found relay to delete: %s", r.URL)
-							err := DB.Delete(&relayStatus).Error
-							if err != nil {
-								TheLog.Printf("Error deleting relay status: %v", err)
-							} else {
-								TheLog.Printf("Successfully deleted relay status for: %s", relayStatus.Url)
-							}
-							foundit = true
-							r.Close()
-							TheLog.Printf("Closed relay connection: %s", r.URL)
-
-							// Remove from nostrRelays slice
-							nostrRelays = append(nostrRelays[:i], nostrRelays[i+1:]...)
-							TheLog.Printf("Removed relay from nostrRelays slice")
-							break
-						}
-					}
-					// if we didn't find it, delete the record anyway
-					if !foundit {
+					if nostrPool.Close(relayStatus.Url) {
+						TheLog.Printf("Closed relay connection: %s", relayStatus.Url)
+					} else {
 						TheLog.Printf("Relay connection not found, deleting record anyway: %s", relayStatus.Url)
-						err := DB.Delete(&relayStatus).Error
-						if err != nil {
-							TheLog.Printf("Error deleting relay status: %v", err)
-						} else {
-							TheLog.Printf("Successfully deleted relay status for: %s", relayStatus.Url)
-						}
+					}
+					err := DB.Delete(&relayStatus).Error
+					if err != nil {
+						TheLog.Printf("Error deleting relay status: %v", err)
+					} else {
+						TheLog.Printf("Successfully deleted relay status for: %s", relayStatus.Url)
 					}
 				}
 			}
+			if retrying {
+				refreshV4Retries()
+			}
 			time.Sleep(1 * time.Second)
 		}
 	}()
@@ -138,5 +149,6 @@ func main() {
 	if err := g.MainLoop(); err != nil && err != gocui.ErrQuit {
 		log.Panicln(err)
 	}
+	flushRelayHealth()
 
 }
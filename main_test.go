@@ -0,0 +1,25 @@
+package main
+
+import (
+	"log"
+	"os"
+	"testing"
+)
+
+// TestMain runs the tests against a throwaway in-memory database, from a
+// temporary directory so flightless.log lands there and not in the checkout
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "flightless-test")
+	if err != nil {
+		log.Fatalf("Failed to create test directory: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		log.Fatalf("Failed to enter test directory: %v", err)
+	}
+	os.Setenv("DB", "file::memory:?cache=shared")
+	DB = GetGormConnection()
+	RunMigrations()
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
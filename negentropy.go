@@ -0,0 +1,409 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip77"
+	"github.com/nbd-wtf/go-nostr/nip77/negentropy"
+	"github.com/nbd-wtf/go-nostr/nip77/negentropy/storage/vector"
+)
+
+// negentropyFrameLimit caps the size of one NIP-77 message we send
+const negentropyFrameLimit = 60000
+
+// negentropyTimeout bounds one set reconciliation with a relay
+var negentropyTimeout = 60 * time.Second
+
+// syncFetchBatch is how many missing ids are asked for in one REQ
+var syncFetchBatch = 100
+
+// syncFetchTimeout bounds one REQ of a sync
+var syncFetchTimeout = 30 * time.Second
+
+// syncProfileBatch is how many authors go in one profile reconciliation
+var syncProfileBatch = 500
+
+// giftWrapJitter is how far NIP-59 backdates gift wraps
+var giftWrapJitter = 2 * 24 * time.Hour
+
+// syncWindow is the first time window asked for when a relay can't do NIP-77
+var syncWindow = 7 * 24 * time.Hour
+
+// syncMinWindow is the smallest window a full page is split down to
+var syncMinWindow = time.Hour
+
+// syncWindowLimit is the page size of a time window
+var syncWindowLimit = 500
+
+// syncEmptyWindows is how many empty windows in a row end a sync without a floor
+var syncEmptyWindows = 8
+
+// syncSlots limits how many relays are synced at once
+var syncSlots = make(chan struct{}, 3)
+
+// syncRunning has a key per relay and kind being synced, so a reconnect
+// doesn't start a second sync of the same thing
+var syncRunning sync.Map
+
+// recordSyncedEvent remembers that we have ev, for the kinds we sync
+func recordSyncedEvent(ev *nostr.Event) {
+	owner := ev.PubKey
+	switch ev.Kind {
+	case 0:
+		// replaceable, only the newest one matters
+		DB.Where("kind = ? AND owner = ? AND event_created_at < ?", 0, owner, int64(ev.CreatedAt)).Delete(&SyncedEvent{})
+	case 1059:
+		if p := ev.Tags.Find("p"); len(p) >= 2 {
+			owner = p[1]
+		}
+	default:
+		return
+	}
+	DB.Exec("INSERT OR IGNORE INTO synced_events (event_id, kind, owner, event_created_at) VALUES (?, ?, ?, ?)",
+		ev.ID, ev.Kind, owner, int64(ev.CreatedAt))
+}
+
+// syncedEvents are the events of kind we have for owners
+func syncedEvents(kind int, owners []string) []SyncedEvent {
+	var events []SyncedEvent
+	DB.Where("kind = ? AND owner IN ?", kind, owners).Find(&events)
+	return events
+}
+
+// startSync claims a sync job (what) on url, false when one is already running
+func startSync(url string, what string) (func(), bool) {
+	key := normalizeRelayURL(url) + " " + what
+	if _, running := syncRunning.LoadOrStore(key, true); running {
+		return nil, false
+	}
+	syncSlots <- struct{}{}
+	return func() {
+		<-syncSlots
+		syncRunning.Delete(key)
+	}, true
+}
+
+// parseNegMessage decodes a NIP-77 message from a relay. nip77.ParseNegMessage
+// can't be used, it compares the label with the opening bracket still on it.
+func parseNegMessage(message string) nostr.Envelope {
+	var fields []json.RawMessage
+	if err := json.Unmarshal([]byte(message), &fields); err != nil || len(fields) == 0 {
+		return nil
+	}
+	var label string
+	if err := json.Unmarshal(fields[0], &label); err != nil {
+		return nil
+	}
+	var env nostr.Envelope
+	switch label {
+	case "NEG-MSG":
+		env = &nip77.MessageEnvelope{}
+	case "NEG-ERR":
+		env = &nip77.ErrorEnvelope{}
+	default:
+		return nil
+	}
+	if err := env.FromJSON(message); err != nil {
+		return nil
+	}
+	return env
+}
+
+// errNegAuthRequired is a NEG-ERR asking us to AUTH first
+var errNegAuthRequired = errors.New("relay requires AUTH")
+
+// negSessionSeq numbers the NIP-77 sessions, two syncs may share a connection
+var negSessionSeq atomic.Int64
+
+// negentropyHaveNots reconciles the local events with what the relay has for
+// filter (NIP-77) and returns the ids only the relay has. A relay that wants
+// AUTH first gets it and a second try.
+func negentropyHaveNots(url string, filter nostr.Filter, local []SyncedEvent) ([]string, error) {
+	ids, err := negentropyReconcile(url, filter, local)
+	if errors.Is(err, errNegAuthRequired) {
+		if relay := nostrPool.Relay(url); relay != nil {
+			if ok, _ := performAuth(relay); ok {
+				return negentropyReconcile(url, filter, local)
+			}
+		}
+	}
+	return ids, err
+}
+
+// negentropyReconcile is one NIP-77 session on the pool's connection to url
+func negentropyReconcile(url string, filter nostr.Filter, local []SyncedEvent) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), negentropyTimeout)
+	defer cancel()
+
+	vec := vector.New()
+	for _, se := range local {
+		vec.Insert(nostr.Timestamp(se.EventCreatedAt), se.EventId)
+	}
+	vec.Seal()
+	neg := negentropy.New(vec, negentropyFrameLimit)
+
+	subID := fmt.Sprintf("flightless-neg-%d", negSessionSeq.Add(1))
+	failed := make(chan error, 1)
+	fail := func(err error) {
+		select {
+		case failed <- err:
+		default:
+		}
+	}
+
+	var relay *nostr.Relay
+	relay, existed, end, err := nostrPool.Negentropy(ctx, url, subID, func(env nostr.Envelope) {
+		switch env := env.(type) {
+		case *nip77.ErrorEnvelope:
+			if strings.HasPrefix(env.Reason, "auth-required:") {
+				fail(fmt.Errorf("%w: %s", errNegAuthRequired, env.Reason))
+				return
+			}
+			fail(fmt.Errorf("relay returned NEG-ERR: %s", env.Reason))
+		case *nip77.MessageEnvelope:
+			next, err := neg.Reconcile(env.Message)
+			if err != nil {
+				fail(fmt.Errorf("failed to reconcile: %w", err))
+				return
+			}
+			if next != "" {
+				msg, _ := nip77.MessageEnvelope{SubscriptionID: subID, Message: next}.MarshalJSON()
+				relay.Write(msg)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer end()
+	// AUTH up front on a fresh connection, like the DM relay subscription does
+	if !existed && relayWantsAuth(url, true) {
+		performAuth(relay)
+	}
+
+	// ids only we have are of no use here, but must be taken off the channel
+	go func() {
+		for {
+			select {
+			case _, ok := <-neg.Haves:
+				if !ok {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	open, _ := nip77.OpenEnvelope{SubscriptionID: subID, Filter: filter, Message: neg.Start()}.MarshalJSON()
+	if err := <-relay.Write(open); err != nil {
+		return nil, fmt.Errorf("failed to write NEG-OPEN: %w", err)
+	}
+
+	var ids []string
+	for {
+		select {
+		case id, ok := <-neg.HaveNots:
+			if !ok {
+				closeMsg, _ := nip77.CloseEnvelope{SubscriptionID: subID}.MarshalJSON()
+				<-relay.Write(closeMsg)
+				return ids, nil
+			}
+			ids = append(ids, id)
+		case err := <-failed:
+			return nil, err
+		case <-relay.Context().Done():
+			return nil, fmt.Errorf("connection to %s closed during negentropy sync", url)
+		case <-ctx.Done():
+			return nil, fmt.Errorf("negentropy sync timed out: %w", ctx.Err())
+		}
+	}
+}
+
+// fetchByIDs stores the events with ids from one relay, stopping at the
+// first batch that fails
+func fetchByIDs(url string, ids []string) (int, error) {
+	received := 0
+	for i := 0; i < len(ids); i += syncFetchBatch {
+		end := i + syncFetchBatch
+		if end > len(ids) {
+			end = len(ids)
+		}
+		n, err := fetchUntilEOSE(url, nostr.Filters{{IDs: ids[i:end], Limit: end - i}}, syncFetchTimeout)
+		received += n
+		if err != nil {
+			return received, err
+		}
+	}
+	return received, nil
+}
+
+// negentropySync fetches the events for filter that the relay has and we don't
+func negentropySync(url string, filter nostr.Filter, local []SyncedEvent) (int, error) {
+	ids, err := negentropyHaveNots(url, filter, local)
+	if err != nil {
+		return 0, err
+	}
+	TheLog.Printf("sync: %s has %d events for %v we don't", url, len(ids), filter.Kinds)
+	return fetchByIDs(url, ids)
+}
+
+// syncLimit is the page size for url, lowered to the relay's max_limit
+func syncLimit(url string) int {
+	limit := syncWindowLimit
+	if info := cachedRelayInfo(url); info != nil && info.Limitation.MaxLimit > 0 && info.Limitation.MaxLimit < limit {
+		limit = info.Limitation.MaxLimit
+	}
+	return limit
+}
+
+// syncWindows pages through filter on a relay without NIP-77, one time window
+// at a time from until back to floor. A window that comes back full is split
+// in half and asked again; one that is still full at syncMinWindow is paged
+// through by created_at. With a zero floor it stops after syncEmptyWindows
+// empty windows in a row.
+func syncWindows(url string, filter nostr.Filter, until, floor nostr.Timestamp) (int, error) {
+	limit := syncLimit(url)
+	window := nostr.Timestamp(syncWindow.Seconds())
+	minWindow := nostr.Timestamp(syncMinWindow.Seconds())
+	received, empty := 0, 0
+	for until > floor {
+		since := until - window
+		if since < floor {
+			since = floor
+		}
+		n, oldest, err := syncPage(url, filter, since, until, limit)
+		if err != nil {
+			return received, err
+		}
+		if n >= limit && window > minWindow {
+			// the relay may have more than one page in this window
+			window /= 2
+			continue
+		}
+		received += n
+		for pageUntil := until; n >= limit; {
+			next := oldest
+			if next >= pageUntil {
+				// a whole page in one second, step past it
+				next = pageUntil - 1
+			}
+			if next < since {
+				break
+			}
+			pageUntil = next
+			n, oldest, err = syncPage(url, filter, since, pageUntil, limit)
+			if err != nil {
+				return received, err
+			}
+			received += n
+		}
+		if n == 0 {
+			empty++
+			if floor == 0 && empty >= syncEmptyWindows {
+				break
+			}
+		} else {
+			empty = 0
+		}
+		if n < limit/4 && window < nostr.Timestamp(syncWindow.Seconds()) {
+			window *= 2
+		}
+		until = since - 1
+	}
+	return received, nil
+}
+
+// syncPage fetches up to limit events for filter between since and until,
+// and returns the oldest created_at among them
+func syncPage(url string, filter nostr.Filter, since, until nostr.Timestamp, limit int) (int, nostr.Timestamp, error) {
+	f := filter.Clone()
+	f.Since, f.Until, f.Limit = &since, &until, limit
+	oldest := until
+	n, err := fetchUntilEOSEEach(url, nostr.Filters{f}, syncFetchTimeout, func(ev *nostr.Event) {
+		if ev.CreatedAt < oldest {
+			oldest = ev.CreatedAt
+		}
+	})
+	return n, oldest, err
+}
+
+// syncGiftWraps fetches the gift wraps for pubkey that a DM relay has and we
+// don't: by NIP-77 when the relay supports it, else in time windows back to
+// the newest one we have
+func syncGiftWraps(url string, pubkey string) {
+	done, ok := startSync(url, "gift wraps")
+	if !ok {
+		return
+	}
+	defer done()
+
+	filter := nostr.Filter{Kinds: []int{1059}, Tags: nostr.TagMap{"p": []string{pubkey}}}
+	if relaySupportsNIP(url, 77) {
+		n, err := negentropySync(url, filter, syncedEvents(1059, []string{pubkey}))
+		if err == nil {
+			TheLog.Printf("sync: %d gift wraps from %s", n, url)
+			// reconciliation covers the whole history, nothing left to page through
+			finishGiftWrapBackfill(url, pubkey)
+			return
+		}
+		TheLog.Printf("sync: NIP-77 with %s failed after %d gift wraps, paging instead: %v", url, n, err)
+	}
+
+	var floor nostr.Timestamp
+	var newest SyncedEvent
+	if DB.Where("kind = ? AND owner = ?", 1059, pubkey).Order("event_created_at desc").First(&newest).Error == nil {
+		floor = nostr.Timestamp(newest.EventCreatedAt) - nostr.Timestamp(giftWrapJitter.Seconds())
+		if floor < 0 {
+			floor = 0
+		}
+	}
+	n, err := syncWindows(url, filter, nostr.Now(), floor)
+	if err != nil {
+		TheLog.Printf("sync: %d gift wraps from %s by time window, then: %v", n, url, err)
+		return
+	}
+	TheLog.Printf("sync: %d gift wraps from %s by time window", n, url)
+}
+
+// syncProfiles reconciles the profiles of our follows and conversation
+// partners with a relay that supports NIP-77. Other relays already get them
+// from the follow subscriptions in doRelay.
+func syncProfiles(url string, account Account) {
+	if !relaySupportsNIP(url, 77) {
+		return
+	}
+	done, ok := startSync(url, "profiles")
+	if !ok {
+		return
+	}
+	defer done()
+
+	authors := append(outboxAuthors(account), account.Pubkey)
+	received := 0
+	for i := 0; i < len(authors); i += syncProfileBatch {
+		end := i + syncProfileBatch
+		if end > len(authors) {
+			end = len(authors)
+		}
+		chunk := authors[i:end]
+		n, err := negentropySync(url, nostr.Filter{Kinds: []int{0}, Authors: chunk}, syncedEvents(0, chunk))
+		if err != nil {
+			TheLog.Printf("sync: profiles with %s: %v", url, err)
+			return
+		}
+		received += n
+	}
+	TheLog.Printf("sync: %d profiles from %s", received, url)
+	if received > 0 {
+		refreshNow()
+	}
+}
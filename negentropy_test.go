@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jeremyd/crusher17"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// testAccount makes an active account with a key, unlocked with a test password
+func testAccount(t *testing.T) (sk string, pubkey string) {
+	t.Helper()
+	sk = nostr.GeneratePrivateKey()
+	pubkey, _ = nostr.GetPublicKey(sk)
+	Password = []byte("test")
+	account := Account{Pubkey: pubkey, Privatekey: Encrypt("test", sk), Active: true}
+	DB.Create(&account)
+	t.Cleanup(func() {
+		DB.Delete(&account)
+		DB.Where("account_id = ?", account.ID).Delete(&ChatMessage{})
+		DB.Where("owner = ?", pubkey).Delete(&SyncedEvent{})
+		DB.Where("pubkey_hex = ?", pubkey).Delete(&GiftWrapBackfill{})
+	})
+	return sk, pubkey
+}
+
+// testGiftWrap is a NIP-17 message to pubkey
+func testGiftWrap(t *testing.T, pubkey string, content string) nostr.Event {
+	t.Helper()
+	sender := nostr.GeneratePrivateKey()
+	rumor := nostr.Event{Kind: 14, CreatedAt: nostr.Now(), Tags: nostr.Tags{{"p", pubkey}}, Content: content}
+	rumor.PubKey, _ = nostr.GetPublicKey(sender)
+	wrapped, err := crusher17.WrapMessage(rumor, sender, pubkey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ev nostr.Event
+	if err := json.Unmarshal([]byte(wrapped), &ev); err != nil {
+		t.Fatal(err)
+	}
+	return ev
+}
+
+func TestSyncGiftWrapsByNegentropy(t *testing.T) {
+	relay := newFakeRelay(t)
+	relay.info = `{"name":"fake","supported_nips":[77]}`
+	relay.requireAuth = true
+	url := normalizeRelayURL(relay.URL)
+	_, pubkey := testAccount(t)
+
+	good := testGiftWrap(t, pubkey, "hello")
+	// a gift wrap we can't open is not recorded, the next sync asks again
+	bad := nostr.Event{Kind: 1059, CreatedAt: nostr.Now(), Tags: nostr.Tags{{"p", pubkey}}, Content: "garbage"}
+	bad.Sign(nostr.GeneratePrivateKey())
+	relay.Publish(good)
+	relay.Publish(bad)
+
+	syncGiftWraps(url, pubkey)
+	synced := syncedEvents(1059, []string{pubkey})
+	if len(synced) != 1 || synced[0].EventId != good.ID {
+		t.Fatalf("synced %v, want only the gift wrap that opened", synced)
+	}
+	var messages int64
+	DB.Model(&ChatMessage{}).Where("event_id = ?", good.ID).Count(&messages)
+	if messages != 1 {
+		t.Fatal("the gift wrap was not stored as a message")
+	}
+	if bf := giftWrapBackfill(url, pubkey); !bf.Done {
+		t.Fatal("a completed reconciliation did not finish the backfill")
+	}
+
+	// the relay reconciles but won't serve the events: not finished
+	DB.Where("pubkey_hex = ?", pubkey).Delete(&GiftWrapBackfill{})
+	relay.Refuse("blocked: not today")
+	syncGiftWraps(url, pubkey)
+	if bf := giftWrapBackfill(url, pubkey); bf.Done {
+		t.Fatal("the backfill finished although fetching the missing gift wraps failed")
+	}
+}
+
+func TestSyncWindowsPagesFullMinimumWindow(t *testing.T) {
+	relay := newFakeRelay(t)
+	relay.info = `{"name":"fake","limitation":{"max_limit":3}}`
+	url := normalizeRelayURL(relay.URL)
+	getRelayInfo(url)
+
+	// ten profiles within a minute, more than fit a page of the smallest window
+	now := nostr.Now()
+	var pubkeys []string
+	for i := 0; i < 10; i++ {
+		ev := nostr.Event{Kind: 0, CreatedAt: now - nostr.Timestamp(10+i*5), Content: `{"name":"sync"}`}
+		ev.Sign(nostr.GeneratePrivateKey())
+		relay.Publish(ev)
+		pubkeys = append(pubkeys, ev.PubKey)
+	}
+	t.Cleanup(func() {
+		DB.Where("pubkey_hex IN ?", pubkeys).Delete(&Metadata{})
+		DB.Where("owner IN ?", pubkeys).Delete(&SyncedEvent{})
+	})
+
+	if _, err := syncWindows(url, nostr.Filter{Kinds: []int{0}}, now, now-2*3600); err != nil {
+		t.Fatal(err)
+	}
+	var stored int64
+	DB.Model(&Metadata{}).Where("pubkey_hex IN ?", pubkeys).Count(&stored)
+	if stored != 10 {
+		t.Fatalf("%d of 10 profiles fetched", stored)
+	}
+
+	timeout := syncFetchTimeout
+	syncFetchTimeout = 300 * time.Millisecond
+	t.Cleanup(func() { syncFetchTimeout = timeout })
+	relay.Stall(true)
+	if _, err := syncWindows(url, nostr.Filter{Kinds: []int{0}}, now, now-2*3600); err == nil {
+		t.Fatal("a window that timed out was taken as empty")
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	nip05Verified  = "verified"
+	nip05Failed    = "failed"
+	nip05Unchecked = "unchecked"
+)
+
+// how long a NIP-05 result is trusted before the verifier checks it again
+var nip05VerifiedTTL = 24 * time.Hour
+var nip05FailedTTL = 6 * time.Hour
+
+// nip05RetryBase is the wait after a first network or HTTP failure, doubled
+// for each failure in a row up to nip05FailedTTL
+var nip05RetryBase = 5 * time.Minute
+
+// errNip05Unreachable marks failures that say nothing about the identifier:
+// the domain couldn't be reached or didn't answer with a document
+var errNip05Unreachable = errors.New("nip-05 domain unreachable")
+
+// nip05Scheme is https per the spec; point it at http to test against a local stand-in
+var nip05Scheme = "https"
+
+// nip05HTTPClient does not follow redirects, NIP-05 forbids them
+var nip05HTTPClient = &http.Client{
+	Timeout: 10 * time.Second,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// nip05Document is the body of /.well-known/nostr.json
+type nip05Document struct {
+	Names  map[string]string   `json:"names"`
+	Relays map[string][]string `json:"relays,omitempty"`
+}
+
+// splitNip05 turns name@domain (or a bare domain, meaning _@domain) into its parts
+func splitNip05(identifier string) (string, string, error) {
+	identifier = strings.TrimSpace(identifier)
+	name, domain := "_", identifier
+	if at := strings.LastIndex(identifier, "@"); at >= 0 {
+		name, domain = identifier[:at], identifier[at+1:]
+	}
+	if name == "" || domain == "" || strings.ContainsAny(domain, "/?# ") {
+		return "", "", fmt.Errorf("invalid nip-05 identifier: %s", identifier)
+	}
+	return strings.ToLower(name), strings.ToLower(domain), nil
+}
+
+// fetchNip05 resolves an identifier to a pubkey and the relays the domain lists for it
+func fetchNip05(identifier string) (string, []string, error) {
+	name, domain, err := splitNip05(identifier)
+	if err != nil {
+		return "", nil, err
+	}
+	u := fmt.Sprintf("%s://%s/.well-known/nostr.json?name=%s", nip05Scheme, domain, url.QueryEscape(name))
+	resp, err := nip05HTTPClient.Get(u)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", errNip05Unreachable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("%w: %s returned HTTP %d", errNip05Unreachable, domain, resp.StatusCode)
+	}
+
+	var doc nip05Document
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&doc); err != nil {
+		return "", nil, fmt.Errorf("bad nostr.json from %s: %w", domain, err)
+	}
+	pubkey := ""
+	for n, p := range doc.Names {
+		if strings.ToLower(n) == name {
+			pubkey = strings.ToLower(p)
+			break
+		}
+	}
+	if pubkey == "" {
+		return "", nil, fmt.Errorf("%s is not listed by %s", name, domain)
+	}
+	if len(pubkey) != 64 || !isHex(pubkey) {
+		return "", nil, fmt.Errorf("%s lists an invalid pubkey for %s", domain, name)
+	}
+	return pubkey, doc.Relays[pubkey], nil
+}
+
+// nip05Backoff is how long to wait before retrying after attempts network or
+// HTTP failures in a row
+func nip05Backoff(attempts int) time.Duration {
+	wait := nip05RetryBase
+	for i := 1; i < attempts && wait < nip05FailedTTL; i++ {
+		wait *= 2
+	}
+	if wait > nip05FailedTTL {
+		wait = nip05FailedTTL
+	}
+	return wait
+}
+
+// verifyNip05 checks pubkey's advertised NIP-05 and caches the outcome. When
+// the domain can't be reached the identifier stays unchecked and is retried
+// with backoff, only a document that doesn't list the pubkey fails it.
+func verifyNip05(pubkey string) Nip05Check {
+	var m Metadata
+	DB.First(&m, "pubkey_hex = ?", pubkey)
+	var prev Nip05Check
+	DB.First(&prev, "pubkey_hex = ?", pubkey)
+	check := Nip05Check{PubkeyHex: pubkey, Identifier: m.Nip05, LastChecked: time.Now()}
+	if m.Nip05 == "" {
+		check.Status = nip05Unchecked
+		DB.Save(&check)
+		return check
+	}
+
+	resolved, _, err := fetchNip05(m.Nip05)
+	if err == nil && resolved != pubkey {
+		err = errors.New("identifier points to a different pubkey")
+	}
+	switch {
+	case errors.Is(err, errNip05Unreachable):
+		check.Status = nip05Unchecked
+		check.Error = err.Error()
+		if prev.Identifier == m.Nip05 {
+			check.Attempts = prev.Attempts
+		}
+		check.Attempts++
+		check.ExpiresAt = check.LastChecked.Add(nip05Backoff(check.Attempts))
+		TheLog.Printf("nip-05 %s for %s not checked (attempt %d): %v", m.Nip05, pubkey, check.Attempts, err)
+	case err != nil:
+		check.Status = nip05Failed
+		check.Error = err.Error()
+		check.ExpiresAt = check.LastChecked.Add(nip05FailedTTL)
+		TheLog.Printf("nip-05 %s failed for %s: %v", m.Nip05, pubkey, err)
+	default:
+		check.Status = nip05Verified
+		check.ExpiresAt = check.LastChecked.Add(nip05VerifiedTTL)
+	}
+	if err := DB.Save(&check).Error; err != nil {
+		TheLog.Printf("error saving nip-05 check: %v", err)
+	}
+	return check
+}
+
+// nip05Status returns the cached status of a pubkey's current NIP-05, treating
+// results for an old identifier as unchecked
+func nip05Status(checks map[string]Nip05Check, m Metadata) string {
+	if m.Nip05 == "" {
+		return ""
+	}
+	c, ok := checks[m.PubkeyHex]
+	if !ok || c.Identifier != m.Nip05 || c.Status == "" {
+		return nip05Unchecked
+	}
+	return c.Status
+}
+
+func loadNip05Checks(pubkeys []string) map[string]Nip05Check {
+	checks := make(map[string]Nip05Check)
+	for i := 0; i < len(pubkeys); i += 500 {
+		end := i + 500
+		if end > len(pubkeys) {
+			end = len(pubkeys)
+		}
+		var rows []Nip05Check
+		DB.Where("pubkey_hex IN ?", pubkeys[i:end]).Find(&rows)
+		for _, r := range rows {
+			checks[r.PubkeyHex] = r
+		}
+	}
+	return checks
+}
+
+// nip05Marker is the short badge shown next to an identifier in v2
+func nip05Marker(status string) string {
+	switch status {
+	case nip05Verified:
+		return "✓"
+	case nip05Failed:
+		return "✗"
+	case nip05Unchecked:
+		return "?"
+	}
+	return " "
+}
+
+// nip05Describe is the longer form used in the person view
+func nip05Describe(pubkey string, nip05 string) string {
+	if nip05 == "" {
+		return ""
+	}
+	checks := loadNip05Checks([]string{pubkey})
+	status := nip05Status(checks, Metadata{PubkeyHex: pubkey, Nip05: nip05})
+	c := checks[pubkey]
+	switch status {
+	case nip05Verified:
+		return fmt.Sprintf("%s [✓ verified %s]", nip05, c.LastChecked.Format("2006-01-02 15:04"))
+	case nip05Failed:
+		return fmt.Sprintf("%s [✗ failed %s: %s]", nip05, c.LastChecked.Format("2006-01-02 15:04"), c.Error)
+	}
+	nip05Want(pubkey)
+	if c.Identifier == nip05 && c.Error != "" {
+		return fmt.Sprintf("%s [? unchecked, retrying %s: %s]", nip05, c.ExpiresAt.Format("15:04"), c.Error)
+	}
+	return fmt.Sprintf("%s [? unchecked]", nip05)
+}
+
+// nip05Shown collects pubkeys displayed since the verifier's last pass, so
+// profiles outside our follows are checked once somebody looks at them
+var nip05Shown = struct {
+	sync.Mutex
+	pubkeys map[string]bool
+}{pubkeys: make(map[string]bool)}
+
+// nip05Wake cuts the verifier's idle wait short when something is shown
+var nip05Wake = make(chan struct{}, 1)
+
+// nip05Want asks the verifier to check pubkeys that are on screen
+func nip05Want(pubkeys ...string) {
+	if len(pubkeys) == 0 {
+		return
+	}
+	nip05Shown.Lock()
+	for _, p := range pubkeys {
+		nip05Shown.pubkeys[p] = true
+	}
+	nip05Shown.Unlock()
+	select {
+	case nip05Wake <- struct{}{}:
+	default:
+	}
+}
+
+// takeNip05Shown empties nip05Shown and returns what was in it
+func takeNip05Shown() []string {
+	nip05Shown.Lock()
+	defer nip05Shown.Unlock()
+	var pubkeys []string
+	for p := range nip05Shown.pubkeys {
+		pubkeys = append(pubkeys, p)
+	}
+	nip05Shown.pubkeys = make(map[string]bool)
+	return pubkeys
+}
+
+// dueNip05 are up to limit profiles among the active account's follows and
+// shown whose identifier was never checked, changed or expired
+func dueNip05(shown []string, limit int) []Metadata {
+	var account Account
+	DB.Where("active = ?", true).First(&account)
+	var due []Metadata
+	DB.Raw(`SELECT metadata.* FROM metadata
+		LEFT JOIN nip05_checks ON nip05_checks.pubkey_hex = metadata.pubkey_hex
+		WHERE metadata.nip05 != ''
+			AND (metadata.pubkey_hex IN (SELECT follow_pubkey_hex FROM metadata_follows WHERE metadata_pubkey_hex = ?)
+				OR metadata.pubkey_hex IN ?)
+			AND (nip05_checks.pubkey_hex IS NULL
+				OR nip05_checks.identifier != metadata.nip05
+				OR nip05_checks.expires_at < ?)
+		LIMIT ?`, account.Pubkey, append([]string{account.Pubkey}, shown...), time.Now(), limit).Scan(&due)
+	return due
+}
+
+// nip05Verifier re-checks expired or never checked identifiers of our follows
+// and of profiles on screen in the background, a small batch at a time
+func nip05Verifier() {
+	var shown []string
+	for {
+		shown = append(shown, takeNip05Shown()...)
+		due := dueNip05(shown, 20)
+		for _, m := range due {
+			verifyNip05(m.PubkeyHex)
+		}
+		if len(due) == 0 {
+			// everything shown is checked or waiting out its backoff
+			shown = nil
+			select {
+			case <-time.After(time.Minute):
+			case <-nip05Wake:
+			}
+		} else {
+			time.Sleep(5 * time.Second)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// nip05TestServer serves a nostr.json listing bob at pubkey
+func nip05TestServer(t *testing.T, pubkey string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/nostr.json" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"names":{"bob":%q}}`, pubkey)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func useNip05HTTP(t *testing.T) {
+	old := nip05Scheme
+	nip05Scheme = "http"
+	t.Cleanup(func() { nip05Scheme = old })
+}
+
+func saveNip05Profile(t *testing.T, pubkey string, nip05 string) {
+	t.Helper()
+	if err := DB.Save(&Metadata{PubkeyHex: pubkey, Nip05: nip05}).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		DB.Where("pubkey_hex = ?", pubkey).Delete(&Metadata{})
+		DB.Where("pubkey_hex = ?", pubkey).Delete(&Nip05Check{})
+	})
+}
+
+func TestVerifyNip05Match(t *testing.T) {
+	useNip05HTTP(t)
+	pubkey := strings.Repeat("1", 64)
+	srv := nip05TestServer(t, pubkey)
+	saveNip05Profile(t, pubkey, "bob@"+srv.Listener.Addr().String())
+
+	check := verifyNip05(pubkey)
+	if check.Status != nip05Verified {
+		t.Fatalf("status = %q (%s), want verified", check.Status, check.Error)
+	}
+	if got := check.ExpiresAt.Sub(check.LastChecked); got != nip05VerifiedTTL {
+		t.Errorf("expires after %v, want %v", got, nip05VerifiedTTL)
+	}
+}
+
+func TestVerifyNip05Mismatch(t *testing.T) {
+	useNip05HTTP(t)
+	pubkey := strings.Repeat("2", 64)
+	srv := nip05TestServer(t, strings.Repeat("3", 64))
+	saveNip05Profile(t, pubkey, "bob@"+srv.Listener.Addr().String())
+
+	check := verifyNip05(pubkey)
+	if check.Status != nip05Failed {
+		t.Fatalf("status = %q, want failed", check.Status)
+	}
+	if check.Attempts != 0 {
+		t.Errorf("attempts = %d, a mismatch is not retried early", check.Attempts)
+	}
+}
+
+func TestVerifyNip05NetworkError(t *testing.T) {
+	useNip05HTTP(t)
+	pubkey := strings.Repeat("4", 64)
+	srv := nip05TestServer(t, pubkey)
+	addr := srv.Listener.Addr().String()
+	srv.Close()
+	saveNip05Profile(t, pubkey, "bob@"+addr)
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		check := verifyNip05(pubkey)
+		if check.Status != nip05Unchecked {
+			t.Fatalf("attempt %d: status = %q, want unchecked", attempt, check.Status)
+		}
+		if check.Attempts != attempt {
+			t.Fatalf("attempts = %d, want %d", check.Attempts, attempt)
+		}
+		if got, want := check.ExpiresAt.Sub(check.LastChecked), nip05Backoff(attempt); got != want {
+			t.Errorf("attempt %d: retry after %v, want %v", attempt, got, want)
+		}
+	}
+	if nip05Backoff(2) != 2*nip05RetryBase || nip05Backoff(100) != nip05FailedTTL {
+		t.Errorf("backoff doesn't double up to %v", nip05FailedTTL)
+	}
+}
+
+func TestVerifyNip05HTTPError(t *testing.T) {
+	useNip05HTTP(t)
+	pubkey := strings.Repeat("5", 64)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	saveNip05Profile(t, pubkey, "bob@"+srv.Listener.Addr().String())
+
+	if check := verifyNip05(pubkey); check.Status != nip05Unchecked {
+		t.Fatalf("status = %q, want unchecked", check.Status)
+	}
+}
+
+func TestDueNip05OnlyFollowsAndShown(t *testing.T) {
+	account := strings.Repeat("a", 64)
+	follow, shown, stranger := strings.Repeat("b", 64), strings.Repeat("c", 64), strings.Repeat("d", 64)
+	DB.Create(&Account{Pubkey: account, Active: true})
+	DB.Exec("INSERT INTO metadata_follows (metadata_pubkey_hex, follow_pubkey_hex) VALUES (?, ?)", account, follow)
+	t.Cleanup(func() {
+		DB.Where("pubkey = ?", account).Delete(&Account{})
+		DB.Exec("DELETE FROM metadata_follows WHERE metadata_pubkey_hex = ?", account)
+	})
+	for _, p := range []string{follow, shown, stranger} {
+		saveNip05Profile(t, p, "x@example.com")
+	}
+
+	due := make(map[string]bool)
+	for _, m := range dueNip05([]string{shown}, 20) {
+		due[m.PubkeyHex] = true
+	}
+	if !due[follow] || !due[shown] || due[stranger] {
+		t.Fatalf("due = %v, want the follow and the shown profile only", due)
+	}
+
+	DB.Save(&Nip05Check{PubkeyHex: follow, Identifier: "x@example.com", Status: nip05Unchecked, ExpiresAt: time.Now().Add(time.Hour)})
+	for _, m := range dueNip05(nil, 20) {
+		if m.PubkeyHex == follow {
+			t.Fatal("a profile waiting out its backoff is due")
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip04"
+	"github.com/nbd-wtf/go-nostr/nip44"
+)
+
+// NIP-47 event kinds
+const (
+	nwcInfoKind     = 13194
+	nwcRequestKind  = 23194
+	nwcResponseKind = 23195
+)
+
+// nwcTimeout bounds a whole request, wallets may take a while to route a payment
+var nwcTimeout = 60 * time.Second
+
+// errNwcNoAnswer is a request the wallet got, or may have got, and never
+// answered: a payment may have gone through all the same
+var errNwcNoAnswer = errors.New("no answer from the wallet")
+
+// nwcConnection is a parsed nostr+walletconnect:// connection string
+type nwcConnection struct {
+	WalletPubkey string
+	Relays       []string
+	Secret       string
+	Lud16        string
+}
+
+// nwcError is the error object of a NIP-47 response
+type nwcError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *nwcError) Error() string {
+	return fmt.Sprintf("wallet error %s: %s", e.Code, e.Message)
+}
+
+type nwcResponse struct {
+	ResultType string          `json:"result_type"`
+	Error      *nwcError       `json:"error"`
+	Result     json.RawMessage `json:"result"`
+}
+
+// nwcTransaction is one entry of a list_transactions result
+type nwcTransaction struct {
+	Type        string `json:"type"`
+	Invoice     string `json:"invoice"`
+	Description string `json:"description"`
+	PaymentHash string `json:"payment_hash"`
+	Amount      int64  `json:"amount"`
+	FeesPaid    int64  `json:"fees_paid"`
+	CreatedAt   int64  `json:"created_at"`
+	SettledAt   int64  `json:"settled_at"`
+}
+
+// nwcEncryption caches which scheme each wallet service asked for
+var nwcEncryption sync.Map
+
+// parseNWC validates a connection string; relays may be ws:// so a local
+// wallet service can stand in for a real one
+func parseNWC(uri string) (nwcConnection, error) {
+	var conn nwcConnection
+	uri = strings.TrimSpace(uri)
+	lower := strings.ToLower(uri)
+	if !strings.HasPrefix(lower, "nostr+walletconnect:") {
+		return conn, fmt.Errorf("expected a nostr+walletconnect:// connection string")
+	}
+	// accept the scheme with or without the slashes
+	rest := uri[len("nostr+walletconnect:"):]
+	u, err := url.Parse("nwc://" + strings.TrimPrefix(rest, "//"))
+	if err != nil {
+		return conn, fmt.Errorf("invalid connection string: %w", err)
+	}
+
+	conn.WalletPubkey = strings.ToLower(u.Host)
+	if len(conn.WalletPubkey) != 64 || !isHex(conn.WalletPubkey) {
+		return conn, fmt.Errorf("connection string has an invalid wallet pubkey")
+	}
+	q := u.Query()
+	for _, r := range q["relay"] {
+		r = strings.TrimSpace(r)
+		if !strings.HasPrefix(r, "wss://") && !strings.HasPrefix(r, "ws://") {
+			return conn, fmt.Errorf("invalid relay in connection string: %s", r)
+		}
+		conn.Relays = append(conn.Relays, nostr.NormalizeURL(r))
+	}
+	if len(conn.Relays) == 0 {
+		return conn, fmt.Errorf("connection string has no relay")
+	}
+	conn.Secret = strings.ToLower(q.Get("secret"))
+	if len(conn.Secret) != 64 || !isHex(conn.Secret) {
+		return conn, fmt.Errorf("connection string has an invalid secret")
+	}
+	conn.Lud16 = q.Get("lud16")
+	return conn, nil
+}
+
+// accountNWC returns the account's wallet connection, if one is configured
+func accountNWC(account Account) (nwcConnection, bool, error) {
+	if account.NwcConnection == "" {
+		return nwcConnection{}, false, nil
+	}
+	conn, err := parseNWC(Decrypt(string(Password), account.NwcConnection))
+	if err != nil {
+		return conn, true, err
+	}
+	return conn, true, nil
+}
+
+// nwcUsesNip44 reads the wallet's info event to pick an encryption scheme,
+// falling back to NIP-04 which every wallet service supports
+func nwcUsesNip44(ctx context.Context, relay *nostr.Relay, conn nwcConnection) bool {
+	if v, ok := nwcEncryption.Load(conn.WalletPubkey); ok {
+		return v.(bool)
+	}
+	infoCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	events, err := relay.QuerySync(infoCtx, nostr.Filter{Kinds: []int{nwcInfoKind}, Authors: []string{conn.WalletPubkey}, Limit: 1})
+	if err != nil || len(events) == 0 {
+		return false
+	}
+	useNip44 := false
+	if tag := events[0].Tags.Find("encryption"); tag != nil {
+		for _, scheme := range strings.Fields(strings.Join(tag[1:], " ")) {
+			if scheme == "nip44_v2" {
+				useNip44 = true
+			}
+		}
+	}
+	nwcEncryption.Store(conn.WalletPubkey, useNip44)
+	return useNip44
+}
+
+func nwcEncrypt(conn nwcConnection, plaintext string, useNip44 bool) (string, error) {
+	if useNip44 {
+		key, err := nip44.GenerateConversationKey(conn.WalletPubkey, conn.Secret)
+		if err != nil {
+			return "", err
+		}
+		return nip44.Encrypt(plaintext, key)
+	}
+	key, err := nip04.ComputeSharedSecret(conn.WalletPubkey, conn.Secret)
+	if err != nil {
+		return "", err
+	}
+	return nip04.Encrypt(plaintext, key)
+}
+
+func nwcDecrypt(conn nwcConnection, ciphertext string, useNip44 bool) (string, error) {
+	if useNip44 {
+		key, err := nip44.GenerateConversationKey(conn.WalletPubkey, conn.Secret)
+		if err != nil {
+			return "", err
+		}
+		return nip44.Decrypt(ciphertext, key)
+	}
+	key, err := nip04.ComputeSharedSecret(conn.WalletPubkey, conn.Secret)
+	if err != nil {
+		return "", err
+	}
+	return nip04.Decrypt(ciphertext, key)
+}
+
+// nwcRequest sends one NIP-47 command and waits for the wallet's reply,
+// trying the connection's relays in order
+func nwcRequest(conn nwcConnection, method string, params interface{}) (json.RawMessage, error) {
+	var lastErr error
+	for _, relayURL := range conn.Relays {
+		result, published, err := nwcRequestOnRelay(relayURL, conn, method, params)
+		if err == nil {
+			return result, nil
+		}
+		if published {
+			// the wallet may already be acting on it, sending the command
+			// again through another relay could pay an invoice twice
+			return nil, err
+		}
+		TheLog.Printf("nwc %s via %s failed: %v", method, relayURL, err)
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func nwcRequestOnRelay(relayURL string, conn nwcConnection, method string, params interface{}) (json.RawMessage, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), nwcTimeout)
+	defer cancel()
+
+	relay, err := dialRelay(ctx, relayURL)
+	if err != nil {
+		return nil, false, err
+	}
+	defer relay.Close()
+
+	useNip44 := nwcUsesNip44(ctx, relay, conn)
+	payload, err := json.Marshal(map[string]interface{}{"method": method, "params": params})
+	if err != nil {
+		return nil, false, err
+	}
+	content, err := nwcEncrypt(conn, string(payload), useNip44)
+	if err != nil {
+		return nil, false, err
+	}
+
+	clientPubkey, err := nostr.GetPublicKey(conn.Secret)
+	if err != nil {
+		return nil, false, err
+	}
+	tags := nostr.Tags{{"p", conn.WalletPubkey}}
+	if useNip44 {
+		tags = append(tags, nostr.Tag{"encryption", "nip44_v2"})
+	}
+	req := nostr.Event{
+		Kind:      nwcRequestKind,
+		PubKey:    clientPubkey,
+		CreatedAt: nostr.Now(),
+		Tags:      tags,
+		Content:   content,
+	}
+	if err := req.Sign(conn.Secret); err != nil {
+		return nil, false, err
+	}
+
+	// subscribe before publishing so a fast wallet can't answer unseen
+	sub, err := relay.Subscribe(ctx, []nostr.Filter{{
+		Kinds:   []int{nwcResponseKind},
+		Authors: []string{conn.WalletPubkey},
+		Tags:    nostr.TagMap{"e": []string{req.ID}},
+	}})
+	if err != nil {
+		return nil, false, err
+	}
+	defer sub.Unsub()
+
+	// a failed publish may still have reached the relay, so it counts as sent
+	err = relay.Publish(ctx, req)
+	recordRelayPublish(relayURL, err)
+	if err != nil {
+		return nil, true, fmt.Errorf("relay did not accept the request: %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, true, fmt.Errorf("%w within %s", errNwcNoAnswer, nwcTimeout)
+		case ev, ok := <-sub.Events:
+			if !ok {
+				return nil, true, fmt.Errorf("%w, the relay closed the subscription", errNwcNoAnswer)
+			}
+			if ev.PubKey != conn.WalletPubkey || ev.Tags.FindWithValue("e", req.ID) == nil {
+				continue
+			}
+			plaintext, err := nwcDecrypt(conn, ev.Content, useNip44)
+			if err != nil {
+				return nil, true, fmt.Errorf("could not decrypt the wallet response: %w", err)
+			}
+			var resp nwcResponse
+			if err := json.Unmarshal([]byte(plaintext), &resp); err != nil {
+				return nil, true, fmt.Errorf("bad wallet response: %w", err)
+			}
+			if resp.Error != nil {
+				return nil, true, resp.Error
+			}
+			return resp.Result, true, nil
+		}
+	}
+}
+
+// nwcPayInvoice pays a BOLT11 invoice and returns the preimage, which must
+// hash to the invoice's payment hash for the payment to count as made
+func nwcPayInvoice(conn nwcConnection, invoice string) (string, error) {
+	inv, err := decodeBolt11(invoice)
+	if err != nil {
+		return "", err
+	}
+	raw, err := nwcRequest(conn, "pay_invoice", map[string]string{"invoice": invoice})
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		Preimage string `json:"preimage"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return "", fmt.Errorf("bad pay_invoice result: %w", err)
+	}
+	preimage, err := hex.DecodeString(result.Preimage)
+	if err != nil || len(preimage) != 32 {
+		return "", fmt.Errorf("wallet returned an invalid preimage %q", result.Preimage)
+	}
+	if hash := sha256.Sum256(preimage); hex.EncodeToString(hash[:]) != inv.PaymentHash {
+		return "", fmt.Errorf("wallet returned a preimage that does not match the invoice")
+	}
+	return result.Preimage, nil
+}
+
+// nwcGetBalance returns the wallet balance in millisats
+func nwcGetBalance(conn nwcConnection) (int64, error) {
+	raw, err := nwcRequest(conn, "get_balance", map[string]string{})
+	if err != nil {
+		return 0, err
+	}
+	var result struct {
+		Balance int64 `json:"balance"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return 0, fmt.Errorf("bad get_balance result: %w", err)
+	}
+	return result.Balance, nil
+}
+
+// nwcListTransactions returns the wallet's most recent transactions
+func nwcListTransactions(conn nwcConnection, limit int) ([]nwcTransaction, error) {
+	raw, err := nwcRequest(conn, "list_transactions", map[string]int{"limit": limit})
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Transactions []nwcTransaction `json:"transactions"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("bad list_transactions result: %w", err)
+	}
+	return result.Transactions, nil
+}
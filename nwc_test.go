@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip04"
+)
+
+// testInvoice builds an unsigned 1000 sat invoice for paymentHash, enough
+// for decodeBolt11 which doesn't check signatures
+func testInvoice(t *testing.T, paymentHash []byte) string {
+	return buildTestInvoice(t, "lnbc10u", testInvoiceField(t, bolt11FieldPaymentHash, paymentHash))
+}
+
+// testInvoiceField is a tagged field holding value
+func testInvoiceField(t *testing.T, typ byte, value []byte) []byte {
+	t.Helper()
+	groups, err := bech32.ConvertBits(value, 8, 5, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append([]byte{typ, byte(len(groups) >> 5), byte(len(groups) & 31)}, groups...)
+}
+
+// buildTestInvoice encodes an invoice dated now with fields and a blank signature
+func buildTestInvoice(t *testing.T, hrp string, fields ...[]byte) string {
+	t.Helper()
+	data := make([]byte, 7)
+	ts := time.Now().Unix()
+	for i := 6; i >= 0; i-- {
+		data[i] = byte(ts & 31)
+		ts >>= 5
+	}
+	for _, f := range fields {
+		data = append(data, f...)
+	}
+	data = append(data, make([]byte, bolt11SignatureLen)...)
+	invoice, err := bech32.Encode(hrp, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return invoice
+}
+
+// fakeWallet answers NIP-47 requests on a fake relay with respond's result
+func fakeWallet(t *testing.T, respond func(req map[string]interface{}) (interface{}, *nwcError)) nwcConnection {
+	walletSecret, clientSecret := nostr.GeneratePrivateKey(), nostr.GeneratePrivateKey()
+	walletPubkey, _ := nostr.GetPublicKey(walletSecret)
+	relay := newFakeRelay(t)
+	relay.onEvent = func(r *fakeRelay, ev nostr.Event) {
+		if ev.Kind != nwcRequestKind || respond == nil {
+			return
+		}
+		key, _ := nip04.ComputeSharedSecret(ev.PubKey, walletSecret)
+		plaintext, err := nip04.Decrypt(ev.Content, key)
+		if err != nil {
+			t.Errorf("wallet could not decrypt the request: %v", err)
+			return
+		}
+		var req map[string]interface{}
+		json.Unmarshal([]byte(plaintext), &req)
+		result, werr := respond(req)
+		body, _ := json.Marshal(map[string]interface{}{"result_type": req["method"], "result": result, "error": werr})
+		content, _ := nip04.Encrypt(string(body), key)
+		resp := nostr.Event{
+			Kind:      nwcResponseKind,
+			CreatedAt: nostr.Now(),
+			Tags:      nostr.Tags{{"p", ev.PubKey}, {"e", ev.ID}},
+			Content:   content,
+		}
+		resp.Sign(walletSecret)
+		r.Publish(resp)
+	}
+
+	conn, err := parseNWC(fmt.Sprintf("nostr+walletconnect://%s?relay=%s&secret=%s", walletPubkey, relay.URL, clientSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func randomPreimage(t *testing.T) ([]byte, []byte) {
+	preimage := make([]byte, 32)
+	if _, err := rand.Read(preimage); err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256(preimage)
+	return preimage, hash[:]
+}
+
+func TestNwcPayInvoiceSuccess(t *testing.T) {
+	preimage, hash := randomPreimage(t)
+	invoice := testInvoice(t, hash)
+	conn := fakeWallet(t, func(req map[string]interface{}) (interface{}, *nwcError) {
+		params := req["params"].(map[string]interface{})
+		if req["method"] != "pay_invoice" || params["invoice"] != invoice {
+			t.Errorf("unexpected request %v", req)
+		}
+		return map[string]string{"preimage": hex.EncodeToString(preimage)}, nil
+	})
+
+	got, err := nwcPayInvoice(conn, invoice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != hex.EncodeToString(preimage) {
+		t.Fatalf("preimage = %s, want %x", got, preimage)
+	}
+}
+
+func TestNwcPayInvoiceWrongPreimage(t *testing.T) {
+	_, hash := randomPreimage(t)
+	other, _ := randomPreimage(t)
+	conn := fakeWallet(t, func(req map[string]interface{}) (interface{}, *nwcError) {
+		return map[string]string{"preimage": hex.EncodeToString(other)}, nil
+	})
+
+	if _, err := nwcPayInvoice(conn, testInvoice(t, hash)); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("err = %v, want a preimage mismatch", err)
+	}
+}
+
+func TestNwcPayInvoiceWalletError(t *testing.T) {
+	_, hash := randomPreimage(t)
+	conn := fakeWallet(t, func(req map[string]interface{}) (interface{}, *nwcError) {
+		return nil, &nwcError{Code: "INSUFFICIENT_BALANCE", Message: "not enough sats"}
+	})
+
+	_, err := nwcPayInvoice(conn, testInvoice(t, hash))
+	werr, ok := err.(*nwcError)
+	if !ok || werr.Code != "INSUFFICIENT_BALANCE" {
+		t.Fatalf("err = %v, want the wallet's error", err)
+	}
+}
+
+func TestNwcPayInvoiceTimeout(t *testing.T) {
+	old := nwcTimeout
+	nwcTimeout = 500 * time.Millisecond
+	t.Cleanup(func() { nwcTimeout = old })
+	_, hash := randomPreimage(t)
+	conn := fakeWallet(t, nil)
+
+	start := time.Now()
+	_, err := nwcPayInvoice(conn, testInvoice(t, hash))
+	if !errors.Is(err, errNwcNoAnswer) {
+		t.Fatalf("err = %v, want a timeout", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("gave up after %v", time.Since(start))
+	}
+}
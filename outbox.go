@@ -0,0 +1,218 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// outbox routing (NIP-65): profiles are fetched from the write relays listed
+// in each author's kind 10002 instead of only from our configured relays
+
+// outboxMaxRelays caps how many relays one outbox pass connects to
+var outboxMaxRelays = 20
+
+// outboxRelaysPerAuthor is how many of an author's write relays are asked for them
+var outboxRelaysPerAuthor = 2
+
+// outboxBatchSize is the most authors sent to a relay in one REQ
+var outboxBatchSize = 200
+
+// outboxConcurrency is how many outbox relays are fetched from at once
+var outboxConcurrency = 5
+
+// outboxTimeout bounds one batch on one relay
+var outboxTimeout = 20 * time.Second
+
+// outboxInterval is the wait between outbox passes
+var outboxInterval = 30 * time.Minute
+
+// outboxStartDelay gives the configured relays time to deliver relay lists first
+var outboxStartDelay = 2 * time.Minute
+
+// outboxKinds are fetched from each author's outbox relays
+var outboxKinds = []int{0, 10002, 10050}
+
+// outboxRoute is a relay and the authors it is asked about
+type outboxRoute struct {
+	url     string
+	authors []string
+}
+
+// outboxWriteRelays returns the normalized write relays of each author that
+// has a relay list, leaving out relays we failed to reach this session
+func outboxWriteRelays(authors []string) map[string][]string {
+	health := relayHealthSnapshot()
+	unreachable := func(url string) bool {
+		h, ok := health[url]
+		return ok && h.Connects == 0 && h.ConnectFails > 0
+	}
+
+	writeRelays := make(map[string][]string)
+	for i := 0; i < len(authors); i += 500 {
+		end := i + 500
+		if end > len(authors) {
+			end = len(authors)
+		}
+		var rows []RelayList
+		DB.Where("pubkey_hex IN ? AND write = ?", authors[i:end], true).Find(&rows)
+		for _, r := range rows {
+			url := normalizeRelayURL(r.Url)
+			if url == "" || unreachable(url) {
+				continue
+			}
+			seen := false
+			for _, u := range writeRelays[r.PubkeyHex] {
+				if u == url {
+					seen = true
+					break
+				}
+			}
+			if !seen {
+				writeRelays[r.PubkeyHex] = append(writeRelays[r.PubkeyHex], url)
+			}
+		}
+	}
+	return writeRelays
+}
+
+// planOutboxRoutes picks relays greedily, each time the one that covers the
+// most authors still short of outboxRelaysPerAuthor, until outboxMaxRelays.
+// Authors without a usable relay list, or whose relays did not make the cut,
+// are returned as unrouted.
+func planOutboxRoutes(authors []string) ([]outboxRoute, []string) {
+	writeRelays := outboxWriteRelays(authors)
+
+	// need is how many more of its relays each author should be asked on
+	need := make(map[string]int)
+	byRelay := make(map[string][]string)
+	for author, urls := range writeRelays {
+		need[author] = outboxRelaysPerAuthor
+		if len(urls) < need[author] {
+			need[author] = len(urls)
+		}
+		for _, url := range urls {
+			byRelay[url] = append(byRelay[url], author)
+		}
+	}
+
+	var routes []outboxRoute
+	for len(routes) < outboxMaxRelays {
+		best, bestCount := "", 0
+		for url, listed := range byRelay {
+			count := 0
+			for _, author := range listed {
+				if need[author] > 0 {
+					count++
+				}
+			}
+			if count > bestCount || (count == bestCount && count > 0 && url < best) {
+				best, bestCount = url, count
+			}
+		}
+		if bestCount == 0 {
+			break
+		}
+		route := outboxRoute{url: best}
+		for _, author := range byRelay[best] {
+			if need[author] > 0 {
+				route.authors = append(route.authors, author)
+				need[author]--
+			}
+		}
+		sort.Strings(route.authors)
+		routes = append(routes, route)
+		delete(byRelay, best)
+	}
+
+	var unrouted []string
+	for _, author := range authors {
+		if need[author] == outboxRelaysPerAuthor || len(writeRelays[author]) == 0 {
+			unrouted = append(unrouted, author)
+		}
+	}
+	return routes, unrouted
+}
+
+// outboxAuthors are the people we follow and the people we have conversations with
+func outboxAuthors(account Account) []string {
+	var authors []string
+	DB.Raw("SELECT DISTINCT follow_pubkey_hex FROM metadata_follows WHERE metadata_pubkey_hex = ?", account.Pubkey).Scan(&authors)
+
+	var partners []string
+	DB.Raw("SELECT DISTINCT from_pubkey FROM chat_messages WHERE account_id = ? UNION SELECT DISTINCT to_pubkey FROM chat_messages WHERE account_id = ?",
+		account.ID, account.ID).Scan(&partners)
+
+	seen := make(map[string]bool)
+	var unique []string
+	for _, pk := range append(authors, partners...) {
+		if pk == "" || pk == account.Pubkey || seen[pk] {
+			continue
+		}
+		seen[pk] = true
+		unique = append(unique, pk)
+	}
+	return unique
+}
+
+// runOutbox fetches the profiles, relay lists and DM relays of our follows
+// and conversation partners from their own write relays
+func runOutbox(account Account) {
+	authors := outboxAuthors(account)
+	if len(authors) == 0 {
+		return
+	}
+	routes, unrouted := planOutboxRoutes(authors)
+	TheLog.Printf("outbox: %d authors on %d relays, %d without a usable relay list", len(authors)-len(unrouted), len(routes), len(unrouted))
+
+	sem := make(chan struct{}, outboxConcurrency)
+	var wg sync.WaitGroup
+	for _, route := range routes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(route outboxRoute) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			received := 0
+			for i := 0; i < len(route.authors); i += outboxBatchSize {
+				end := i + outboxBatchSize
+				if end > len(route.authors) {
+					end = len(route.authors)
+				}
+				n, err := fetchOutboxBatch(route.url, route.authors[i:end])
+				received += n
+				if err != nil {
+					TheLog.Printf("outbox: %s: %v", route.url, err)
+					break
+				}
+			}
+			TheLog.Printf("outbox: %d events for %d authors from %s", received, len(route.authors), route.url)
+		}(route)
+	}
+	wg.Wait()
+	refreshNow()
+}
+
+// fetchOutboxBatch asks one relay for the outbox kinds of authors over a
+// short-lived subscription, until EOSE or outboxTimeout
+func fetchOutboxBatch(url string, authors []string) (int, error) {
+	return fetchUntilEOSE(url, nostr.Filters{{
+		Kinds:   outboxKinds,
+		Authors: authors,
+		Limit:   len(authors) * len(outboxKinds),
+	}}, outboxTimeout)
+}
+
+// outboxManager runs an outbox pass for the active account every outboxInterval
+func outboxManager() {
+	time.Sleep(outboxStartDelay)
+	for {
+		var account Account
+		if err := DB.Where("active = ?", true).First(&account).Error; err == nil && account.Pubkey != "" {
+			runOutbox(account)
+		}
+		time.Sleep(outboxInterval)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// proxyDirect is the per-relay override that skips the global proxy
+const proxyDirect = "direct"
+
+// globalProxy is the SOCKS5 proxy all traffic goes through, from the
+// FLIGHTLESS_PROXY environment variable, e.g. socks5://127.0.0.1:9050 for Tor.
+// Empty connects directly.
+var globalProxy = strings.TrimSpace(os.Getenv("FLIGHTLESS_PROXY"))
+
+// proxyStrict refuses every connection that would not go through a proxy,
+// set by FLIGHTLESS_PROXY_STRICT
+var proxyStrict = proxyStrictEnabled(os.Getenv("FLIGHTLESS_PROXY_STRICT"))
+
+// proxyDialTimeout bounds a direct dial, Tor circuits get longer through the context
+var proxyDialTimeout = 30 * time.Second
+
+func proxyStrictEnabled(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "0", "false", "no", "off":
+		return false
+	}
+	return true
+}
+
+// checkProxyURL accepts socks5:// and socks5h:// proxies. Both hand host
+// names to the proxy unresolved, which .onion addresses need.
+func checkProxyURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid proxy address %q", raw)
+	}
+	if u.Scheme != "socks5" && u.Scheme != "socks5h" {
+		return fmt.Errorf("unsupported proxy scheme %q, use socks5://host:port", u.Scheme)
+	}
+	return nil
+}
+
+// setupProxy sends all HTTP traffic through proxyDial. The relay websockets,
+// NIP-11 lookups, LNURL requests, avatars and NIP-05 checks all use clients
+// without a transport of their own, so replacing the default covers them.
+func setupProxy() {
+	if globalProxy != "" {
+		if err := checkProxyURL(globalProxy); err != nil {
+			TheLog.Printf("FLIGHTLESS_PROXY: %v, connecting directly", err)
+			globalProxy = ""
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = proxyDial
+	http.DefaultTransport = transport
+
+	switch {
+	case globalProxy != "" && proxyStrict:
+		TheLog.Printf("proxy: all connections through %s, strict", globalProxy)
+	case globalProxy != "":
+		TheLog.Printf("proxy: all connections through %s", globalProxy)
+	case proxyStrict:
+		TheLog.Printf("proxy: strict mode without FLIGHTLESS_PROXY, only relays with a proxy of their own can connect")
+	}
+}
+
+// isOnion reports whether host is a Tor hidden service
+func isOnion(host string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(strings.ToLower(host), "."), ".onion")
+}
+
+// relayHostPort is the address a relay URL dials
+func relayHostPort(relayURL string) string {
+	u, err := url.Parse(normalizeRelayURL(relayURL))
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "ws" {
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(strings.ToLower(u.Hostname()), port)
+}
+
+// proxyFor is the proxy for a connection to addr: the override of a
+// configured relay on that address, else the global proxy. "" is direct.
+func proxyFor(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err == nil {
+		addr = net.JoinHostPort(strings.ToLower(host), port)
+	}
+	var statuses []RelayStatus
+	DB.Where("proxy <> ''").Find(&statuses)
+	for _, status := range statuses {
+		if relayHostPort(status.Url) != addr {
+			continue
+		}
+		if status.Proxy == proxyDirect {
+			return ""
+		}
+		return status.Proxy
+	}
+	return globalProxy
+}
+
+// proxyDial opens every outgoing connection, through the proxy for addr
+func proxyDial(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, _, _ := net.SplitHostPort(addr)
+	via := proxyFor(addr)
+	if via == "" {
+		if proxyStrict {
+			return nil, fmt.Errorf("strict proxy mode: refusing direct connection to %s", addr)
+		}
+		if isOnion(host) {
+			return nil, fmt.Errorf("%s is a Tor address, set FLIGHTLESS_PROXY to reach it", host)
+		}
+		d := net.Dialer{Timeout: proxyDialTimeout}
+		return d.DialContext(ctx, network, addr)
+	}
+
+	u, err := url.Parse(via)
+	if err == nil {
+		err = checkProxyURL(via)
+	}
+	if err != nil {
+		return nil, err
+	}
+	dialer, err := proxy.FromURL(u, proxy.Direct)
+	if err != nil {
+		return nil, fmt.Errorf("error setting up proxy %s: %w", via, err)
+	}
+	conn, err := dialer.(proxy.ContextDialer).DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s through %s: %w", addr, u.Host, err)
+	}
+	return conn, nil
+}
+
+// relayProxyLabel describes how a configured relay connects, for v4
+func relayProxyLabel(status RelayStatus) string {
+	switch {
+	case status.Proxy == proxyDirect && proxyStrict:
+		return "proxy:blocked"
+	case status.Proxy == proxyDirect:
+		return "proxy:direct"
+	case status.Proxy != "":
+		return "proxy:" + status.Proxy
+	}
+	return ""
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// relayHealthDays is how much daily relay history is kept
+const relayHealthDays = 14
+
+// relayHealthFlushInterval is how often the counters are written to the history
+var relayHealthFlushInterval = time.Minute
+
+// relayHealth is what one relay did since startup
+type relayHealth struct {
+	Connects       int
+	ConnectFails   int
+	Disconnects    int
+	ConnectLatency time.Duration // of the last connect
+	EOSELatency    time.Duration // of the last subscription
+	Events         int
+	EventsByKind   map[int]int
+	PublishOK      int
+	PublishFail    int
+	Closed         int
+	LastClosed     string
+	Notices        int
+	LastNotice     string
+	AuthOK         int
+	AuthFail       int
+	LastError      string
+	LastErrorAt    time.Time
+}
+
+var relayHealthMu sync.Mutex
+
+// relayHealthStats are the session counters, by normalized relay URL
+var relayHealthStats = make(map[string]*relayHealth)
+
+// relayHealthPending holds the counts not yet added to today's history row
+var relayHealthPending = make(map[string]*RelayHealthDay)
+
+// updateRelayHealth runs fn on the session counters and the pending history of url
+func updateRelayHealth(url string, fn func(h *relayHealth, day *RelayHealthDay)) {
+	key := normalizeRelayURL(url)
+	if key == "" {
+		return
+	}
+	relayHealthMu.Lock()
+	defer relayHealthMu.Unlock()
+	h, ok := relayHealthStats[key]
+	if !ok {
+		h = &relayHealth{EventsByKind: make(map[int]int)}
+		relayHealthStats[key] = h
+	}
+	day, ok := relayHealthPending[key]
+	if !ok {
+		day = &RelayHealthDay{Url: key}
+		relayHealthPending[key] = day
+	}
+	fn(h, day)
+}
+
+// relayHealthError remembers err as the last thing that went wrong with a relay
+func relayHealthError(h *relayHealth, day *RelayHealthDay, err string) {
+	if len(err) > 500 {
+		err = err[:500]
+	}
+	h.LastError, h.LastErrorAt = err, time.Now()
+	day.Errors++
+	day.LastError = err
+}
+
+func recordRelayConnect(url string, latency time.Duration, err error) {
+	updateRelayHealth(url, func(h *relayHealth, day *RelayHealthDay) {
+		if err != nil {
+			h.ConnectFails++
+			day.ConnectFails++
+			relayHealthError(h, day, err.Error())
+			return
+		}
+		h.Connects++
+		h.ConnectLatency = latency
+		day.Connects++
+		day.ConnectMillis += latency.Milliseconds()
+	})
+}
+
+func recordRelayDisconnect(url string, reason string) {
+	updateRelayHealth(url, func(h *relayHealth, day *RelayHealthDay) {
+		h.Disconnects++
+		day.Disconnects++
+		relayHealthError(h, day, reason)
+	})
+}
+
+func recordRelayEOSE(url string, latency time.Duration) {
+	updateRelayHealth(url, func(h *relayHealth, day *RelayHealthDay) {
+		h.EOSELatency = latency
+		day.EOSEs++
+		day.EOSEMillis += latency.Milliseconds()
+	})
+}
+
+func recordRelayEvent(url string, kind int) {
+	updateRelayHealth(url, func(h *relayHealth, day *RelayHealthDay) {
+		h.Events++
+		h.EventsByKind[kind]++
+		day.Events++
+	})
+}
+
+func recordRelayPublish(url string, err error) {
+	updateRelayHealth(url, func(h *relayHealth, day *RelayHealthDay) {
+		if err != nil {
+			h.PublishFail++
+			day.PublishFail++
+			relayHealthError(h, day, "publish: "+err.Error())
+			return
+		}
+		h.PublishOK++
+		day.PublishOK++
+	})
+}
+
+func recordRelayClosed(url string, reason string) {
+	updateRelayHealth(url, func(h *relayHealth, day *RelayHealthDay) {
+		h.Closed++
+		h.LastClosed = reason
+		day.Closed++
+	})
+}
+
+func recordRelayNotice(url string, notice string) {
+	updateRelayHealth(url, func(h *relayHealth, day *RelayHealthDay) {
+		h.Notices++
+		h.LastNotice = notice
+		day.Notices++
+	})
+}
+
+func recordRelayAuth(url string, err error) {
+	updateRelayHealth(url, func(h *relayHealth, day *RelayHealthDay) {
+		if err != nil {
+			h.AuthFail++
+			day.AuthFail++
+			relayHealthError(h, day, "auth: "+err.Error())
+			return
+		}
+		h.AuthOK++
+		day.AuthOK++
+	})
+}
+
+// relayHealthSnapshot copies the session counters of every relay seen so far
+func relayHealthSnapshot() map[string]relayHealth {
+	relayHealthMu.Lock()
+	defer relayHealthMu.Unlock()
+	snapshot := make(map[string]relayHealth, len(relayHealthStats))
+	for url, h := range relayHealthStats {
+		c := *h
+		c.EventsByKind = make(map[int]int, len(h.EventsByKind))
+		for k, n := range h.EventsByKind {
+			c.EventsByKind[k] = n
+		}
+		snapshot[url] = c
+	}
+	return snapshot
+}
+
+// dialRelay opens a websocket to a relay, timing it for the health
+// dashboard and counting the relay's NOTICEs
+func dialRelay(ctx context.Context, url string, opts ...nostr.RelayOption) (*nostr.Relay, error) {
+	if relayPolicy(url).Disabled {
+		return nil, fmt.Errorf("relay %s is disabled", url)
+	}
+	start := time.Now()
+	opts = append(opts, nostr.WithNoticeHandler(func(notice string) {
+		TheLog.Printf("NOTICE from %s: %s", url, notice)
+		recordRelayNotice(url, notice)
+	}))
+	relay, err := nostr.RelayConnect(ctx, url, opts...)
+	recordRelayConnect(url, time.Since(start), err)
+	return relay, err
+}
+
+// flushRelayHealth adds the pending counters to today's history rows and
+// drops days older than relayHealthDays
+func flushRelayHealth() {
+	relayHealthMu.Lock()
+	pending := relayHealthPending
+	relayHealthPending = make(map[string]*RelayHealthDay)
+	relayHealthMu.Unlock()
+
+	today := time.Now().Format("2006-01-02")
+	for url, delta := range pending {
+		var day RelayHealthDay
+		if err := DB.Where("url = ? AND day = ?", url, today).First(&day).Error; err != nil {
+			day = RelayHealthDay{Url: url, Day: today}
+		}
+		day.add(delta)
+		if err := DB.Save(&day).Error; err != nil {
+			TheLog.Printf("error saving relay health for %s: %v", url, err)
+		}
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -relayHealthDays).Format("2006-01-02")
+	if err := DB.Where("day < ?", cutoff).Delete(&RelayHealthDay{}).Error; err != nil {
+		TheLog.Printf("error pruning relay health history: %v", err)
+	}
+}
+
+// add sums the counters of delta into d
+func (d *RelayHealthDay) add(delta *RelayHealthDay) {
+	d.Connects += delta.Connects
+	d.ConnectFails += delta.ConnectFails
+	d.Disconnects += delta.Disconnects
+	d.ConnectMillis += delta.ConnectMillis
+	d.EOSEs += delta.EOSEs
+	d.EOSEMillis += delta.EOSEMillis
+	d.Events += delta.Events
+	d.PublishOK += delta.PublishOK
+	d.PublishFail += delta.PublishFail
+	d.Closed += delta.Closed
+	d.Notices += delta.Notices
+	d.AuthOK += delta.AuthOK
+	d.AuthFail += delta.AuthFail
+	d.Errors += delta.Errors
+	if delta.LastError != "" {
+		d.LastError = delta.LastError
+	}
+}
+
+// relayHealthManager keeps the relay history on disk
+func relayHealthManager() {
+	for {
+		time.Sleep(relayHealthFlushInterval)
+		flushRelayHealth()
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// relayInfoTTL is how long a NIP-11 document is trusted before it is fetched again
+var relayInfoTTL = 24 * time.Hour
+
+// relayInfoRetry is the wait before fetching again after a failed fetch
+var relayInfoRetry = time.Hour
+
+// relaySearchTimeout bounds a NIP-50 profile search on one relay
+var relaySearchTimeout = 15 * time.Second
+
+type RelayLimitation struct {
+	MaxMessageLength    int   `json:"max_message_length,omitempty"`
+	MaxSubscriptions    int   `json:"max_subscriptions,omitempty"`
+	MaxFilters          int   `json:"max_filters,omitempty"`
+	MaxLimit            int   `json:"max_limit,omitempty"`
+	DefaultLimit        int   `json:"default_limit,omitempty"`
+	MaxSubidLength      int   `json:"max_subid_length,omitempty"`
+	MaxEventTags        int   `json:"max_event_tags,omitempty"`
+	MaxContentLength    int   `json:"max_content_length,omitempty"`
+	MinPowDifficulty    int   `json:"min_pow_difficulty,omitempty"`
+	AuthRequired        bool  `json:"auth_required"`
+	PaymentRequired     bool  `json:"payment_required,omitempty"`
+	RestrictedWrites    bool  `json:"restricted_writes,omitempty"`
+	CreatedAtLowerLimit int64 `json:"created_at_lower_limit,omitempty"`
+	CreatedAtUpperLimit int64 `json:"created_at_upper_limit,omitempty"`
+}
+
+// RelayFee is one entry of a NIP-11 fee schedule
+type RelayFee struct {
+	Amount int    `json:"amount"`
+	Unit   string `json:"unit"`
+	Period int    `json:"period,omitempty"`
+	Kinds  []int  `json:"kinds,omitempty"`
+}
+
+type RelayFees struct {
+	Admission    []RelayFee `json:"admission,omitempty"`
+	Subscription []RelayFee `json:"subscription,omitempty"`
+	Publication  []RelayFee `json:"publication,omitempty"`
+}
+
+// RelayInfo is a NIP-11 relay information document
+type RelayInfo struct {
+	Name          string          `json:"name"`
+	Description   string          `json:"description"`
+	PubKey        string          `json:"pubkey"`
+	Contact       string          `json:"contact"`
+	Supported     []int           `json:"supported_nips"`
+	Software      string          `json:"software"`
+	Version       string          `json:"version"`
+	Icon          string          `json:"icon,omitempty"`
+	PaymentsURL   string          `json:"payments_url,omitempty"`
+	PostingPolicy string          `json:"posting_policy,omitempty"`
+	Limitation    RelayLimitation `json:"limitation"`
+	Fees          RelayFees       `json:"fees,omitempty"`
+}
+
+// supportsNIP reports whether the relay lists nip in supported_nips
+func (ri *RelayInfo) supportsNIP(nip int) bool {
+	for _, n := range ri.Supported {
+		if n == nip {
+			return true
+		}
+	}
+	return false
+}
+
+// relayInfoFetches keeps concurrent lookups of one relay down to a single request
+var relayInfoFetches sync.Map // map[relay URL] -> *sync.Mutex
+
+// relayInfoHTTPURL is where a relay serves its NIP-11 document
+func relayInfoHTTPURL(url string) string {
+	url = normalizeRelayURL(url)
+	return strings.Replace(strings.Replace(url, "ws://", "http://", 1), "wss://", "https://", 1)
+}
+
+// fetchRelayInfo downloads the NIP-11 document of a relay
+func fetchRelayInfo(url string) (*RelayInfo, string, error) {
+	httpURL := relayInfoHTTPURL(url)
+	client := &http.Client{
+		Timeout: time.Second * 5,
+	}
+
+	req, err := http.NewRequest("GET", httpURL, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("error creating request for relay info: %w", err)
+	}
+	req.Header.Set("Accept", "application/nostr+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("error getting relay info: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading relay info: %w", err)
+	}
+	var info RelayInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, "", fmt.Errorf("error decoding relay info from %s (HTTP %d): %w", httpURL, resp.StatusCode, err)
+	}
+	return &info, string(body), nil
+}
+
+// cachedRelayInfo returns the stored document of url however old it is,
+// without going to the network. nil when we never got one.
+func cachedRelayInfo(url string) *RelayInfo {
+	var cached RelayInfoCache
+	if err := DB.Where("url = ?", normalizeRelayURL(url)).First(&cached).Error; err != nil {
+		return nil
+	}
+	return cached.info()
+}
+
+// info parses the stored document
+func (c RelayInfoCache) info() *RelayInfo {
+	if c.Document == "" {
+		return nil
+	}
+	var info RelayInfo
+	if err := json.Unmarshal([]byte(c.Document), &info); err != nil {
+		return nil
+	}
+	return &info
+}
+
+// getRelayInfo returns the NIP-11 document of url, fetching it when the cached
+// one is missing or older than relayInfoTTL. A failed refresh falls back to
+// the stale copy. nil when the relay never served one.
+func getRelayInfo(url string) *RelayInfo {
+	key := normalizeRelayURL(url)
+	if key == "" {
+		return nil
+	}
+	lock, _ := relayInfoFetches.LoadOrStore(key, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	var cached RelayInfoCache
+	found := DB.Where("url = ?", key).First(&cached).Error == nil
+	if found {
+		ttl := relayInfoTTL
+		if cached.Error != "" {
+			ttl = relayInfoRetry
+		}
+		if time.Since(cached.FetchedAt) < ttl {
+			return cached.info()
+		}
+	}
+
+	info, document, err := fetchRelayInfo(key)
+	cached.Url = key
+	cached.FetchedAt = time.Now()
+	if err != nil {
+		TheLog.Printf("%v", err)
+		cached.Error = err.Error()
+	} else {
+		TheLog.Printf("Relay info for %s: %s %s", key, info.Software, info.Version)
+		cached.Error = ""
+		cached.Document = document
+	}
+	if err := DB.Save(&cached).Error; err != nil {
+		TheLog.Printf("error caching relay info for %s: %v", key, err)
+	}
+	return cached.info()
+}
+
+func checkRelayRequiresAuth(url string) bool {
+	info := getRelayInfo(url)
+	return info != nil && info.Limitation.AuthRequired
+}
+
+// relaySupportsNIP reports whether the relay's NIP-11 document lists nip
+func relaySupportsNIP(url string, nip int) bool {
+	info := getRelayInfo(url)
+	return info != nil && info.supportsNIP(nip)
+}
+
+// relayAcceptsAuth is whether AUTH is worth attempting up front: relays that
+// require it or list NIP-42, and relays without a document since we can't tell
+func relayAcceptsAuth(url string) bool {
+	info := getRelayInfo(url)
+	return info == nil || info.Limitation.AuthRequired || info.supportsNIP(42)
+}
+
+// relayLimitFilters lowers filter limits to the relay's max_limit, which
+// relays otherwise enforce by rejecting or silently truncating. Only the
+// cached document is used, subscribing never waits for a fetch.
+func relayLimitFilters(url string, filters nostr.Filters) nostr.Filters {
+	info := cachedRelayInfo(url)
+	if info == nil || info.Limitation.MaxLimit <= 0 {
+		return filters
+	}
+	max := info.Limitation.MaxLimit
+	limited := make(nostr.Filters, len(filters))
+	for i, f := range filters {
+		if f.Limit > max {
+			f = f.Clone()
+			f.Limit = max
+		}
+		limited[i] = f
+	}
+	return limited
+}
+
+// searchRelayProfiles asks the profile index relays that support NIP-50 for
+// profiles matching term. Results are stored like any other kind 0.
+func searchRelayProfiles(term string) {
+	var account Account
+	DB.Where("active = ?", true).First(&account)
+	var wg sync.WaitGroup
+	for _, url := range configuredRelayURLs(relayRoleProfiles) {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			if !relaySupportsNIP(url, 50) {
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), relaySearchTimeout)
+			defer cancel()
+			sub, err := nostrPool.Subscribe(ctx, url, nostr.Filters{{Kinds: []int{0}, Search: term, Limit: 50}})
+			if err != nil {
+				TheLog.Printf("search on relay %s failed: %v", url, err)
+				return
+			}
+			TheLog.Printf("searching relay %s for %q", url, term)
+			processSub(sub, sub.Relay, account.Pubkey, false)
+		}(url)
+	}
+	wg.Wait()
+	refreshNow()
+}
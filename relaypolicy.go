@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// what a configured relay is used for
+const (
+	relayRoleRead     = "read"     // our own profile, follows and lists
+	relayRoleWrite    = "write"    // where our events are published
+	relayRoleProfiles = "profiles" // profile index: follows' profiles, searches, lookups
+	relayRoleDM       = "dm"       // DM inbox: our gift wraps are read from it
+	relayRoleZaps     = "zaps"     // zap receipts are read from it and named in zap requests
+)
+
+// relayRoles in the order they are shown
+var relayRoles = []string{relayRoleRead, relayRoleWrite, relayRoleProfiles, relayRoleDM, relayRoleZaps}
+
+// defaultRelayRoles are the roles of a relay nobody changed, what every
+// configured relay did before roles existed
+var defaultRelayRoles = []string{relayRoleRead, relayRoleWrite, relayRoleProfiles, relayRoleZaps}
+
+// relayRolesNone is stored when every role is turned off, "" is the default
+const relayRolesNone = "none"
+
+// AUTH policies, "" follows the relay's NIP-11 document and AUTH challenges
+const (
+	relayAuthAlways = "always"
+	relayAuthNever  = "never"
+)
+
+// relayAuthModes in the order the editor cycles through them
+var relayAuthModes = []string{"", relayAuthAlways, relayAuthNever}
+
+// relaySubscriptionLimits are the choices for a relay's subscription cap, 0 is none
+var relaySubscriptionLimits = []int{0, 2, 5, 10, 20, 50}
+
+// relayPolicy is the RelayStatus of url with its roles and policies. Relays
+// that aren't configured, like other people's DM relays, get the zero value:
+// every role but dm, automatic AUTH and no limits.
+func relayPolicy(url string) RelayStatus {
+	var rs RelayStatus
+	if DB.Where("url IN ?", relayURLVariants(url)).First(&rs).Error != nil {
+		return RelayStatus{Url: url}
+	}
+	return rs
+}
+
+// roles is the set of roles of rs
+func (rs RelayStatus) roles() map[string]bool {
+	roles := make(map[string]bool)
+	switch rs.Roles {
+	case "":
+		for _, role := range defaultRelayRoles {
+			roles[role] = true
+		}
+	case relayRolesNone:
+	default:
+		for _, role := range strings.Split(rs.Roles, ",") {
+			roles[strings.TrimSpace(role)] = true
+		}
+	}
+	return roles
+}
+
+// hasRole reports whether rs is used for role
+func (rs RelayStatus) hasRole(role string) bool {
+	return rs.roles()[role]
+}
+
+// relayHasRole is hasRole for the relay at url, false when it is disabled
+func relayHasRole(url string, role string) bool {
+	rs := relayPolicy(url)
+	return !rs.Disabled && rs.hasRole(role)
+}
+
+// encodeRelayRoles stores roles in relayRoles order, "" when they are the default
+func encodeRelayRoles(roles map[string]bool) string {
+	var list []string
+	for _, role := range relayRoles {
+		if roles[role] {
+			list = append(list, role)
+		}
+	}
+	if len(list) == 0 {
+		return relayRolesNone
+	}
+	encoded := strings.Join(list, ",")
+	if encoded == strings.Join(defaultRelayRoles, ",") {
+		return ""
+	}
+	return encoded
+}
+
+// configuredRelayURLs are the enabled relays in RelayStatus that have role
+func configuredRelayURLs(role string) []string {
+	var statuses []RelayStatus
+	DB.Where("disabled = ?", false).Find(&statuses)
+	var urls []string
+	for _, rs := range statuses {
+		if rs.Status != "deleting" && rs.hasRole(role) {
+			urls = append(urls, rs.Url)
+		}
+	}
+	return urls
+}
+
+// relayRolesFromList are the roles of a relay added from our NIP-65 list
+func relayRolesFromList(r RelayList) string {
+	roles := make(map[string]bool)
+	for _, role := range defaultRelayRoles {
+		roles[role] = true
+	}
+	if !r.Write {
+		roles[relayRoleWrite] = false
+	}
+	if !r.Read {
+		roles[relayRoleRead] = false
+		roles[relayRoleProfiles] = false
+		roles[relayRoleZaps] = false
+	}
+	return encodeRelayRoles(roles)
+}
+
+// relayWantsAuth is whether to AUTH with url when it asks, and up front when
+// upFront is set. "always" authenticates up front, "never" not at all.
+func relayWantsAuth(url string, upFront bool) bool {
+	switch relayPolicy(url).AuthMode {
+	case relayAuthNever:
+		return false
+	case relayAuthAlways:
+		return true
+	}
+	return !upFront || relayAcceptsAuth(url)
+}
+
+// relayAuthLabel names an AUTH mode for display
+func relayAuthLabel(mode string) string {
+	if mode == "" {
+		return "auto"
+	}
+	return mode
+}
+
+// relayPolicyLabel is the short form of rs's roles and policies for v4,
+// empty for a relay with the defaults
+func relayPolicyLabel(rs RelayStatus) string {
+	var parts []string
+	if rs.Disabled {
+		parts = append(parts, "disabled")
+	}
+	if rs.Roles != "" {
+		parts = append(parts, "roles:"+rs.Roles)
+	}
+	if rs.AuthMode != "" {
+		parts = append(parts, "auth:"+rs.AuthMode)
+	}
+	if rs.MaxSubscriptions > 0 {
+		parts = append(parts, fmt.Sprintf("subs<=%d", rs.MaxSubscriptions))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,606 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip77"
+)
+
+// nostrPool owns every long lived relay connection and the subscriptions on them
+var nostrPool = newRelayPool()
+
+// relayIdleTimeout is how long a connection opened only for subscriptions
+// stays up after its last one ends, so a follow-up query can reuse it
+var relayIdleTimeout = 10 * time.Second
+
+// reconnect backoff: the delay doubles from relayRetryMin up to relayRetryMax,
+// and a random part spreads out retries after a network outage
+var relayRetryMin = 2 * time.Second
+var relayRetryMax = 5 * time.Minute
+
+// relayDialTimeout bounds each reconnect attempt
+var relayDialTimeout = 15 * time.Second
+
+// relayPool hands out one connection per relay URL and counts the
+// subscriptions riding on each. It is safe for concurrent use.
+type relayPool struct {
+	mu     sync.Mutex
+	relays map[string]*pooledRelay
+}
+
+// pooledRelay is a connection, or an attempt at one, in the pool
+type pooledRelay struct {
+	url   string
+	ready chan struct{} // closed once the connection attempt has finished
+	relay *nostr.Relay
+	err   error
+	keep  bool // a configured relay, stays open without subscriptions
+	subs  map[*nostr.Subscription]struct{}
+	// opening counts the slots taken for subscriptions still being sent
+	opening int
+	// negOpen counts the NIP-77 sessions holding the connection, negs has
+	// the handler of each by subscription id
+	negOpen int
+	negs    sync.Map
+
+	// the subscriptions to re-create after a reconnect
+	durable []*durableSubscription
+	// reconnecting is set while the pool redials a dropped connection
+	reconnecting bool
+	// stop is closed when the relay leaves the pool, ending reconnect attempts
+	stop chan struct{}
+}
+
+// poolSubscription is a subscription opened through the pool. The pool is
+// the only reader of go-nostr's EOSE signal, it times it and passes it on in
+// EndOfStoredEvents, which shadows the embedded one.
+type poolSubscription struct {
+	*nostr.Subscription
+	EndOfStoredEvents chan struct{}
+}
+
+// durableSubscription is a long lived subscription: its filters and the
+// function consuming its events
+type durableSubscription struct {
+	filters nostr.Filters
+	handle  func(*nostr.Relay, *poolSubscription)
+}
+
+func newPooledRelay(url string, keep bool) *pooledRelay {
+	return &pooledRelay{
+		url:   url,
+		ready: make(chan struct{}),
+		keep:  keep,
+		subs:  make(map[*nostr.Subscription]struct{}),
+		stop:  make(chan struct{}),
+	}
+}
+
+func newRelayPool() *relayPool {
+	return &relayPool{relays: make(map[string]*pooledRelay)}
+}
+
+// normalizeRelayURL is the key the pool, RelayStatus lookups and URL
+// comparisons use for a relay
+func normalizeRelayURL(url string) string {
+	return nostr.NormalizeURL(url)
+}
+
+// Connect returns the open connection to url, dialing it if needed, and keeps
+// it open until it is closed explicitly. existed reports whether the
+// connection was already there, so callers only AUTH on fresh ones.
+func (p *relayPool) Connect(ctx context.Context, url string) (relay *nostr.Relay, existed bool, err error) {
+	pr, existed, err := p.connect(ctx, url, true)
+	if err != nil {
+		return nil, false, err
+	}
+	return pr.relay, existed, nil
+}
+
+func (p *relayPool) connect(ctx context.Context, url string, keep bool) (*pooledRelay, bool, error) {
+	key := normalizeRelayURL(url)
+	if key == "" {
+		return nil, false, fmt.Errorf("invalid relay URL %q", url)
+	}
+
+	// a dead connection is dropped and dialed once more
+	for attempt := 0; attempt < 2; attempt++ {
+		p.mu.Lock()
+		pr, ok := p.relays[key]
+		if ok {
+			if pr.reconnecting {
+				p.mu.Unlock()
+				return nil, false, fmt.Errorf("relay %s is reconnecting", key)
+			}
+			if keep {
+				pr.keep = true
+			}
+			p.mu.Unlock()
+
+			select {
+			case <-pr.ready:
+			case <-ctx.Done():
+				return nil, false, ctx.Err()
+			}
+			if pr.err == nil && pr.relay.IsConnected() {
+				return pr, true, nil
+			}
+			// a configured relay that dropped is redialed with its durable
+			// subscriptions, whether we notice first or watch does
+			if pr.err == nil && p.redial(pr) {
+				return nil, false, fmt.Errorf("relay %s is reconnecting", key)
+			}
+			p.mu.Lock()
+			if p.relays[key] == pr {
+				delete(p.relays, key)
+			}
+			p.mu.Unlock()
+			continue
+		}
+
+		pr = newPooledRelay(key, keep)
+		p.relays[key] = pr
+		p.mu.Unlock()
+
+		relay, err := dialRelay(ctx, key, nostr.WithCustomHandler(pr.handleCustom))
+		p.mu.Lock()
+		pr.relay, pr.err = relay, err
+		if err != nil && p.relays[key] == pr {
+			delete(p.relays, key)
+		}
+		p.mu.Unlock()
+		close(pr.ready)
+		if err != nil {
+			return nil, false, err
+		}
+		go p.watch(pr)
+		// warm the NIP-11 cache, subscriptions read limits from it
+		go getRelayInfo(key)
+		return pr, false, nil
+	}
+	return nil, false, fmt.Errorf("could not connect to %s", key)
+}
+
+// Subscribe opens a subscription on url, connecting first if needed. The
+// subscription is counted until its context ends; a connection that was only
+// opened for subscriptions is closed when its last one ends.
+func (p *relayPool) Subscribe(ctx context.Context, url string, filters nostr.Filters) (*poolSubscription, error) {
+	pr, _, err := p.connect(ctx, url, false)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := p.subscribe(ctx, pr, filters)
+	if err != nil {
+		p.release(pr)
+		return nil, err
+	}
+	return sub, nil
+}
+
+// Negentropy holds the connection to url for a NIP-77 session: handle gets
+// the NEG-MSG and NEG-ERR messages for subID until end is called. existed is
+// as for Connect.
+func (p *relayPool) Negentropy(ctx context.Context, url string, subID string, handle func(nostr.Envelope)) (relay *nostr.Relay, existed bool, end func(), err error) {
+	pr, existed, err := p.connect(ctx, url, false)
+	if err != nil {
+		return nil, false, nil, err
+	}
+	p.mu.Lock()
+	pr.negOpen++
+	p.mu.Unlock()
+	pr.negs.Store(subID, handle)
+	return pr.relay, existed, func() {
+		pr.negs.Delete(subID)
+		p.mu.Lock()
+		pr.negOpen--
+		p.mu.Unlock()
+		p.release(pr)
+	}, nil
+}
+
+// handleCustom hands the NIP-77 messages go-nostr doesn't parse to their
+// session. data shares go-nostr's read buffer and the reconciliation keeps
+// ids from it, so it is copied first.
+func (pr *pooledRelay) handleCustom(data string) {
+	var subID string
+	env := parseNegMessage(strings.Clone(data))
+	switch env := env.(type) {
+	case *nip77.MessageEnvelope:
+		subID = env.SubscriptionID
+	case *nip77.ErrorEnvelope:
+		subID = env.SubscriptionID
+	default:
+		return
+	}
+	if handle, ok := pr.negs.Load(subID); ok {
+		handle.(func(nostr.Envelope))(env)
+	}
+}
+
+// SubscribeDurable keeps a connection to url with a subscription that is
+// re-created whenever the connection comes back after dropping. handle
+// consumes the subscription's events, the first time and after every reconnect.
+func (p *relayPool) SubscribeDurable(ctx context.Context, url string, filters nostr.Filters, handle func(*nostr.Relay, *poolSubscription)) error {
+	pr, _, err := p.connect(ctx, url, true)
+	if err != nil {
+		return err
+	}
+	max, limited := relayPolicy(pr.url).MaxSubscriptions, relayLimitFilters(pr.url, filters)
+
+	// registered before subscribing, so a drop from here on is handed to
+	// reconnect with this subscription in the durable list it copies
+	d := &durableSubscription{filters: filters, handle: handle}
+	p.mu.Lock()
+	if p.relays[pr.url] != pr {
+		p.mu.Unlock()
+		return fmt.Errorf("relay %s is reconnecting", pr.url)
+	}
+	if err := p.reserve(pr, max); err != nil {
+		p.mu.Unlock()
+		return err
+	}
+	pr.durable = append(pr.durable, d)
+	p.mu.Unlock()
+
+	sub, err := p.open(ctx, pr, limited)
+	if err != nil {
+		p.mu.Lock()
+		current := p.relays[pr.url] == pr
+		if current {
+			pr.durable = withoutDurable(pr.durable, d)
+		}
+		p.mu.Unlock()
+		if !current {
+			// the connection dropped meanwhile, reconnect re-creates it
+			return nil
+		}
+		return err
+	}
+	go handle(pr.relay, sub)
+	return nil
+}
+
+// withoutDurable is durable without d, in a new slice: reconnect may hold the old one
+func withoutDurable(durable []*durableSubscription, d *durableSubscription) []*durableSubscription {
+	var kept []*durableSubscription
+	for _, other := range durable {
+		if other != d {
+			kept = append(kept, other)
+		}
+	}
+	return kept
+}
+
+// subscribe opens a subscription on a ready connection and counts it until it ends
+func (p *relayPool) subscribe(ctx context.Context, pr *pooledRelay, filters nostr.Filters) (*poolSubscription, error) {
+	max, limited := relayPolicy(pr.url).MaxSubscriptions, relayLimitFilters(pr.url, filters)
+	p.mu.Lock()
+	err := p.reserve(pr, max)
+	p.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return p.open(ctx, pr, limited)
+}
+
+// reserve takes a subscription slot on pr, with p.mu held so no other
+// subscription can slip in between the check against max and the count
+func (p *relayPool) reserve(pr *pooledRelay, max int) error {
+	if max > 0 && len(pr.subs)+pr.opening >= max {
+		return fmt.Errorf("relay %s is at its limit of %d subscriptions", pr.url, max)
+	}
+	pr.opening++
+	return nil
+}
+
+// open subscribes in a slot taken by reserve, which becomes the subscription
+// or is given back. It runs without p.mu: go-nostr waits on the relay's
+// write queue, and a stalled relay must not hold up the whole pool.
+func (p *relayPool) open(ctx context.Context, pr *pooledRelay, filters nostr.Filters) (*poolSubscription, error) {
+	start := time.Now()
+	sub, err := pr.relay.Subscribe(ctx, filters)
+	p.mu.Lock()
+	pr.opening--
+	if err == nil {
+		pr.subs[sub] = struct{}{}
+	}
+	p.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	ps := &poolSubscription{Subscription: sub, EndOfStoredEvents: make(chan struct{}, 1)}
+	go func() {
+		select {
+		case <-sub.EndOfStoredEvents:
+			recordRelayEOSE(pr.url, time.Since(start))
+			ps.EndOfStoredEvents <- struct{}{}
+		case <-sub.Context.Done():
+		}
+		<-sub.Context.Done()
+		p.mu.Lock()
+		delete(pr.subs, sub)
+		p.mu.Unlock()
+		p.release(pr)
+	}()
+	return ps, nil
+}
+
+// watch waits for a connection to drop. Configured relays that dropped on
+// their own, rather than being closed by the pool, are redialed.
+func (p *relayPool) watch(pr *pooledRelay) {
+	<-pr.relay.Context().Done()
+	p.redial(pr)
+}
+
+// redial hands a dropped configured relay to reconnect, carrying its durable
+// subscriptions over. It reports false for relays that aren't the pool's
+// current, configured entry; only the first caller for a drop gets true.
+func (p *relayPool) redial(pr *pooledRelay) bool {
+	p.mu.Lock()
+	if p.relays[pr.url] != pr || !pr.keep {
+		p.mu.Unlock()
+		return false
+	}
+	next := newPooledRelay(pr.url, true)
+	next.durable = pr.durable
+	next.reconnecting = true
+	p.relays[pr.url] = next
+	p.mu.Unlock()
+
+	reason := "connection closed"
+	if cause := context.Cause(pr.relay.Context()); cause != nil {
+		reason = cause.Error()
+	}
+	if pr.relay.ConnectionError != nil {
+		reason = pr.relay.ConnectionError.Error()
+	}
+	TheLog.Printf("lost connection to relay %s: %s", pr.url, reason)
+	recordRelayDisconnect(pr.url, reason)
+	UpdateOrCreateRelayStatus(DB, pr.url, "connection error: "+reason)
+	go p.reconnect(next)
+	return true
+}
+
+// reconnect redials pr with backoff until it connects or leaves the pool,
+// then re-creates its durable subscriptions from the last EOSE on
+func (p *relayPool) reconnect(pr *pooledRelay) {
+	stopCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-pr.stop:
+			cancel()
+		case <-stopCtx.Done():
+		}
+	}()
+
+	for attempt := 1; ; attempt++ {
+		delay := relayBackoff(attempt)
+		scheduleRelayRetry(DB, pr.url, attempt, time.Now().Add(delay))
+		refreshV4Retries()
+
+		select {
+		case <-time.After(delay):
+		case <-pr.stop:
+			p.finishReconnect(pr, nil, fmt.Errorf("relay %s left the pool", pr.url))
+			return
+		}
+
+		ctx, cancelDial := context.WithTimeout(stopCtx, relayDialTimeout)
+		relay, err := dialRelay(ctx, pr.url, nostr.WithCustomHandler(pr.handleCustom))
+		cancelDial()
+		if err != nil {
+			TheLog.Printf("reconnect attempt %d to %s failed: %v", attempt, pr.url, err)
+			UpdateOrCreateRelayStatus(DB, pr.url, "connection error: "+err.Error())
+			select {
+			case <-pr.stop:
+				p.finishReconnect(pr, nil, fmt.Errorf("relay %s left the pool", pr.url))
+				return
+			default:
+			}
+			continue
+		}
+
+		select {
+		case <-pr.stop:
+			// closed while we were dialing
+			relay.Close()
+			p.finishReconnect(pr, nil, fmt.Errorf("relay %s left the pool", pr.url))
+			return
+		default:
+		}
+
+		TheLog.Printf("reconnected to relay %s after %d attempts", pr.url, attempt)
+		clearRelayRetry(DB, pr.url)
+		UpdateOrCreateRelayStatus(DB, pr.url, "connection established")
+		durable := p.finishReconnect(pr, relay, nil)
+		go p.watch(pr)
+
+		since := relayResumeSince(pr.url)
+		for _, d := range durable {
+			sub, err := p.subscribe(context.Background(), pr, filtersSince(d.filters, since))
+			if err != nil {
+				TheLog.Printf("failed to resubscribe to relay: %s, %v", pr.url, err)
+				continue
+			}
+			go d.handle(relay, sub)
+		}
+		refreshV4Retries()
+		return
+	}
+}
+
+// finishReconnect publishes the outcome of a reconnect and returns the
+// subscriptions to re-create
+func (p *relayPool) finishReconnect(pr *pooledRelay, relay *nostr.Relay, err error) []*durableSubscription {
+	p.mu.Lock()
+	pr.relay, pr.err = relay, err
+	pr.reconnecting = false
+	durable := pr.durable
+	if err != nil && p.relays[pr.url] == pr {
+		delete(p.relays, pr.url)
+	}
+	p.mu.Unlock()
+	close(pr.ready)
+	return durable
+}
+
+// relayBackoff is the wait before reconnect attempt n: exponential, capped,
+// with half of it randomized
+func relayBackoff(attempt int) time.Duration {
+	delay := relayRetryMax
+	if attempt < 20 {
+		delay = relayRetryMin << (attempt - 1)
+		if delay > relayRetryMax {
+			delay = relayRetryMax
+		}
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// filtersSince copies filters, starting each one at since
+func filtersSince(filters nostr.Filters, since nostr.Timestamp) nostr.Filters {
+	if since == 0 {
+		return filters
+	}
+	resumed := make(nostr.Filters, len(filters))
+	for i, f := range filters {
+		f = f.Clone()
+		if f.Since == nil || *f.Since < since {
+			s := since
+			f.Since = &s
+		}
+		resumed[i] = f
+	}
+	return resumed
+}
+
+// release closes a connection nobody wants anymore. It waits a little first:
+// a subscription's context ends before its CLOSE is written, and go-nostr
+// does not cope with the connection going away under a pending write.
+func (p *relayPool) release(pr *pooledRelay) {
+	time.AfterFunc(relayIdleTimeout, func() {
+		// never close under a dial that is still running
+		<-pr.ready
+		p.mu.Lock()
+		idle := !pr.keep && len(pr.subs) == 0 && pr.opening == 0 && pr.negOpen == 0 && p.relays[pr.url] == pr
+		if idle {
+			delete(p.relays, pr.url)
+		}
+		p.mu.Unlock()
+		if idle {
+			pr.relay.Close()
+		}
+	})
+}
+
+// Has reports whether url is in the pool, connected or reconnecting
+func (p *relayPool) Has(url string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.relays[normalizeRelayURL(url)]
+	return ok
+}
+
+// Relay returns the open connection to url, or nil
+func (p *relayPool) Relay(url string) *nostr.Relay {
+	p.mu.Lock()
+	pr, ok := p.relays[normalizeRelayURL(url)]
+	p.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	select {
+	case <-pr.ready:
+	default:
+		return nil // still connecting
+	}
+	if pr.err != nil || !pr.relay.IsConnected() {
+		return nil
+	}
+	return pr.relay
+}
+
+// Relays returns the open connections, sorted by URL
+func (p *relayPool) Relays() []*nostr.Relay {
+	var relays []*nostr.Relay
+	for _, url := range p.URLs() {
+		if relay := p.Relay(url); relay != nil {
+			relays = append(relays, relay)
+		}
+	}
+	return relays
+}
+
+// URLs returns the normalized URL of every relay in the pool
+func (p *relayPool) URLs() []string {
+	p.mu.Lock()
+	urls := make([]string, 0, len(p.relays))
+	for url := range p.relays {
+		urls = append(urls, url)
+	}
+	p.mu.Unlock()
+	sort.Strings(urls)
+	return urls
+}
+
+// SubscriptionCount is how many live subscriptions url carries
+func (p *relayPool) SubscriptionCount(url string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pr, ok := p.relays[normalizeRelayURL(url)]; ok {
+		return len(pr.subs)
+	}
+	return 0
+}
+
+// Close ends the subscriptions on url and drops its connection. It reports
+// whether the pool had the relay.
+func (p *relayPool) Close(url string) bool {
+	key := normalizeRelayURL(url)
+	p.mu.Lock()
+	pr, ok := p.relays[key]
+	if ok {
+		delete(p.relays, key)
+	}
+	p.mu.Unlock()
+	if ok {
+		p.closeRelay(pr)
+	}
+	return ok
+}
+
+// CloseAll drops every connection and returns the URLs that were closed
+func (p *relayPool) CloseAll() []string {
+	p.mu.Lock()
+	closing := p.relays
+	p.relays = make(map[string]*pooledRelay)
+	p.mu.Unlock()
+
+	var urls []string
+	for url, pr := range closing {
+		p.closeRelay(pr)
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// closeRelay closes a connection that has left the pool. Closing the
+// connection ends its subscriptions, their watchers then drop them from subs.
+func (p *relayPool) closeRelay(pr *pooledRelay) {
+	close(pr.stop)
+	<-pr.ready
+	if pr.err != nil {
+		return
+	}
+	pr.relay.Close()
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+var shortenPoolTimers sync.Once
+
+// fastPool returns a fresh pool, with the pool's timers shortened for the
+// rest of the run: goroutines of earlier tests may still read them
+func fastPool(t *testing.T) *relayPool {
+	shortenPoolTimers.Do(func() {
+		relayIdleTimeout, relayRetryMin, relayRetryMax = 100*time.Millisecond, 20*time.Millisecond, 100*time.Millisecond
+	})
+	p := newRelayPool()
+	t.Cleanup(func() { p.CloseAll() })
+	return p
+}
+
+// waitFor polls cond until it holds or the test times out
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func testNote(t *testing.T, content string) nostr.Event {
+	ev := nostr.Event{Kind: 1, CreatedAt: nostr.Now() + 10, Content: content}
+	if err := ev.Sign(nostr.GeneratePrivateKey()); err != nil {
+		t.Fatal(err)
+	}
+	return ev
+}
+
+func TestPoolIdleRelease(t *testing.T) {
+	relay := newFakeRelay(t)
+	p := fastPool(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sub, err := p.Subscribe(ctx, relay.URL, nostr.Filters{{Kinds: []int{1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-sub.EndOfStoredEvents
+	if n := p.SubscriptionCount(relay.URL); n != 1 {
+		t.Fatalf("%d subscriptions counted, want 1", n)
+	}
+
+	// a second subscription while the first is open shares the connection
+	sub2, err := p.Subscribe(ctx, relay.URL, nostr.Filters{{Kinds: []int{0}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-sub2.EndOfStoredEvents
+	if _, accepted, _ := relay.Stats(); accepted != 1 {
+		t.Fatalf("%d connections for two subscriptions, want 1", accepted)
+	}
+
+	cancel()
+	waitFor(t, "the idle connection to be released", func() bool {
+		open, _, _ := relay.Stats()
+		return !p.Has(relay.URL) && open == 0
+	})
+}
+
+func TestPoolKeepsConnectedRelays(t *testing.T) {
+	relay := newFakeRelay(t)
+	p := fastPool(t)
+
+	if _, existed, err := p.Connect(context.Background(), relay.URL); err != nil || existed {
+		t.Fatalf("connect: existed %v, err %v", existed, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := p.Subscribe(ctx, relay.URL, nostr.Filters{{Kinds: []int{1}}}); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	time.Sleep(3 * relayIdleTimeout)
+	if p.Relay(relay.URL) == nil {
+		t.Fatal("a connected relay was released when its subscription ended")
+	}
+}
+
+func TestPoolDurableResubscribe(t *testing.T) {
+	relay := newFakeRelay(t)
+	p := fastPool(t)
+
+	var handled atomic.Int32
+	received := make(chan string, 10)
+	handle := func(r *nostr.Relay, sub *poolSubscription) {
+		handled.Add(1)
+		for ev := range sub.Events {
+			received <- ev.Content
+		}
+	}
+	if err := p.SubscribeDurable(context.Background(), relay.URL, nostr.Filters{{Kinds: []int{1}}}, handle); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the subscription", func() bool { return relay.Subscriptions() == 1 })
+
+	relay.Drop()
+	waitFor(t, "the durable subscription to come back", func() bool {
+		_, accepted, _ := relay.Stats()
+		return handled.Load() == 2 && accepted == 2 && relay.Subscriptions() == 1
+	})
+
+	relay.Publish(testNote(t, "after the reconnect"))
+	select {
+	case got := <-received:
+		if got != "after the reconnect" {
+			t.Fatalf("received %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the resubscribed handler got nothing")
+	}
+}
+
+func TestPoolConnectBeforeWatchKeepsDurable(t *testing.T) {
+	relay := newFakeRelay(t)
+	p := fastPool(t)
+
+	// a configured relay with a durable subscription whose connection
+	// dropped before its watcher ran: Connect is first to notice
+	conn, err := dialRelay(context.Background(), relay.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var handled atomic.Int32
+	pr := newPooledRelay(normalizeRelayURL(relay.URL), true)
+	pr.relay = conn
+	pr.durable = []*durableSubscription{{
+		filters: nostr.Filters{{Kinds: []int{1}}},
+		handle: func(r *nostr.Relay, sub *poolSubscription) {
+			handled.Add(1)
+			for range sub.Events {
+			}
+		},
+	}}
+	close(pr.ready)
+	p.mu.Lock()
+	p.relays[pr.url] = pr
+	p.mu.Unlock()
+	relay.Drop()
+	waitFor(t, "the connection to drop", func() bool { return !conn.IsConnected() })
+
+	if _, _, err := p.Connect(context.Background(), relay.URL); err == nil {
+		t.Fatal("Connect replaced a dropped configured relay instead of reconnecting it")
+	}
+	waitFor(t, "the durable subscription to come back", func() bool {
+		return handled.Load() == 1 && relay.Subscriptions() == 1
+	})
+	if _, existed, err := p.Connect(context.Background(), relay.URL); err != nil || !existed {
+		t.Fatalf("after the reconnect: existed %v, err %v", existed, err)
+	}
+}
+
+func TestPoolSubscriptionLimit(t *testing.T) {
+	relay := newFakeRelay(t)
+	p := fastPool(t)
+	url := normalizeRelayURL(relay.URL)
+	DB.Create(&RelayStatus{Url: url, Status: "waiting", MaxSubscriptions: 2})
+	t.Cleanup(func() { DB.Where("url = ?", url).Delete(&RelayStatus{}) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wg sync.WaitGroup
+	var opened atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := p.Subscribe(ctx, url, nostr.Filters{{Kinds: []int{1}}}); err == nil {
+				opened.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := opened.Load(); n != 2 {
+		t.Fatalf("%d subscriptions opened at once, the limit is 2", n)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"os/signal"
 	"strings"
@@ -12,66 +13,14 @@ import (
 	"syscall"
 	"time"
 
-	"net/http"
-
 	"github.com/jeremyd/crusher17"
 	"github.com/nbd-wtf/go-nostr"
 	"github.com/nbd-wtf/go-nostr/nip19"
 	"gorm.io/gorm"
 )
 
-var nostrSubs []*nostr.Subscription
-var nostrRelays []*nostr.Relay
 var relayAuthLocks sync.Map // map[relay URL] -> chan struct{}
 
-type RelayLimitation struct {
-	AuthRequired bool `json:"auth_required"`
-}
-
-type RelayInfo struct {
-	Name        string          `json:"name"`
-	Description string          `json:"description"`
-	PubKey      string          `json:"pubkey"`
-	Contact     string          `json:"contact"`
-	Supported   []int           `json:"supported_nips"`
-	Software    string          `json:"software"`
-	Version     string          `json:"version"`
-	Limitation  RelayLimitation `json:"limitation"`
-}
-
-func checkRelayRequiresAuth(url string) bool {
-	httpURL := strings.Replace(strings.Replace(url, "ws://", "http://", 1), "wss://", "https://", 1)
-
-	client := &http.Client{
-		Timeout: time.Second * 5,
-	}
-
-	req, err := http.NewRequest("GET", httpURL, nil)
-	if err != nil {
-		TheLog.Printf("Error creating request for relay info: %v\n", err)
-		return false
-	}
-
-	req.Header.Set("Accept", "application/nostr+json")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		TheLog.Printf("Error getting relay info: %v\n", err)
-		return false
-	}
-	defer resp.Body.Close()
-
-	var info RelayInfo
-	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
-		TheLog.Printf("Error decoding relay info from %s (HTTP %d): %v\n", httpURL, resp.StatusCode, err)
-		return false
-	}
-
-	TheLog.Printf("Relay info: %+v\n", info)
-
-	return info.Limitation.AuthRequired
-}
-
 func isHex(s string) bool {
 	dst := make([]byte, hex.DecodedLen(len(s)))
 
@@ -83,20 +32,16 @@ func isHex(s string) bool {
 }
 
 func watchInterrupt() {
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-c
 		TheLog.Println("exiting gracefully")
-		for _, s := range nostrSubs {
-			s.Unsub()
-			s.Close()
-		}
-		for _, r := range nostrRelays {
-			TheLog.Printf("Closing connection to relay: %s\n", r.URL)
-			r.Close()
-			UpdateOrCreateRelayStatus(DB, r.URL, "connection error: app exit")
+		for _, url := range nostrPool.CloseAll() {
+			TheLog.Printf("Closed connection to relay: %s\n", url)
+			UpdateOrCreateRelayStatus(DB, url, "connection error: app exit")
 		}
+		flushRelayHealth()
 		// Clear the global GUI instance
 		TheGui = nil
 		// give other relays time to close
@@ -115,20 +60,109 @@ func UpdateOrCreateRelayStatus(db *gorm.DB, url string, status string) {
 		r = RelayStatus{Url: url, Status: status}
 	}
 	var s RelayStatus
-	err := db.Model(&s).Where("url = ?", url).First(&s).Error
+	// the pool reports normalized urls, the record may hold the url as typed
+	err := db.Model(&s).Where("url IN ?", relayURLVariants(url)).First(&s).Error
 	if err == nil {
 		// Don't update if the relay is marked for deletion
 		if s.Status == "deleting" {
 			return
 		} else {
-			db.Model(&r).Where("url = ?", url).Updates(&r)
+			r.Url = s.Url
+			db.Model(&r).Where("url = ?", s.Url).Updates(&r)
 		}
 	} else {
 		db.Create(&r)
 	}
 }
 
+// scheduleRelayRetry records reconnect attempt number attempt for url, due at next
+func scheduleRelayRetry(db *gorm.DB, url string, attempt int, next time.Time) {
+	err := db.Model(&RelayStatus{}).Where("url IN ?", relayURLVariants(url)).
+		Updates(map[string]interface{}{"retry_count": attempt, "next_retry": next}).Error
+	if err != nil {
+		TheLog.Printf("error scheduling reconnect to %s: %v", url, err)
+	}
+}
+
+// clearRelayRetry forgets the reconnect attempts of a relay that is back
+func clearRelayRetry(db *gorm.DB, url string) {
+	err := db.Model(&RelayStatus{}).Where("url IN ?", relayURLVariants(url)).
+		Updates(map[string]interface{}{"retry_count": 0, "next_retry": time.Time{}}).Error
+	if err != nil {
+		TheLog.Printf("error clearing reconnect state of %s: %v", url, err)
+	}
+}
+
+// relayNeedsRetry is true for relays that are down and not being redialed by
+// the pool already
+func relayNeedsRetry(rs RelayStatus) bool {
+	if rs.Disabled {
+		return false
+	}
+	if rs.Status != "failed initial connection" && !strings.HasPrefix(rs.Status, "connection error") {
+		return false
+	}
+	return !nostrPool.Has(rs.Url)
+}
+
+// relayResumeSince is where subscriptions to url pick up after a reconnect:
+// the last EOSE it sent, or 0 when it never sent one
+func relayResumeSince(url string) nostr.Timestamp {
+	var rs RelayStatus
+	if err := DB.Where("url IN ?", relayURLVariants(url)).First(&rs).Error; err != nil {
+		return 0
+	}
+	if rs.LastEOSE.Unix() <= 0 {
+		return 0
+	}
+	return nostr.Timestamp(rs.LastEOSE.Unix())
+}
+
+// retryRelay is a scheduled reconnect to a relay that is down and not in the
+// pool. It dials with a timeout first, so an unreachable relay can't stall
+// the relay manager, then subscribes like at startup.
+func retryRelay(db *gorm.DB, url string) {
+	ctx, cancel := context.WithTimeout(context.Background(), relayDialTimeout)
+	relay, existed, err := nostrPool.Connect(ctx, url)
+	cancel()
+	if err != nil {
+		TheLog.Printf("reconnect to relay %s failed: %v", url, err)
+		UpdateOrCreateRelayStatus(db, url, "failed initial connection")
+		return
+	}
+	// doRelay finds the connection already there and leaves AUTH to us
+	if !existed && relayPolicy(url).AuthMode == relayAuthAlways {
+		performAuth(relay)
+	}
+	clearRelayRetry(db, url)
+	doRelay(db, context.Background(), url)
+
+	var account Account
+	db.Where("active = ?", true).First(&account)
+	var dmRelays int64
+	db.Model(&DMRelay{}).Where("pubkey_hex = ? AND url IN ?", account.Pubkey, relayURLVariants(url)).Count(&dmRelays)
+	if account.Pubkey != "" && dmRelays > 0 {
+		doDMRelay(db, context.Background(), account, url)
+	}
+}
+
+// relayURLVariants are the spellings a stored relay url may have for url
+func relayURLVariants(url string) []string {
+	variants := []string{url}
+	if n := normalizeRelayURL(url); n != "" && n != url {
+		variants = append(variants, n)
+	}
+	if n := normalizeRelayURL(url); n != "" {
+		variants = append(variants, n+"/")
+	}
+	return variants
+}
+
 func performAuth(relay *nostr.Relay) (bool, error) {
+	if !relayWantsAuth(relay.URL, false) {
+		TheLog.Printf("not authenticating with %s, AUTH is turned off for it", relay.URL)
+		return false, errors.New("AUTH turned off for this relay")
+	}
 	var account Account
 	DB.Where("active = ?", true).First(&account)
 	if account.Pubkey == "" {
@@ -151,6 +185,7 @@ func performAuth(relay *nostr.Relay) (bool, error) {
 
 			return evt.Sign(decryptedKey)
 		})
+		recordRelayAuth(relay.URL, err)
 		if err != nil {
 			TheLog.Printf("Failed to authenticate with relay %s: %v\n", relay.URL, err)
 			return false, err
@@ -171,6 +206,16 @@ func doDMRelays(db *gorm.DB, ctx context.Context) {
 	}
 	pubkey := account.Pubkey
 	var dmRelays []DMRelay
+	db.Where("pubkey_hex = ?", pubkey).Find(&dmRelays)
+	for _, dmr := range dmRelays {
+		doDMRelay(db, ctx, account, dmr.Url)
+	}
+}
+
+// doDMRelay subscribes to our DMs and own lists on one of our DM relays
+func doDMRelay(db *gorm.DB, ctx context.Context, account Account, url string) {
+	pubkey := account.Pubkey
+	liveSince := nostr.Timestamp(time.Now().Add(-giftWrapJitter).Unix())
 	dmFilters := []nostr.Filter{
 		{
 			Kinds:   []int{0},
@@ -188,82 +233,74 @@ func doDMRelays(db *gorm.DB, ctx context.Context) {
 			Authors: []string{pubkey},
 		},
 		{
+			Kinds:   []int{10002},
+			Limit:   1,
+			Authors: []string{pubkey},
+		},
+		{
+			Kinds:   []int{30000},
+			Limit:   100,
+			Authors: []string{pubkey},
+		},
+		{
+			// older gift wraps come from syncGiftWraps
 			Kinds: []int{1059},
 			Limit: 1000,
 			Tags:  nostr.TagMap{"p": []string{pubkey}},
+			Since: &liveSince,
 		},
 	}
-	db.Where("pubkey_hex = ?", pubkey).Find(&dmRelays)
-	for _, dmr := range dmRelays {
-		TheLog.Printf("Connecting to DM relay: %s\n", dmr.Url)
-
-		// check if connection already established
-		var relay *nostr.Relay
-		for _, r := range nostrRelays {
-			if strings.TrimRight(r.URL, "/") == strings.TrimRight(dmr.Url, "/") && r.IsConnected() {
-				relay = r
-			}
-		}
+	dmFilters = append(dmFilters, zapReceiptFilters(pubkey, 200)...)
 
-		preExistingConnection := false
+	TheLog.Printf("Connecting to DM relay: %s\n", url)
 
-		if relay != nil {
-			TheLog.Printf("connection already established to relay: %s\n", dmr.Url)
-			preExistingConnection = true
-			if sub, err := relay.Subscribe(ctx, dmFilters); err != nil {
-				TheLog.Printf("failed to subscribe to relay: %s, %v\n", dmr.Url, err)
-			} else {
-				TheLog.Printf(" from relay: %s for pubkey: %s\n", dmr.Url, pubkey)
-				go func() {
-					processSub(sub, relay, pubkey, false)
-				}()
-			}
-		} else {
-			var err error
-			relay, err = nostr.RelayConnect(ctx, dmr.Url)
-			if err != nil {
-				TheLog.Printf("failed initial connection to relay: %s, %s; skipping relay", dmr.Url, err)
-				UpdateOrCreateRelayStatus(db, dmr.Url, "failed initial connection")
-				return
-			}
-		}
-
-		if !preExistingConnection {
-			nostrRelays = append(nostrRelays, relay)
-		}
+	// the pool reuses the connection if one is already established
+	relay, preExistingConnection, err := nostrPool.Connect(ctx, url)
+	if err != nil {
+		TheLog.Printf("failed initial connection to relay: %s, %s; skipping relay", url, err)
+		UpdateOrCreateRelayStatus(db, url, "failed initial connection")
+		return
+	}
+	if preExistingConnection {
+		TheLog.Printf("connection already established to relay: %s\n", url)
+	}
 
-		// Check if relay requires auth via NIP-11
-		//if !preExistingConnection && account.Privatekey != "" && checkRelayRequiresAuth(dmr.Url) {
-		if !preExistingConnection && account.Privatekey != "" {
-			// Decrypt the private key using the global Password
-			decryptedKey := Decrypt(string(Password), account.Privatekey)
+	// AUTH up front unless the relay's NIP-11 document says it doesn't do NIP-42
+	// or its AUTH policy says otherwise
+	if !preExistingConnection && account.Privatekey != "" && relayWantsAuth(url, true) {
+		// Decrypt the private key using the global Password
+		decryptedKey := Decrypt(string(Password), account.Privatekey)
 
-			// Set up auth with signing function
-			err := relay.Auth(ctx, func(evt *nostr.Event) error {
-				checkChallengeTag := evt.Tags.Find("challenge")
-				if checkChallengeTag[1] == " " {
-					TheLog.Println("SOMETHING WONG!!  no challenge present :)")
-				}
-				return evt.Sign(decryptedKey)
-			})
-			if err != nil {
-				TheLog.Printf("Failed to authenticate with relay %s: %v\n", dmr.Url, err)
-			} else {
-				TheLog.Printf("Successfully authenticated with relay %s\n", dmr.Url)
+		// Set up auth with signing function
+		err := relay.Auth(ctx, func(evt *nostr.Event) error {
+			checkChallengeTag := evt.Tags.Find("challenge")
+			if checkChallengeTag[1] == " " {
+				TheLog.Println("SOMETHING WONG!!  no challenge present :)")
 			}
+			return evt.Sign(decryptedKey)
+		})
+		recordRelayAuth(url, err)
+		if err != nil {
+			TheLog.Printf("Failed to authenticate with relay %s: %v\n", url, err)
+		} else {
+			TheLog.Printf("Successfully authenticated with relay %s\n", url)
 		}
+	}
 
-		// create a subscription and submit to relay
-		if !preExistingConnection {
-			if sub, err := relay.Subscribe(ctx, dmFilters); err != nil {
-				TheLog.Printf("failed to subscribe to relay: %s, %v\n", dmr.Url, err)
-			} else {
-				TheLog.Printf("subscribed to dm feed from relay: %s for pubkey: %s\n", dmr.Url, pubkey)
-				go func() {
-					processSub(sub, relay, pubkey, false)
-				}()
-			}
-		}
+	// create a subscription and submit to relay, it is re-created on reconnect
+	// gift wraps are backdated, so the sync also runs after every reconnect
+	// to pick up those a since filter would miss
+	err = nostrPool.SubscribeDurable(ctx, url, dmFilters, func(relay *nostr.Relay, sub *poolSubscription) {
+		go func() {
+			syncGiftWraps(url, pubkey)
+			backfillGiftWraps(url, pubkey)
+		}()
+		processSub(sub, relay, pubkey, false)
+	})
+	if err != nil {
+		TheLog.Printf("failed to subscribe to relay: %s, %v\n", url, err)
+	} else {
+		TheLog.Printf("subscribed to dm feed from relay: %s for pubkey: %s\n", url, pubkey)
 	}
 }
 
@@ -283,16 +320,28 @@ func doRelay(db *gorm.DB, ctx context.Context, url string) bool {
 	if strings.Contains(fr.Status, "established") {
 		TheLog.Printf("connection already established to relay: %s\n", url)
 	}
+	if fr.Disabled {
+		TheLog.Printf("relay %s is disabled, not connecting", url)
+		UpdateOrCreateRelayStatus(db, url, "disabled")
+		return false
+	}
+	if !fr.hasRole(relayRoleRead) && !fr.hasRole(relayRoleProfiles) && !fr.hasRole(relayRoleZaps) && !fr.hasRole(relayRoleDM) {
+		// publishing connects on its own when it needs the relay
+		TheLog.Printf("relay %s has nothing to subscribe to", url)
+		UpdateOrCreateRelayStatus(db, url, "idle")
+		return true
+	}
 
 	// Connect with auth support
-	relay, err := nostr.RelayConnect(ctx, url)
+	relay, existed, err := nostrPool.Connect(ctx, url)
 	if err != nil {
 		TheLog.Printf("failed initial connection to relay: %s, %s; skipping relay", url, err)
 		UpdateOrCreateRelayStatus(db, url, "failed initial connection")
 		return false
 	}
-
-	nostrRelays = append(nostrRelays, relay)
+	if !existed && fr.AuthMode == relayAuthAlways {
+		performAuth(relay)
+	}
 
 	// Check if relay requires auth via NIP-11
 	/*
@@ -321,13 +370,22 @@ func doRelay(db *gorm.DB, ctx context.Context, url string) bool {
 
 	UpdateOrCreateRelayStatus(db, url, "connection established")
 
+	// a relay with the dm role is read as a DM inbox, unless it already is one
+	// from our DM relay list
+	var listed int64
+	db.Model(&DMRelay{}).Where("pubkey_hex = ? AND url IN ?", pubkey, relayURLVariants(url)).Count(&listed)
+	if fr.hasRole(relayRoleDM) && listed == 0 {
+		doDMRelay(db, ctx, account, url)
+	}
+
 	// what do we need for this pubkey for WoT:
 
 	// the follow list (hop1)
 	// the follow list of each follow (hop2)
 	// hop3?
 
-	hop1Filters := []nostr.Filter{
+	var hop1Filters []nostr.Filter
+	ownFilters := []nostr.Filter{
 		{
 			Kinds:   []int{0},
 			Limit:   1,
@@ -343,10 +401,40 @@ func doRelay(db *gorm.DB, ctx context.Context, url string) bool {
 			Limit:   1,
 			Authors: []string{pubkey},
 		},
+		{
+			Kinds:   []int{10002},
+			Limit:   1,
+			Authors: []string{pubkey},
+		},
+		{
+			Kinds:   []int{30000},
+			Limit:   100,
+			Authors: []string{pubkey},
+		},
+	}
+	if fr.hasRole(relayRoleRead) {
+		hop1Filters = append(hop1Filters, ownFilters...)
+	}
+	if fr.hasRole(relayRoleZaps) {
+		hop1Filters = append(hop1Filters, zapReceiptFilters(pubkey, 200)...)
+	}
+
+	// subscriptions are re-created, from the last EOSE on, after a reconnect
+	handle := func(relay *nostr.Relay, sub *poolSubscription) {
+		processSub(sub, relay, pubkey, false)
 	}
 
 	// create a subscription and submit to relay
-	sub, _ := relay.Subscribe(ctx, hop1Filters)
+	if len(hop1Filters) > 0 {
+		if err := nostrPool.SubscribeDurable(ctx, url, hop1Filters, handle); err != nil {
+			TheLog.Printf("failed to subscribe to relay: %s, %v\n", url, err)
+		}
+	}
+
+	// the follows' profiles are for profile index relays
+	if !fr.hasRole(relayRoleProfiles) {
+		return true
+	}
 
 	// subscribe to follows for each follow
 	person := Metadata{
@@ -389,6 +477,7 @@ func doRelay(db *gorm.DB, ctx context.Context, url string) bool {
 
 	filterTimestamp := nostr.Timestamp(since.Unix())
 
+	// hop2 contact lists (kind 3) feed the web-of-trust scores
 	// BATCH filters into chunks of 1000 per filter.
 	var hop2Filters []nostr.Filter
 
@@ -405,12 +494,7 @@ func doRelay(db *gorm.DB, ctx context.Context, url string) bool {
 					authorPubkeys = append(authorPubkeys, a.PubkeyHex)
 				}
 
-				hop2Filters = append(hop2Filters, nostr.Filter{
-					Kinds:   []int{0, 10050},
-					Limit:   1000,
-					Authors: authorPubkeys,
-					Since:   &filterTimestamp,
-				})
+				hop2Filters = append(hop2Filters, hop2FiltersFor(authorPubkeys, filterTimestamp)...)
 				TheLog.Printf("adding chunk subscription for %d:%d", begin, end)
 				lastCount = counter
 			}
@@ -428,40 +512,45 @@ func doRelay(db *gorm.DB, ctx context.Context, url string) bool {
 
 			TheLog.Printf("adding leftover chunk subscription for %d:%d", lastCount, end)
 
-			hop2Filters = append(hop2Filters, nostr.Filter{
-				Kinds:   []int{0, 10050},
-				Limit:   1000,
-				Authors: authorPubkeys,
-				Since:   &filterTimestamp,
-			})
+			hop2Filters = append(hop2Filters, hop2FiltersFor(authorPubkeys, filterTimestamp)...)
 		}
 	} else {
 		var authorPubkeys []string
 		for _, a := range thisHopFollows {
 			authorPubkeys = append(authorPubkeys, a.PubkeyHex)
 		}
-		hop2Filters = append(hop2Filters, nostr.Filter{
-			Kinds:   []int{0, 10050},
-			Limit:   1000,
-			Authors: authorPubkeys,
-			Since:   &filterTimestamp,
-		})
+		hop2Filters = append(hop2Filters, hop2FiltersFor(authorPubkeys, filterTimestamp)...)
 	}
 
-	hop2Sub, _ := relay.Subscribe(ctx, hop2Filters)
-
-	go func() {
-		processSub(sub, relay, pubkey, false)
-	}()
+	if err := nostrPool.SubscribeDurable(ctx, url, hop2Filters, handle); err != nil {
+		TheLog.Printf("failed to subscribe to relay: %s, %v\n", url, err)
+	}
 
-	go func() {
-		processSub(hop2Sub, relay, pubkey, false)
-	}()
+	go syncProfiles(url, account)
 
 	return true
 }
 
-func processSub(sub *nostr.Subscription, relay *nostr.Relay, pubkey string, authAttempted bool) {
+// hop2FiltersFor asks for the profiles and relay lists of authors changed
+// since the last EOSE, and for all their contact lists: the web-of-trust
+// needs every hop-2 follow list, not only the recently updated ones
+func hop2FiltersFor(authors []string, since nostr.Timestamp) []nostr.Filter {
+	return []nostr.Filter{
+		{
+			Kinds:   []int{0, 10002, 10050},
+			Limit:   1000,
+			Authors: authors,
+			Since:   &since,
+		},
+		{
+			Kinds:   []int{3},
+			Limit:   len(authors),
+			Authors: authors,
+		},
+	}
+}
+
+func processSub(sub *poolSubscription, relay *nostr.Relay, pubkey string, authAttempted bool) {
 
 	go func() {
 		<-sub.EndOfStoredEvents
@@ -472,6 +561,7 @@ func processSub(sub *nostr.Subscription, relay *nostr.Relay, pubkey string, auth
 	go func() {
 		reason := <-sub.ClosedReason
 		TheLog.Printf("got subscription CLOSED reason %s\n", reason)
+		recordRelayClosed(relay.URL, reason)
 		if strings.Contains(reason, "auth-required") {
 			if authAttempted {
 				TheLog.Printf("relay %s denied REQ even after auth, not a member; giving up", relay.URL)
@@ -483,7 +573,7 @@ func processSub(sub *nostr.Subscription, relay *nostr.Relay, pubkey string, auth
 				TheLog.Printf("auth already in progress for %s, waiting", relay.URL)
 				<-actual.(chan struct{})
 				ctx := context.Background()
-				newSub, _ := relay.Subscribe(ctx, sub.Filters)
+				newSub, _ := nostrPool.Subscribe(ctx, relay.URL, sub.Filters)
 				processSub(newSub, relay, pubkey, true)
 				return
 			}
@@ -493,7 +583,7 @@ func processSub(sub *nostr.Subscription, relay *nostr.Relay, pubkey string, auth
 			if success {
 				TheLog.Printf("successfully authenticated to %s, re-doing subscription", relay.URL)
 				ctx := context.Background()
-				newSub, _ := relay.Subscribe(ctx, sub.Filters)
+				newSub, _ := nostrPool.Subscribe(ctx, relay.URL, sub.Filters)
 				processSub(newSub, relay, pubkey, true)
 			} else {
 				TheLog.Printf("Error while authing: %s", err)
@@ -502,236 +592,488 @@ func processSub(sub *nostr.Subscription, relay *nostr.Relay, pubkey string, auth
 	}()
 
 	if sub != nil {
-		nostrSubs = append(nostrSubs, sub)
 		for ev := range sub.Events {
-			if ev.Kind == 0 {
-				// Metadata
-				m := Metadata{}
-				err := json.Unmarshal([]byte(ev.Content), &m)
-				unmarshalSuccess := false
-				if err != nil {
-					TheLog.Printf("%s: %v", err, ev.Content)
-					m.RawJsonContent = ev.Content
+			recordRelayEvent(relay.URL, ev.Kind)
+			processEvent(ev, relay.URL)
+		}
+	}
+
+}
+
+// processEvent stores an event received from relayURL
+func processEvent(ev *nostr.Event, relayURL string) {
+	// synced kinds are only recorded once stored, so a sync fetches failed ones again
+	if ev.Kind == 0 {
+		// Metadata
+		m := Metadata{}
+		err := json.Unmarshal([]byte(ev.Content), &m)
+		unmarshalSuccess := false
+		if err != nil {
+			TheLog.Printf("%s: %v", err, ev.Content)
+			m.RawJsonContent = ev.Content
+		} else {
+			unmarshalSuccess = true
+		}
+		m.PubkeyHex = ev.PubKey
+		npub, errEncode := nip19.EncodePublicKey(ev.PubKey)
+		if errEncode == nil {
+			m.PubkeyNpub = npub
+		}
+		m.MetadataUpdatedAt = ev.CreatedAt.Time()
+		m.ContactsUpdatedAt = time.Unix(0, 0)
+		if len(m.Picture) > 65535 {
+			//TheLog.Println("too big a picture for profile, skipping" + ev.PubKey)
+			m.Picture = ""
+			//continue
+		}
+		// check timestamps
+		var checkMeta Metadata
+		notFoundErr := DB.First(&checkMeta, "pubkey_hex = ?", m.PubkeyHex).Error
+		if notFoundErr != nil {
+			err := DB.Save(&m).Error
+			if err != nil {
+				TheLog.Printf("Error saving metadata was: %s", err)
+				return
+			}
+			recordSyncedEvent(ev)
+			TheLog.Printf("Created metadata for %s, %s\n", m.Name, m.Nip05)
+		} else {
+			if checkMeta.MetadataUpdatedAt.After(ev.CreatedAt.Time()) || checkMeta.MetadataUpdatedAt.Equal(ev.CreatedAt.Time()) {
+				//TheLog.Println("skipping old metadata for " + ev.PubKey)
+				recordSyncedEvent(ev)
+				return
+			} else {
+				rowsUpdated := DB.Model(Metadata{}).Where("pubkey_hex = ?", m.PubkeyHex).Updates(&m).RowsAffected
+				if rowsUpdated > 0 {
+					recordSyncedEvent(ev)
+					TheLog.Printf("Updated metadata for %s, %s\n", m.Name, m.Nip05)
 				} else {
-					unmarshalSuccess = true
+					//
+					// here we need go store the record anyway, with a pubkey, and the 'rawjson'
+					TheLog.Printf("UNCOOL NESTED JSON FOR METADATA DETECTED, falling back to RAW json %v, unmarshalsuccess was: %v", m, unmarshalSuccess)
 				}
-				m.PubkeyHex = ev.PubKey
-				npub, errEncode := nip19.EncodePublicKey(ev.PubKey)
-				if errEncode == nil {
-					m.PubkeyNpub = npub
-				}
-				m.MetadataUpdatedAt = ev.CreatedAt.Time()
-				m.ContactsUpdatedAt = time.Unix(0, 0)
-				if len(m.Picture) > 65535 {
-					//TheLog.Println("too big a picture for profile, skipping" + ev.PubKey)
-					m.Picture = ""
-					//continue
+			}
+		}
+	} else if ev.Kind == 10050 {
+		var person Metadata
+		notFoundError := DB.First(&person, "pubkey_hex = ?", ev.PubKey).Error
+		if notFoundError != nil {
+			//TheLog.Printf("Creating blank metadata for %s\n", ev.PubKey)
+			person = Metadata{
+				PubkeyHex: ev.PubKey,
+				// set time to january 1st 1970
+				MetadataUpdatedAt: time.Unix(0, 0),
+				ContactsUpdatedAt: time.Unix(0, 0),
+			}
+			DB.Create(&person)
+		}
+		relayTags := []string{"relay"}
+		allRelayTags := ev.Tags.GetAll(relayTags)
+		for _, relayTag := range allRelayTags {
+			r := DMRelay{}
+			// First check if this relay URL exists for this pubkey
+			var existingRelay DMRelay
+			err := DB.Where("pubkey_hex = ? AND url = ?", ev.PubKey, relayTag[1]).First(&existingRelay).Error
+			if err != nil {
+				// URL doesn't exist, create new entry
+				r = DMRelay{
+					PubkeyHex: ev.PubKey,
+					Url:       relayTag[1],
+					CreatedAt: time.Now(),
+					UpdatedAt: time.Now(),
 				}
-				// check timestamps
-				var checkMeta Metadata
-				notFoundErr := DB.First(&checkMeta, "pubkey_hex = ?", m.PubkeyHex).Error
-				if notFoundErr != nil {
-					err := DB.Save(&m).Error
-					if err != nil {
-						TheLog.Printf("Error saving metadata was: %s", err)
-					}
-					TheLog.Printf("Created metadata for %s, %s\n", m.Name, m.Nip05)
-				} else {
-					if checkMeta.MetadataUpdatedAt.After(ev.CreatedAt.Time()) || checkMeta.MetadataUpdatedAt.Equal(ev.CreatedAt.Time()) {
-						//TheLog.Println("skipping old metadata for " + ev.PubKey)
-						continue
-					} else {
-						rowsUpdated := DB.Model(Metadata{}).Where("pubkey_hex = ?", m.PubkeyHex).Updates(&m).RowsAffected
-						if rowsUpdated > 0 {
-							TheLog.Printf("Updated metadata for %s, %s\n", m.Name, m.Nip05)
-						} else {
-							//
-							// here we need go store the record anyway, with a pubkey, and the 'rawjson'
-							TheLog.Printf("UNCOOL NESTED JSON FOR METADATA DETECTED, falling back to RAW json %v, unmarshalsuccess was: %v", m, unmarshalSuccess)
-						}
-					}
+				DB.Create(&r)
+			}
+		}
+		// Remove URLs that are no longer in the tags
+		var existingUrls []string
+		for _, tag := range allRelayTags {
+			existingUrls = append(existingUrls, tag[1])
+		}
+		DB.Where("pubkey_hex = ? AND url NOT IN ?", ev.PubKey, existingUrls).Delete(&DMRelay{})
+	} else if ev.Kind == 3 {
+
+		// Contact List
+		pTags := []string{"p"}
+		allPTags := ev.Tags.GetAll(pTags)
+		var person Metadata
+		notFoundError := DB.First(&person, "pubkey_hex = ?", ev.PubKey).Error
+		if notFoundError != nil {
+			//TheLog.Printf("Creating blank metadata for %s\n", ev.PubKey)
+			person = Metadata{
+				PubkeyHex:    ev.PubKey,
+				TotalFollows: len(allPTags),
+				// set time to january 1st 1970
+				MetadataUpdatedAt: time.Unix(0, 0),
+				ContactsUpdatedAt: ev.CreatedAt.Time(),
+			}
+			DB.Create(&person)
+		} else {
+			if person.ContactsUpdatedAt.After(ev.CreatedAt.Time()) {
+				// double check the timestamp for this follow list, don't update if older than most recent
+				TheLog.Printf("skipping old contact list for %s", ev.PubKey)
+				return
+			} else {
+				DB.Model(&person).Omit("updated_at").Update("total_follows", len(allPTags))
+				DB.Model(&person).Omit("updated_at").Update("contacts_updated_at", ev.CreatedAt.Time())
+				//TheLog.Printf("updating (%d) follows for %s: %s\n", len(allPTags), person.Name, person.PubkeyHex)
+			}
+		}
+
+		// purge followers that have been 'unfollowed'
+		var oldFollows []Metadata
+		DB.Model(&person).Association("Follows").Find(&oldFollows)
+		for _, oldFollow := range oldFollows {
+			found := false
+			for _, n := range allPTags {
+				if len(n) >= 2 && n[1] == oldFollow.PubkeyHex {
+					found = true
 				}
-			} else if ev.Kind == 10050 {
-				var person Metadata
-				notFoundError := DB.First(&person, "pubkey_hex = ?", ev.PubKey).Error
-				if notFoundError != nil {
-					//TheLog.Printf("Creating blank metadata for %s\n", ev.PubKey)
-					person = Metadata{
-						PubkeyHex: ev.PubKey,
-						// set time to january 1st 1970
-						MetadataUpdatedAt: time.Unix(0, 0),
+			}
+			if !found {
+				DB.Exec("delete from metadata_follows where metadata_pubkey_hex = ? and follow_pubkey_hex = ?", person.PubkeyHex, oldFollow.PubkeyHex)
+			}
+		}
+
+		// Add follows
+		for _, followPerson := range person.Follows {
+			DB.Exec("INSERT OR IGNORE INTO metadata_follows (metadata_pubkey_hex, follow_pubkey_hex) VALUES (?, ?)", person.PubkeyHex, followPerson.PubkeyHex)
+		}
+
+		for _, c := range allPTags {
+			// if the pubkey fails the sanitization (is a hex value) skip it
+
+			if len(c) < 2 || !isHex(c[1]) {
+				TheLog.Printf("skipping invalid pubkey from follow list: %d, %s ", len(c), c[1])
+				continue
+			}
+			var followPerson Metadata
+			notFoundFollow := DB.First(&followPerson, "pubkey_hex = ?", c[1]).Error
+
+			if notFoundFollow != nil {
+				// follow user not found, need to create it
+				var newUser Metadata
+				// follow user recommend server suggestion if it exists
+				if len(c) >= 3 && c[2] != "" {
+					newUser = Metadata{
+						PubkeyHex:         c[1],
 						ContactsUpdatedAt: time.Unix(0, 0),
-					}
-					DB.Create(&person)
-				}
-				relayTags := []string{"relay"}
-				allRelayTags := ev.Tags.GetAll(relayTags)
-				for _, relayTag := range allRelayTags {
-					r := DMRelay{}
-					// First check if this relay URL exists for this pubkey
-					var existingRelay DMRelay
-					err := DB.Where("pubkey_hex = ? AND url = ?", ev.PubKey, relayTag[1]).First(&existingRelay).Error
-					if err != nil {
-						// URL doesn't exist, create new entry
-						r = DMRelay{
-							PubkeyHex: ev.PubKey,
-							Url:       relayTag[1],
-							CreatedAt: time.Now(),
-							UpdatedAt: time.Now(),
-						}
-						DB.Create(&r)
-					}
-				}
-				// Remove URLs that are no longer in the tags
-				var existingUrls []string
-				for _, tag := range allRelayTags {
-					existingUrls = append(existingUrls, tag[1])
-				}
-				DB.Where("pubkey_hex = ? AND url NOT IN ?", ev.PubKey, existingUrls).Delete(&DMRelay{})
-			} else if ev.Kind == 3 {
-
-				// Contact List
-				pTags := []string{"p"}
-				allPTags := ev.Tags.GetAll(pTags)
-				var person Metadata
-				notFoundError := DB.First(&person, "pubkey_hex = ?", ev.PubKey).Error
-				if notFoundError != nil {
-					//TheLog.Printf("Creating blank metadata for %s\n", ev.PubKey)
-					person = Metadata{
-						PubkeyHex:    ev.PubKey,
-						TotalFollows: len(allPTags),
-						// set time to january 1st 1970
 						MetadataUpdatedAt: time.Unix(0, 0),
-						ContactsUpdatedAt: ev.CreatedAt.Time(),
 					}
-					DB.Create(&person)
 				} else {
-					if person.ContactsUpdatedAt.After(ev.CreatedAt.Time()) {
-						// double check the timestamp for this follow list, don't update if older than most recent
-						TheLog.Printf("skipping old contact list for " + ev.PubKey)
-						continue
-					} else {
-						DB.Model(&person).Omit("updated_at").Update("total_follows", len(allPTags))
-						DB.Model(&person).Omit("updated_at").Update("contacts_updated_at", ev.CreatedAt.Time())
-						//TheLog.Printf("updating (%d) follows for %s: %s\n", len(allPTags), person.Name, person.PubkeyHex)
-					}
+					newUser = Metadata{PubkeyHex: c[1], ContactsUpdatedAt: time.Unix(0, 0), MetadataUpdatedAt: time.Unix(0, 0)}
 				}
-
-				// purge followers that have been 'unfollowed'
-				var oldFollows []Metadata
-				DB.Model(&person).Association("Follows").Find(&oldFollows)
-				for _, oldFollow := range oldFollows {
-					found := false
-					for _, n := range allPTags {
-						if len(n) >= 2 && n[1] == oldFollow.PubkeyHex {
-							found = true
-						}
-					}
-					if !found {
-						DB.Exec("delete from metadata_follows where metadata_pubkey_hex = ? and follow_pubkey_hex = ?", person.PubkeyHex, oldFollow.PubkeyHex)
-					}
+				createNewErr := DB.Omit("Follows").Create(&newUser).Error
+				if createNewErr != nil {
+					TheLog.Println("Error creating user for follow: ", createNewErr)
 				}
+				// use gorm insert statement to update the join table
+				DB.Exec("INSERT OR IGNORE INTO metadata_follows (metadata_pubkey_hex, follow_pubkey_hex) VALUES (?, ?)", person.PubkeyHex, newUser.PubkeyHex)
+			} else {
+				// use gorm insert statement to update the join table
+				DB.Exec("INSERT OR IGNORE INTO metadata_follows (metadata_pubkey_hex, follow_pubkey_hex) VALUES (?, ?)", person.PubkeyHex, followPerson.PubkeyHex)
+			}
+		}
+	} else if ev.Kind == 10002 {
+		// NIP-65 relay list, used to route fetches to the author's outbox relays
+		saveRelayListEvent(ev, ev.PubKey)
+	} else if ev.Kind == 9735 {
+		go processZapReceipt(ev)
+	} else if ev.Kind == 30000 {
+		// NIP-51 follow sets (contact groups)
+		saveFollowSetEvent(ev)
+	} else if ev.Kind == 1059 {
+		// Message
+		m := ChatMessage{}
+		err := DB.First(&m, "event_id = ?", ev.ID).Error
+		if err != nil {
+			// Get active account for private key
+			var account Account
+			DB.Where("active = ?", true).First(&account)
 
-				// Add follows
-				for _, followPerson := range person.Follows {
-					DB.Exec("INSERT OR IGNORE INTO metadata_follows (metadata_pubkey_hex, follow_pubkey_hex) VALUES (?, ?)", person.PubkeyHex, followPerson.PubkeyHex)
-				}
+			// Decrypt the message using crusher17
+			sk := Decrypt(string(Password), account.Privatekey)
 
-				for _, c := range allPTags {
-					// if the pubkey fails the sanitization (is a hex value) skip it
+			decryptedContent, err := crusher17.ReceiveEvent(sk, ev)
+			if err != nil {
+				TheLog.Printf("Error decrypting message: %v", err)
+				return
+			}
 
-					if len(c) < 2 || !isHex(c[1]) {
-						TheLog.Printf("skipping invalid pubkey from follow list: %d, %s ", len(c), c[1])
-						continue
-					}
-					var followPerson Metadata
-					notFoundFollow := DB.First(&followPerson, "pubkey_hex = ?", c[1]).Error
-
-					if notFoundFollow != nil {
-						// follow user not found, need to create it
-						var newUser Metadata
-						// follow user recommend server suggestion if it exists
-						if len(c) >= 3 && c[2] != "" {
-							newUser = Metadata{
-								PubkeyHex:         c[1],
-								ContactsUpdatedAt: time.Unix(0, 0),
-								MetadataUpdatedAt: time.Unix(0, 0),
-							}
-						} else {
-							newUser = Metadata{PubkeyHex: c[1], ContactsUpdatedAt: time.Unix(0, 0), MetadataUpdatedAt: time.Unix(0, 0)}
-						}
-						createNewErr := DB.Omit("Follows").Create(&newUser).Error
-						if createNewErr != nil {
-							TheLog.Println("Error creating user for follow: ", createNewErr)
-						}
-						// use gorm insert statement to update the join table
-						DB.Exec("INSERT OR IGNORE INTO metadata_follows (metadata_pubkey_hex, follow_pubkey_hex) VALUES (?, ?)", person.PubkeyHex, newUser.PubkeyHex)
-					} else {
-						// use gorm insert statement to update the join table
-						DB.Exec("INSERT OR IGNORE INTO metadata_follows (metadata_pubkey_hex, follow_pubkey_hex) VALUES (?, ?)", person.PubkeyHex, followPerson.PubkeyHex)
-					}
+			var k14 nostr.Event
+			err2 := json.Unmarshal([]byte(decryptedContent), &k14)
+			if err2 != nil {
+				TheLog.Printf("Error unmarshalling k14 event: %v", err2)
+				return
+			}
+
+			// Create new chat message
+			var useThisPtag string
+			for _, tag := range k14.Tags.GetAll([]string{"p"}) {
+				if tag.Value() != k14.PubKey {
+					useThisPtag = tag.Value()
+					break
 				}
-			} else if ev.Kind == 1059 {
-				// Message
-				m := ChatMessage{}
-				err := DB.First(&m, "event_id = ?", ev.ID).Error
-				if err != nil {
-					// Get active account for private key
-					var account Account
-					DB.Where("active = ?", true).First(&account)
+			}
 
-					// Decrypt the message using crusher17
-					sk := Decrypt(string(Password), account.Privatekey)
+			if messageCleared(account.ID, k14.PubKey, time.Unix(int64(k14.CreatedAt), 0)) {
+				// the user deleted this from their requests inbox
+				recordSyncedEvent(ev)
+				return
+			}
 
-					decryptedContent, err := crusher17.ReceiveEvent(sk, ev)
-					if err != nil {
-						TheLog.Printf("Error decrypting message: %v", err)
-						continue
-					}
+			m = ChatMessage{
+				FromPubkey:        k14.PubKey,
+				ToPubkey:          useThisPtag,
+				Content:           k14.Content,
+				EventId:           ev.ID,
+				Timestamp:         time.Unix(int64(k14.CreatedAt), 0),
+				ReceivedFromRelay: relayURL,
+				AccountID:         account.ID,
+			}
 
-					var k14 nostr.Event
-					err2 := json.Unmarshal([]byte(decryptedContent), &k14)
-					if err2 != nil {
-						TheLog.Printf("Error unmarshalling k14 event: %v", err2)
-						continue
-					}
+			TheLog.Printf("Creating chat message: %+v", m)
+			if err := DB.Create(&m).Error; err != nil {
+				TheLog.Printf("Error creating chat message: %v", err)
+			} else {
+				recordSyncedEvent(ev)
+				TheLog.Printf("Successfully created chat message from %s", m.FromPubkey)
 
-					// Create new chat message
-					var useThisPtag string
-					for _, tag := range k14.Tags.GetAll([]string{"p"}) {
-						if tag.Value() != k14.PubKey {
-							useThisPtag = tag.Value()
-							break
-						}
-					}
+				// Ensure we refresh the UI after saving the message
+				// Use a separate goroutine to avoid blocking the event processing
+				go func() {
+					// Give a moment for the DB transaction to complete
+					time.Sleep(100 * time.Millisecond)
+					refreshUIAfterNewMessage()
+				}()
+			}
+		} else {
+			recordSyncedEvent(ev)
+		}
+	}
+}
 
-					m = ChatMessage{
-						FromPubkey:        k14.PubKey,
-						ToPubkey:          useThisPtag,
-						Content:           k14.Content,
-						EventId:           ev.ID,
-						Timestamp:         time.Unix(int64(k14.CreatedAt), 0),
-						ReceivedFromRelay: relay.URL,
-						AccountID:         account.ID,
-					}
+// connectedRelay returns the pool's open connection to url, or nil
+func connectedRelay(url string) *nostr.Relay {
+	return nostrPool.Relay(url)
+}
 
-					TheLog.Printf("Creating chat message: %+v", m)
-					if err := DB.Create(&m).Error; err != nil {
-						TheLog.Printf("Error creating chat message: %v", err)
-					} else {
-						TheLog.Printf("Successfully created chat message from %s", m.FromPubkey)
-
-						// Ensure we refresh the UI after saving the message
-						// Use a separate goroutine to avoid blocking the event processing
-						go func() {
-							// Give a moment for the DB transaction to complete
-							time.Sleep(100 * time.Millisecond)
-							refreshUIAfterNewMessage()
-						}()
-					}
+// uniqueRelayURLs normalizes relay urls and drops duplicates and invalid ones
+func uniqueRelayURLs(urls []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, url := range urls {
+		key := normalizeRelayURL(url)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, key)
+	}
+	return unique
+}
+
+// writeRelayURLs returns the account's NIP-65 write relays, falling back to
+// the configured relays with the write role when no relay list is known
+func writeRelayURLs(pubkey string) []string {
+	var urls []string
+	var relayList []RelayList
+	DB.Where("pubkey_hex = ? AND write = ?", pubkey, true).Find(&relayList)
+	for _, r := range relayList {
+		urls = append(urls, r.Url)
+	}
+	if len(urls) == 0 {
+		urls = configuredRelayURLs(relayRoleWrite)
+	}
+	return urls
+}
+
+// fetchNewestEvent asks each relay for events matching filter and returns the
+// newest one, or nil if no relay had anything
+func fetchNewestEvent(urls []string, filter nostr.Filter) *nostr.Event {
+	var newest *nostr.Event
+	for _, ev := range fetchEvents(urls, filter) {
+		if newest == nil || ev.CreatedAt > newest.CreatedAt {
+			newest = ev
+		}
+	}
+	return newest
+}
+
+// fetchEvents asks each relay for events matching filter and returns them
+// all, deduplicated by id
+func fetchEvents(urls []string, filter nostr.Filter) []*nostr.Event {
+	seen := make(map[string]*nostr.Event)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, url := range urls {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			relay := connectedRelay(url)
+			if relay == nil {
+				var err error
+				relay, err = dialRelay(ctx, url)
+				if err != nil {
+					TheLog.Printf("error connecting to relay %s: %v", url, err)
+					return
 				}
+				defer relay.Close()
+			}
+			events, err := relay.QuerySync(ctx, filter)
+			if err != nil {
+				TheLog.Printf("error querying relay %s: %v", url, err)
+				return
+			}
+			mu.Lock()
+			for _, ev := range events {
+				seen[ev.ID] = ev
 			}
+			mu.Unlock()
+		}(url)
+	}
+	wg.Wait()
+	events := make([]*nostr.Event, 0, len(seen))
+	for _, ev := range seen {
+		events = append(events, ev)
+	}
+	return events
+}
+
+// publishToRelays sends ev to each url, reusing open connections and doing
+// AUTH when a relay asks for it. Returns how many relays accepted the event.
+func publishToRelays(urls []string, ev nostr.Event) int {
+	ok := 0
+	for _, url := range urls {
+		if !relayHasRole(url, relayRoleWrite) {
+			TheLog.Printf("not publishing kind %d to %s, it isn't a write relay", ev.Kind, url)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		relay := connectedRelay(url)
+		if relay == nil {
+			var err error
+			relay, err = dialRelay(ctx, url)
+			if err != nil {
+				TheLog.Printf("Failed to connect to relay %s: %v", url, err)
+				cancel()
+				continue
+			}
+			defer relay.Close()
+		}
+		err := relay.Publish(ctx, ev)
+		if err != nil && strings.Contains(err.Error(), "auth-required") {
+			TheLog.Printf("Relay %s is requesting that we authenticate to publish", url)
+			performAuth(relay)
+			err = relay.Publish(ctx, ev)
+		}
+		recordRelayPublish(url, err)
+		if err != nil {
+			TheLog.Printf("Error publishing kind %d to relay %s: %v", ev.Kind, url, err)
+		} else {
+			TheLog.Printf("Published kind %d to relay %s, eventID=%s", ev.Kind, url, ev.ID)
+			ok++
+		}
+		cancel()
+	}
+	return ok
+}
+
+// saveRelayListEvent replaces the stored NIP-65 relay list of pubkey with the
+// r tags of a kind 10002. It returns how many relays were saved, and stale
+// when we already have a newer list.
+func saveRelayListEvent(evt *nostr.Event, pubkey string) (int, bool) {
+	var newest RelayList
+	if err := DB.Where("pubkey_hex = ?", pubkey).Order("event_created_at desc").First(&newest).Error; err == nil {
+		if newest.EventCreatedAt.After(evt.CreatedAt.Time()) {
+			return 0, true
+		}
+	}
+
+	// Clear existing relay list for this pubkey
+	DB.Where("pubkey_hex = ?", pubkey).Delete(&RelayList{})
+
+	// According to NIP-65, relay lists are stored in "r" tags
+	// Format: ["r", "wss://relay.example.com", "read" or "write" (optional)]
+	saved := 0
+	for _, tag := range evt.Tags {
+		if len(tag) < 2 || tag[0] != "r" {
+			continue
+		}
+		read, write := true, true
+		// Check if there's a read/write marker
+		if len(tag) >= 3 {
+			if tag[2] == "read" {
+				write = false
+			} else if tag[2] == "write" {
+				read = false
+			}
+		}
+
+		relay := RelayList{
+			PubkeyHex:      pubkey,
+			Url:            tag[1],
+			Read:           read,
+			Write:          write,
+			EventCreatedAt: evt.CreatedAt.Time(),
 		}
+		if err := DB.Create(&relay).Error; err != nil {
+			TheLog.Printf("Error saving relay to database: %v", err)
+			continue
+		}
+		// Create leaves out false for columns that default to true
+		if !read || !write {
+			DB.Model(&relay).Updates(map[string]interface{}{"read": read, "write": write})
+		}
+		saved++
 	}
+	TheLog.Printf("Saved %d relays from the relay list of %s", saved, pubkey)
+	return saved, false
+}
+
+// fetchUntilEOSE stores what one relay has for filters, over a short-lived
+// subscription that ends at EOSE or after timeout. It returns how many
+// matching events arrived, and an error unless the relay got to EOSE: on
+// timeout, CLOSED, or the connection going away.
+func fetchUntilEOSE(url string, filters nostr.Filters, timeout time.Duration) (int, error) {
+	return fetchUntilEOSEEach(url, filters, timeout, nil)
+}
 
+// fetchUntilEOSEEach is fetchUntilEOSE that also shows each stored event to each
+func fetchUntilEOSEEach(url string, filters nostr.Filters, timeout time.Duration, each func(*nostr.Event)) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	sub, err := nostrPool.Subscribe(ctx, url, filters)
+	if err != nil {
+		return 0, err
+	}
+
+	received := 0
+	for {
+		select {
+		case ev, ok := <-sub.Events:
+			if !ok {
+				return received, fmt.Errorf("subscription to %s ended before EOSE", url)
+			}
+			// relays that ignore part of the filter don't get to write other events
+			if !filters.Match(ev) {
+				continue
+			}
+			recordRelayEvent(url, ev.Kind)
+			processEvent(ev, url)
+			if each != nil {
+				each(ev)
+			}
+			received++
+		case <-sub.EndOfStoredEvents:
+			return received, nil
+		case reason := <-sub.ClosedReason:
+			return received, fmt.Errorf("%s closed the subscription: %s", url, reason)
+		case <-ctx.Done():
+			return received, fmt.Errorf("no EOSE from %s within %s: %w", url, timeout, ctx.Err())
+		}
+	}
 }
@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestRetryRelayAuthsWhenAlways(t *testing.T) {
+	relay := newFakeRelay(t)
+	relay.requireAuth = true
+	url := normalizeRelayURL(relay.URL)
+	testAccount(t)
+	// a relay only written to, so doRelay leaves it idle after connecting
+	DB.Create(&RelayStatus{Url: url, Status: "failed initial connection", Roles: relayRoleWrite, AuthMode: relayAuthAlways})
+	t.Cleanup(func() {
+		DB.Where("url = ?", url).Delete(&RelayStatus{})
+		nostrPool.Close(url)
+	})
+
+	retryRelay(DB, url)
+	if relay.Auths() != 1 {
+		t.Fatalf("%d AUTH messages after a retry, want 1", relay.Auths())
+	}
+}
@@ -100,25 +100,16 @@ func activateConfig(
 	DB.Model(&acct).Where("pubkey = ?", accounts[cy].Pubkey).Update("active", true)
 	DB.Model(&acct).Where("pubkey != ?", accounts[cy].Pubkey).Update("active", false)
 
-	// Close existing subscriptions
-	TheLog.Println("Closing existing subscriptions before switching keys")
-	for _, s := range nostrSubs {
-		s.Unsub()
-		s.Close()
+	// Close existing subscriptions and relays
+	TheLog.Println("Closing existing relays and subscriptions before switching keys")
+	for _, url := range nostrPool.CloseAll() {
+		UpdateOrCreateRelayStatus(DB, url, "connection error: switching account")
 	}
-	// Clear the subscriptions array
-	nostrSubs = []*nostr.Subscription{}
-	TheLog.Println("Closing existing relays before switching keys")
-	for _, r := range nostrRelays {
-		r.Close()
-		UpdateOrCreateRelayStatus(DB, r.URL, "connection error: switching account")
-	}
-
-	nostrRelays = []*nostr.Relay{}
 
 	// Kick off DM relay subscriptions for the new key
 	TheLog.Printf("Starting DM relay subscriptions for pubkey: %s", accounts[cy].Pubkey)
 	go doDMRelays(DB, context.Background())
+	go computeWotScores(accounts[cy].Pubkey)
 
 	// Reset cursor position and offset to prevent panic
 	v2, _ := g.View("v2")
@@ -201,21 +192,11 @@ func doConfigNew(g *gocui.Gui, v *gocui.View) error {
 		}
 		//fmt.Println(line)
 		//fmt.Println("saving config")
-		useKey := line
-		if line[0:1] == "n" {
-			prefix, value, err := nip19.Decode(line)
-			if err != nil {
-				TheLog.Println("error decoding nip19 key")
-				return nil
-			} else {
-				TheLog.Println("decoded nip19 " + prefix + "to hex")
-				useKey = value.(string)
-			}
-		}
-		if !isHex(useKey) {
-			TheLog.Println("private key was invalid")
+		useKey, err := resolvePrivateKeyInput(line)
+		if err != nil {
+			TheLog.Printf("private key was invalid: %v", err)
 			g.DeleteView("confignew")
-			return nil
+			return showError(g, fmt.Sprintf("Private key not saved: %v", err))
 		}
 
 		encKey := Encrypt(string(Password), useKey)
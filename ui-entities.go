@@ -0,0 +1,364 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/awesome-gocui/gocui"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// v3Entities are the nostr: links in the open conversation, in display order
+var v3Entities []nostrEntity
+
+// v3EntityCursor is the selected link while v3 has focus, -1 means the last one
+var v3EntityCursor = -1
+
+// v3EntitiesPubkey is the conversation v3Entities belong to
+var v3EntitiesPubkey string
+
+// entityAttempts remembers when a link was last looked up on the relays so a
+// missing event isn't refetched on every redraw
+var entityAttempts sync.Map
+var entityRetry = 10 * time.Minute
+
+// entityMissing holds the links the relays had nothing for
+var entityMissing sync.Map
+
+// resetV3Entities starts a new list of links for the conversation with pubkey
+func resetV3Entities(pubkey string) {
+	if pubkey != v3EntitiesPubkey {
+		v3EntitiesPubkey = pubkey
+		v3EntityCursor = -1
+	}
+	v3Entities = nil
+}
+
+func selectedV3Entity() int {
+	if v3EntityCursor < 0 || v3EntityCursor >= len(v3Entities) {
+		return len(v3Entities) - 1
+	}
+	return v3EntityCursor
+}
+
+// renderMessageContent wraps a message and swaps its nostr: links for
+// readable labels, registering each one in v3Entities
+func renderMessageContent(g *gocui.Gui, content string, width int, selecting bool) string {
+	start := len(v3Entities)
+	// labels are wrapped as single words: \x02 and \x03 delimit them and
+	// \x01 stands in for their spaces until after wrapping
+	tokenized := nostrURIPattern.ReplaceAllStringFunc(content, func(uri string) string {
+		e, err := parseNostrEntity(uri)
+		if err != nil {
+			return uri
+		}
+		v3Entities = append(v3Entities, e)
+		return "\x02" + strings.ReplaceAll(entityLabel(g, e), " ", "\x01") + "\x03"
+	})
+	wrapped := wrapText(tokenized, width)
+	if len(v3Entities) == start {
+		return wrapped
+	}
+
+	selected := selectedV3Entity()
+	var out strings.Builder
+	idx := start
+	for {
+		open := strings.IndexByte(wrapped, '\x02')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(wrapped[open:], '\x03')
+		if end < 0 {
+			break
+		}
+		label := strings.ReplaceAll(wrapped[open+1:open+end], "\x01", " ")
+		out.WriteString(wrapped[:open])
+		if selecting && idx == selected {
+			fmt.Fprintf(&out, "\x1b[7m%s\x1b[0m", label)
+		} else {
+			fmt.Fprintf(&out, "\x1b[38;2;%d;%d;%dm%s\x1b[0m", 0xff, 0xaf, 0x00, label)
+		}
+		wrapped = wrapped[open+end+1:]
+		idx++
+	}
+	out.WriteString(wrapped)
+	return out.String()
+}
+
+// entityLabel is how a link is shown inline: @name for profiles and a short
+// preview for events. Unknown ones are fetched in the background.
+func entityLabel(g *gocui.Gui, e nostrEntity) string {
+	if e.isProfile() {
+		var m Metadata
+		if err := DB.First(&m, "pubkey_hex = ?", e.Pubkey).Error; err == nil && (m.Name != "" || m.DisplayName != "") {
+			return "@" + displayName(m)
+		}
+		requestEntity(g, e)
+		npub, _ := nip19.EncodePublicKey(e.Pubkey)
+		return "@" + shortBech32(npub)
+	}
+
+	ce := cachedEntityEvent(e)
+	if ce == nil {
+		requestEntity(g, e)
+		if _, missing := entityMissing.Load(e.URI); missing {
+			return fmt.Sprintf("[%s unavailable]", e.Prefix)
+		}
+		return fmt.Sprintf("[%s loading…]", e.Prefix)
+	}
+	label := fmt.Sprintf("[%s by @%s: %s]", kindName(ce.Kind), authorName(ce.PubkeyHex), previewText(ce.Content, 40))
+	if total, _ := eventZapTotals(ce); total > 0 {
+		label += fmt.Sprintf(" ⚡%d", total/1000)
+	}
+	return label
+}
+
+func displayName(m Metadata) string {
+	if m.Name != "" {
+		return m.Name
+	}
+	return m.DisplayName
+}
+
+func authorName(pubkey string) string {
+	var m Metadata
+	if err := DB.First(&m, "pubkey_hex = ?", pubkey).Error; err == nil && (m.Name != "" || m.DisplayName != "") {
+		return displayName(m)
+	}
+	npub, _ := nip19.EncodePublicKey(pubkey)
+	return shortBech32(npub)
+}
+
+func shortBech32(s string) string {
+	if len(s) <= 16 {
+		return s
+	}
+	return s[:10] + "…" + s[len(s)-4:]
+}
+
+func previewText(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > max {
+		return string(r[:max]) + "…"
+	}
+	return s
+}
+
+func kindName(kind int) string {
+	switch kind {
+	case 0:
+		return "profile"
+	case 1:
+		return "note"
+	case 6:
+		return "repost"
+	case 7:
+		return "reaction"
+	case 30023:
+		return "article"
+	}
+	return fmt.Sprintf("kind %d", kind)
+}
+
+// cachedEntityEvent finds the stored event a note, nevent or naddr points to
+func cachedEntityEvent(e nostrEntity) *CachedEvent {
+	var ce CachedEvent
+	var err error
+	if e.Prefix == "naddr" {
+		err = DB.Where("pubkey_hex = ? AND kind = ? AND identifier = ?", e.Pubkey, e.Kind, e.Identifier).
+			Order("created_at desc").First(&ce).Error
+	} else {
+		err = DB.First(&ce, "id = ?", e.EventID).Error
+	}
+	if err != nil {
+		return nil
+	}
+	return &ce
+}
+
+func saveCachedEvent(ev *nostr.Event) {
+	ce := CachedEvent{
+		ID:         ev.ID,
+		PubkeyHex:  ev.PubKey,
+		Kind:       ev.Kind,
+		Identifier: ev.Tags.GetD(),
+		Content:    ev.Content,
+		Raw:        ev.String(),
+		CreatedAt:  ev.CreatedAt.Time(),
+		FetchedAt:  time.Now(),
+	}
+	if err := DB.Save(&ce).Error; err != nil {
+		TheLog.Printf("error caching event %s: %v", ev.ID, err)
+	}
+}
+
+// entityRelays is where to look for an entity: its hints, our relays and the
+// author's write relays when we know the author
+func entityRelays(e nostrEntity) []string {
+	urls := append([]string{}, e.Relays...)
+	urls = append(urls, configuredRelayURLs(relayRoleRead)...)
+	if e.Pubkey != "" {
+		var writes []RelayList
+		DB.Where("pubkey_hex = ? AND write = ?", e.Pubkey, true).Find(&writes)
+		for _, r := range writes {
+			urls = append(urls, r.Url)
+		}
+	}
+	return uniqueRelayURLs(urls)
+}
+
+// fetchEntity looks an entity up on the relays and stores what it finds
+func fetchEntity(g *gocui.Gui, e nostrEntity) bool {
+	entityAttempts.Store(e.URI, time.Now())
+	ev := fetchNewestEvent(entityRelays(e), e.filter())
+	if !e.matches(ev) {
+		TheLog.Printf("could not fetch %s", e.URI)
+		entityMissing.Store(e.URI, true)
+		return false
+	}
+	entityMissing.Delete(e.URI)
+	if e.isProfile() {
+		processMetadataEvent(g, ev, e.Pubkey)
+	} else {
+		saveCachedEvent(ev)
+	}
+	return true
+}
+
+// requestEntity fetches an unknown entity in the background and redraws the
+// conversation once it has arrived
+func requestEntity(g *gocui.Gui, e nostrEntity) {
+	if last, ok := entityAttempts.Load(e.URI); ok && time.Since(last.(time.Time)) < entityRetry {
+		return
+	}
+	entityAttempts.Store(e.URI, time.Now())
+	go func() {
+		if fetchEntity(g, e) {
+			g.Update(refreshV3Current)
+		}
+	}()
+}
+
+// refreshV3Current redraws the conversation highlighted in v2
+func refreshV3Current(g *gocui.Gui) error {
+	v2, err := g.View("v2")
+	if err != nil {
+		return nil
+	}
+	_, cy := v2.Cursor()
+	return refreshV3(g, cy)
+}
+
+func nextEntityV3(g *gocui.Gui, v *gocui.View) error {
+	if len(v3Entities) == 0 {
+		return nil
+	}
+	v3EntityCursor = (selectedV3Entity() + 1) % len(v3Entities)
+	return refreshV3Current(g)
+}
+
+func prevEntityV3(g *gocui.Gui, v *gocui.View) error {
+	if len(v3Entities) == 0 {
+		return nil
+	}
+	v3EntityCursor = (selectedV3Entity() - 1 + len(v3Entities)) % len(v3Entities)
+	return refreshV3Current(g)
+}
+
+// openEntityV3 opens the selected link: the person view for profiles and the
+// event view for everything else
+func openEntityV3(g *gocui.Gui, v *gocui.View) error {
+	idx := selectedV3Entity()
+	if idx < 0 {
+		return nil
+	}
+	e := v3Entities[idx]
+	if e.isProfile() {
+		return showPersonData(g, e.Pubkey, e.Relays...)
+	}
+	return showEventData(g, e)
+}
+
+// showEventData displays the event an entity points to, fetching it first if
+// it isn't cached
+func showEventData(g *gocui.Gui, e nostrEntity) error {
+	maxX, maxY := g.Size()
+	if v, err := g.SetView("fetchresults", maxX/4, maxY/4, maxX*3/4, maxY*3/4, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+		v.Editable = false
+		v.Wrap = true
+		v.Autoscroll = false
+	}
+	v, _ := g.View("fetchresults")
+	v.Title = "Event"
+	v.Clear()
+	fetchResultsEvent, fetchResultsPubkey = &e, ""
+
+	if ce := cachedEntityEvent(e); ce != nil {
+		printCachedEvent(v, ce)
+		go refreshEventZaps(g, e, ce)
+	} else {
+		fmt.Fprintf(v, "Fetching %s...\n", shortBech32(stripNostrURI(e.URI)))
+		go func() {
+			found := fetchEntity(g, e)
+			g.Update(func(g *gocui.Gui) error {
+				v, err := g.View("fetchresults")
+				if err != nil {
+					return nil
+				}
+				v.Clear()
+				if ce := cachedEntityEvent(e); found && ce != nil {
+					printCachedEvent(v, ce)
+					go refreshEventZaps(g, e, ce)
+				} else {
+					fmt.Fprintf(v, "Event not found on %d relays\n", len(entityRelays(e)))
+					fmt.Fprintf(v, "\nPress ESC to close this view\n")
+				}
+				return nil
+			})
+		}()
+	}
+
+	if _, err := g.SetCurrentView("fetchresults"); err != nil {
+		return err
+	}
+	return nil
+}
+
+func printCachedEvent(v *gocui.View, ce *CachedEvent) {
+	npub, _ := nip19.EncodePublicKey(ce.PubkeyHex)
+	fmt.Fprintf(v, "===== %s =====\n", strings.ToUpper(kindName(ce.Kind)))
+	fmt.Fprintf(v, "Author: @%s (%s)\n", authorName(ce.PubkeyHex), npub)
+	fmt.Fprintf(v, "Created: %s\n", ce.CreatedAt.Format("2006-01-02 15:04:05"))
+	if ce.Identifier != "" {
+		fmt.Fprintf(v, "Identifier: %s\n", ce.Identifier)
+	}
+	fmt.Fprintf(v, "ID: %s\n\n", ce.ID)
+	fmt.Fprintf(v, "%s\n", ce.Content)
+	if total, count := eventZapTotals(ce); count > 0 {
+		fmt.Fprintf(v, "\n⚡ %d sats from %d zaps\n", total/1000, count)
+	}
+	fmt.Fprintf(v, "\nPress Z to zap, ESC to close this view\n")
+}
+
+// refreshEventZaps loads an event's zap receipts and redraws it if it is
+// still on screen
+func refreshEventZaps(g *gocui.Gui, e nostrEntity, ce *CachedEvent) {
+	fetchEventZaps(ce, entityRelays(e))
+	g.Update(func(g *gocui.Gui) error {
+		v, err := g.View("fetchresults")
+		if err != nil || fetchResultsEvent == nil || fetchResultsEvent.URI != e.URI {
+			return nil
+		}
+		v.Clear()
+		printCachedEvent(v, ce)
+		return refreshV3Current(g)
+	})
+}
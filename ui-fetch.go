@@ -34,7 +34,7 @@ func fetchByPubkey(g *gocui.Gui, v *gocui.View) error {
 		if !errors.Is(err, gocui.ErrUnknownView) {
 			return err
 		}
-		v.Title = "Enter Pubkey/Npub"
+		v.Title = "Enter npub, nprofile, hex or name@domain"
 		v.Editable = true
 		v.KeybindOnEdit = true
 		v.Clear()
@@ -57,6 +57,7 @@ func cancelFetchPubkey(g *gocui.Gui, v *gocui.View) error {
 }
 
 func closeFetchResults(g *gocui.Gui, v *gocui.View) error {
+	go clearAvatarGraphics()
 	if err := g.DeleteView("fetchresults"); err != nil {
 		return err
 	}
@@ -86,54 +87,57 @@ func doFetchByPubkey(g *gocui.Gui, v *gocui.View) error {
 		return nil
 	}
 
-	// Process the pubkey/npub input
-	pubkey := pubkeyInput
-	// Check if it's an npub and convert to hex if needed
-	if strings.HasPrefix(pubkeyInput, "npub") {
-		_, decodedPubkey, err := nip19.Decode(pubkeyInput)
-		if err != nil {
-			// Create results view to show error
-			maxX, maxY := g.Size()
-			if v, err := g.SetView("fetchresults", maxX/4, maxY/4, maxX*3/4, maxY*3/4, 0); err != nil {
-				if !errors.Is(err, gocui.ErrUnknownView) {
-					return err
-				}
-				v.Title = "Error"
-				v.Editable = false
-				v.Wrap = true
-				v.Autoscroll = false
-				v.Clear()
-			}
-
-			fetchResultsView, _ := g.View("fetchresults")
-			fetchResultsView.Clear()
-			fmt.Fprintf(fetchResultsView, "Error: Invalid npub format\n")
-			fmt.Fprintf(fetchResultsView, "\nPress ESC to close this view\n")
-
-			// Delete the fetchpubkey input view
-			if err := g.DeleteView("fetchpubkey"); err != nil {
-				return err
-			}
+	// Delete the fetchpubkey input view
+	if err := g.DeleteView("fetchpubkey"); err != nil {
+		return err
+	}
+	if _, err := g.SetCurrentView("v2"); err != nil {
+		return err
+	}
 
-			// Set the current view to the fetch results
-			if _, err := g.SetCurrentView("fetchresults"); err != nil {
-				return err
+	// NIP-05 identifiers need an HTTP round trip, so resolve off the UI thread
+	go func() {
+		pubkey, hints, err := resolvePubkeyInput(pubkeyInput)
+		g.Update(func(g *gocui.Gui) error {
+			if err != nil {
+				TheLog.Printf("pubkey lookup for %q failed: %v", pubkeyInput, err)
+				return showFetchError(g, err.Error())
 			}
+			return showPersonData(g, pubkey, hints...)
+		})
+	}()
+	return nil
+}
 
-			return nil
+// showFetchError reports a lookup that couldn't start in the fetchresults view
+func showFetchError(g *gocui.Gui, message string) error {
+	maxX, maxY := g.Size()
+	if v, err := g.SetView("fetchresults", maxX/4, maxY/4, maxX*3/4, maxY*3/4, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
 		}
-		pubkey = decodedPubkey.(string)
+		v.Title = "Error"
+		v.Editable = false
+		v.Wrap = true
+		v.Autoscroll = false
 	}
 
-	// Delete the fetchpubkey input view
-	if err := g.DeleteView("fetchpubkey"); err != nil {
+	fetchResultsView, _ := g.View("fetchresults")
+	fetchResultsView.Clear()
+	fetchResultsEvent, fetchResultsPubkey = nil, ""
+	fmt.Fprintf(fetchResultsView, "Error: %s\n", message)
+	fmt.Fprintf(fetchResultsView, "\nPress ESC to close this view\n")
+
+	// Set the current view to the fetch results
+	if _, err := g.SetCurrentView("fetchresults"); err != nil {
 		return err
 	}
-
-	return showPersonData(g, pubkey)
+	return nil
 }
 
-func showPersonData(g *gocui.Gui, pubkey string) error {
+// showPersonData fetches and displays a profile, also asking any relay hints
+// that came with the lookup (nprofile or NIP-05 relays)
+func showPersonData(g *gocui.Gui, pubkey string, hints ...string) error {
 	// Create or get the fetch results view
 	maxX, maxY := g.Size()
 	if v, err := g.SetView("fetchresults", maxX/4, maxY/4, maxX*3/4, maxY*3/4, 0); err != nil {
@@ -150,6 +154,8 @@ func showPersonData(g *gocui.Gui, pubkey string) error {
 	fetchResultsView, _ := g.View("fetchresults")
 	fetchResultsView.Clear()
 	fetchResultsView.Autoscroll = true
+	fetchResultsView.Title = "Person Data"
+	fetchResultsEvent, fetchResultsPubkey = nil, pubkey
 
 	// Display a loading message
 	fmt.Fprintf(fetchResultsView, "Fetching data for pubkey: %s\n", pubkey)
@@ -158,11 +164,27 @@ func showPersonData(g *gocui.Gui, pubkey string) error {
 	// Fetch data asynchronously
 	go func() {
 		// Fetch and process relay list
-		fetchRelayList(g, pubkey)
+		fetchRelayList(g, pubkey, hints...)
+
+		// Give the metadata a moment to arrive, then re-check its NIP-05
+		go func() {
+			time.Sleep(3 * time.Second)
+			verifyNip05(pubkey)
+		}()
 
 		// Wait a moment for the fetch to complete
 		time.Sleep(6 * time.Second)
 
+		// Download the profile picture now that the metadata is in
+		var pictureMeta Metadata
+		DB.Where("pubkey_hex = ?", pubkey).First(&pictureMeta)
+		if avatarsEnabled && avatarDue(pubkey, pictureMeta.Picture) {
+			if _, busy := avatarFetching.LoadOrStore(pubkey, true); !busy {
+				fetchAvatar(pubkey, pictureMeta.Picture)
+				avatarFetching.Delete(pubkey)
+			}
+		}
+
 		// Now display all the information
 		g.Update(func(g *gocui.Gui) error {
 			fetchResultsView, err := g.View("fetchresults")
@@ -179,15 +201,29 @@ func showPersonData(g *gocui.Gui, pubkey string) error {
 				fmt.Fprintf(fetchResultsView, "===== PROFILE METADATA =====\n")
 				fmt.Fprintf(fetchResultsView, "No metadata found for this pubkey\n")
 			} else {
+				// Display the profile picture above the metadata
+				if avatarsEnabled {
+					if img := cachedAvatar(pubkey, metadata.Picture); img != nil {
+						for _, line := range avatarLines(img, 16, 8) {
+							fmt.Fprintf(fetchResultsView, "%s\n", line)
+						}
+						fetchResultsView.Autoscroll = false
+						drawAvatarGraphics(g, "fetchresults", img, 16, 8)
+					}
+				}
+
 				// Display the metadata
 				fmt.Fprintf(fetchResultsView, "===== PROFILE METADATA =====\n")
 				fmt.Fprintf(fetchResultsView, "Name: %s\n", metadata.Name)
 				fmt.Fprintf(fetchResultsView, "Display Name: %s\n", metadata.DisplayName)
 				fmt.Fprintf(fetchResultsView, "About: %s\n", metadata.About)
-				fmt.Fprintf(fetchResultsView, "NIP-05: %s\n", metadata.Nip05)
+				fmt.Fprintf(fetchResultsView, "NIP-05: %s\n", nip05Describe(metadata.PubkeyHex, metadata.Nip05))
 				fmt.Fprintf(fetchResultsView, "Website: %s\n", metadata.Website)
 				fmt.Fprintf(fetchResultsView, "Lightning Address: %s\n", metadata.Lud16)
 				fmt.Fprintf(fetchResultsView, "Total Follows: %d\n", metadata.TotalFollows)
+				received, receivedCount, sent, sentCount := zapTotals(pubkey)
+				fmt.Fprintf(fetchResultsView, "Zaps Received: %d sats (%d zaps)\n", received/1000, receivedCount)
+				fmt.Fprintf(fetchResultsView, "Zaps Sent: %d sats (%d zaps)\n", sent/1000, sentCount)
 				fmt.Fprintf(fetchResultsView, "Last Updated: %s\n", metadata.MetadataUpdatedAt.Format("2006-01-02 15:04:05"))
 			}
 
@@ -244,8 +280,8 @@ func showPersonData(g *gocui.Gui, pubkey string) error {
 	return nil
 }
 
-func fetchRelayList(g *gocui.Gui, pubkey string) {
-	TheLog.Printf("Fetching relay list for pubkey: %s", pubkey)
+func fetchRelayList(g *gocui.Gui, pubkey string, hints ...string) {
+	TheLog.Printf("Fetching relay list for pubkey: %s (hints: %v)", pubkey, hints)
 
 	// Get relays for this pubkey from the database
 	var relayList []RelayList
@@ -258,11 +294,13 @@ func fetchRelayList(g *gocui.Gui, pubkey string) {
 	if len(relayList) == 0 {
 		TheLog.Printf("No relays found for pubkey %s, using global relay list", pubkey)
 
-		// Get active relays from the database
+		// Get the profile index relays from the database
 		var relayStatuses []RelayStatus
-		result := DB.Find(&relayStatuses)
-		if result.Error != nil {
-			TheLog.Printf("Error querying relay_status: %v", result.Error)
+		for _, url := range configuredRelayURLs(relayRoleProfiles) {
+			relayStatuses = append(relayStatuses, RelayStatus{Url: url})
+		}
+		for _, hint := range hints {
+			relayStatuses = append(relayStatuses, RelayStatus{Url: hint})
 		}
 
 		if len(relayStatuses) == 0 {
@@ -281,7 +319,7 @@ func fetchRelayList(g *gocui.Gui, pubkey string) {
 				defer wg.Done()
 
 				// Connect to relay
-				relay, err := nostr.RelayConnect(context.Background(), relayUrl)
+				relay, err := dialRelay(context.Background(), relayUrl)
 				if err != nil {
 					TheLog.Printf("Error connecting to relay %s: %v", relayUrl, err)
 					return
@@ -309,6 +347,8 @@ func fetchRelayList(g *gocui.Gui, pubkey string) {
 						Limit:   1,
 					},
 				}
+				// Kind 9735: Zap receipts to and from them
+				filters = append(filters, zapReceiptFilters(pubkey, 100)...)
 
 				// Subscribe to events
 				sub, err := relay.Subscribe(context.Background(), filters)
@@ -336,6 +376,8 @@ func fetchRelayList(g *gocui.Gui, pubkey string) {
 						foundDMRelayList = true
 						foundMutex.Unlock()
 						processDMRelayListEvent(g, evt, pubkey)
+					} else if evt.Kind == 9735 {
+						processZapReceipt(evt)
 					}
 				}
 			}(relayStatus.Url)
@@ -371,6 +413,9 @@ func fetchRelayList(g *gocui.Gui, pubkey string) {
 	} else {
 		// Use the relays from the relay_list table for this pubkey
 		TheLog.Printf("Found %d relays for pubkey %s", len(relayList), pubkey)
+		for _, hint := range hints {
+			relayList = append(relayList, RelayList{Url: hint, Read: true})
+		}
 
 		// Create a wait group to wait for all relay connections
 		var wg sync.WaitGroup
@@ -390,7 +435,7 @@ func fetchRelayList(g *gocui.Gui, pubkey string) {
 				defer wg.Done()
 
 				// Connect to relay
-				relay, err := nostr.RelayConnect(context.Background(), relayUrl)
+				relay, err := dialRelay(context.Background(), relayUrl)
 				if err != nil {
 					TheLog.Printf("Error connecting to relay %s: %v", relayUrl, err)
 					return
@@ -418,6 +463,8 @@ func fetchRelayList(g *gocui.Gui, pubkey string) {
 						Limit:   1,
 					},
 				}
+				// Kind 9735: Zap receipts to and from them
+				filters = append(filters, zapReceiptFilters(pubkey, 100)...)
 
 				// Subscribe to events
 				sub, err := relay.Subscribe(context.Background(), filters)
@@ -445,6 +492,8 @@ func fetchRelayList(g *gocui.Gui, pubkey string) {
 						foundDMRelayList = true
 						foundMutex.Unlock()
 						processDMRelayListEvent(g, evt, pubkey)
+					} else if evt.Kind == 9735 {
+						processZapReceipt(evt)
 					}
 				}
 			}(relay.Url)
@@ -635,7 +684,7 @@ func processMetadataEvent(g *gocui.Gui, evt *nostr.Event, pubkey string) {
 		fmt.Fprintf(fetchResultsView, "Name: %s\n", metadata.Name)
 		fmt.Fprintf(fetchResultsView, "Display Name: %s\n", metadata.DisplayName)
 		fmt.Fprintf(fetchResultsView, "About: %s\n", metadata.About)
-		fmt.Fprintf(fetchResultsView, "NIP-05: %s\n", metadata.Nip05)
+		fmt.Fprintf(fetchResultsView, "NIP-05: %s\n", nip05Describe(metadata.PubkeyHex, metadata.Nip05))
 		fmt.Fprintf(fetchResultsView, "Website: %s\n", metadata.Website)
 		fmt.Fprintf(fetchResultsView, "Lightning Address: %s\n", metadata.Lud16)
 		fmt.Fprintf(fetchResultsView, "Total Follows: %d\n", metadata.TotalFollows)
@@ -741,45 +790,9 @@ func processRelayListEvent(g *gocui.Gui, evt *nostr.Event, pubkey string) {
 
 	TheLog.Printf("Processing relay list event with %d tags", len(evt.Tags))
 
-	// Clear existing relay list for this pubkey
-	DB.Where("pubkey_hex = ?", pubkey).Delete(&RelayList{})
-
-	// According to NIP-65, relay lists are stored in "r" tags
-	// Format: ["r", "wss://relay.example.com", "read" or "write" (optional)]
-	foundRelays := false
-
-	for _, tag := range evt.Tags {
-		if len(tag) >= 2 && tag[0] == "r" {
-			relayUrl := tag[1]
-			read := true
-			write := true
-
-			// Check if there's a read/write marker
-			if len(tag) >= 3 {
-				if tag[2] == "read" {
-					write = false
-				} else if tag[2] == "write" {
-					read = false
-				}
-			}
-
-			// Create a new relay list entry
-			relay := RelayList{
-				PubkeyHex: pubkey,
-				Url:       relayUrl,
-				Read:      read,
-				Write:     write,
-			}
-
-			// Save to database
-			if err := DB.Create(&relay).Error; err != nil {
-				TheLog.Printf("Error saving relay to database: %v", err)
-			} else {
-				foundRelays = true
-				TheLog.Printf("Saved relay %s [Read: %v, Write: %v]", relayUrl, read, write)
-			}
-		}
-	}
+	// a stale event leaves the newer stored list in place, which is shown below
+	saved, stale := saveRelayListEvent(evt, pubkey)
+	foundRelays := saved > 0 || stale
 
 	// If no relays were found in the tags, show an error
 	if !foundRelays {
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/awesome-gocui/gocui"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// followSelected adds the highlighted v2 entry to our contact list
+func followSelected(g *gocui.Gui, v *gocui.View) error {
+	return changeFollowSelected(g, v, true)
+}
+
+// unfollowSelected removes the highlighted v2 entry from our contact list
+func unfollowSelected(g *gocui.Gui, v *gocui.View) error {
+	return changeFollowSelected(g, v, false)
+}
+
+func changeFollowSelected(g *gocui.Gui, v *gocui.View, follow bool) error {
+	v2, err := g.View("v2")
+	if err != nil {
+		return err
+	}
+	_, cy := v2.Cursor()
+	if cy >= len(displayV2Meta) {
+		return nil
+	}
+	target := displayV2Meta[cy]
+
+	var account Account
+	DB.Where("active = ?", true).First(&account)
+	if account.Pubkey == "" || account.Privatekey == "" {
+		return showError(g, "No active account found")
+	}
+	if target.PubkeyHex == account.Pubkey {
+		return nil
+	}
+
+	go func() {
+		if err := updateContactList(account, target.PubkeyHex, follow); err != nil {
+			TheLog.Printf("error updating contact list: %v", err)
+			g.Update(func(g *gocui.Gui) error {
+				return showError(g, fmt.Sprintf("Contact list not updated: %v", err))
+			})
+			return
+		}
+		g.Update(func(g *gocui.Gui) error {
+			return refreshAllViews(g, v)
+		})
+	}()
+	return nil
+}
+
+// updateContactList fetches our newest kind 3 from the relays, adds or removes
+// a single p tag and republishes it. Unknown tags and the content field are
+// carried over untouched so edits from other clients are not clobbered.
+func updateContactList(account Account, pubkey string, follow bool) error {
+	urls := writeRelayURLs(account.Pubkey)
+	urls = append(urls, nostrPool.URLs()...)
+	urls = uniqueRelayURLs(urls)
+
+	latest := fetchNewestEvent(urls, nostr.Filter{
+		Kinds:   []int{3},
+		Authors: []string{account.Pubkey},
+		Limit:   1,
+	})
+
+	var tags nostr.Tags
+	content := ""
+	if latest != nil {
+		var me Metadata
+		DB.First(&me, "pubkey_hex = ?", account.Pubkey)
+		if me.ContactsUpdatedAt.After(latest.CreatedAt.Time()) {
+			TheLog.Printf("relays returned an older contact list than we have seen (%s), not publishing", latest.CreatedAt.Time())
+			return fmt.Errorf("relays only returned an outdated contact list")
+		}
+		tags = latest.Tags
+		content = latest.Content
+	} else {
+		// refuse to replace a list we know exists but could not fetch
+		var me Metadata
+		DB.First(&me, "pubkey_hex = ?", account.Pubkey)
+		if me.TotalFollows > 0 {
+			return fmt.Errorf("could not fetch the current contact list from relays")
+		}
+	}
+
+	var newTags nostr.Tags
+	found := false
+	for _, tag := range tags {
+		if len(tag) >= 2 && tag[0] == "p" && tag[1] == pubkey {
+			found = true
+			if !follow {
+				continue
+			}
+		}
+		newTags = append(newTags, tag)
+	}
+	if follow && !found {
+		newTags = append(newTags, nostr.Tag{"p", pubkey})
+	}
+	if follow == found {
+		TheLog.Printf("contact list already up to date for %s", pubkey)
+		return nil
+	}
+
+	ev := nostr.Event{
+		Kind:      3,
+		PubKey:    account.Pubkey,
+		CreatedAt: nostr.Now(),
+		Tags:      newTags,
+		Content:   content,
+	}
+	sk := Decrypt(string(Password), account.Privatekey)
+	if err := ev.Sign(sk); err != nil {
+		return err
+	}
+
+	if publishToRelays(writeRelayURLs(account.Pubkey), ev) == 0 {
+		return fmt.Errorf("no relay accepted the contact list")
+	}
+
+	// mirror the change in metadata_follows
+	if follow {
+		var followPerson Metadata
+		if err := DB.First(&followPerson, "pubkey_hex = ?", pubkey).Error; err != nil {
+			DB.Omit("Follows").Create(&Metadata{PubkeyHex: pubkey, ContactsUpdatedAt: time.Unix(0, 0), MetadataUpdatedAt: time.Unix(0, 0)})
+		}
+		DB.Exec("INSERT OR IGNORE INTO metadata_follows (metadata_pubkey_hex, follow_pubkey_hex) VALUES (?, ?)", account.Pubkey, pubkey)
+	} else {
+		DB.Exec("delete from metadata_follows where metadata_pubkey_hex = ? and follow_pubkey_hex = ?", account.Pubkey, pubkey)
+	}
+	DB.Model(&Metadata{}).Where("pubkey_hex = ?", account.Pubkey).Omit("updated_at").Updates(map[string]interface{}{
+		"total_follows":       len(newTags.GetAll([]string{"p"})),
+		"contacts_updated_at": ev.CreatedAt.Time(),
+	})
+	TheLog.Printf("published contact list with %d tags (follow=%v %s)", len(newTags), follow, pubkey)
+	return nil
+}
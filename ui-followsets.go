@@ -0,0 +1,418 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/awesome-gocui/gocui"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// activeFollowSetID is the set shown when v2MetaDisplay is 4
+var activeFollowSetID int64
+
+// followSetTarget is the v2 entry that was highlighted when the groups menu opened
+var followSetTarget string
+
+// saveFollowSetEvent stores a NIP-51 kind 30000 follow set if it is newer than
+// what we have for the same pubkey and d tag
+func saveFollowSetEvent(ev *nostr.Event) {
+	identifier := ""
+	if d := ev.Tags.Find("d"); len(d) >= 2 {
+		identifier = d[1]
+	}
+
+	var set FollowSet
+	err := DB.Where("pubkey_hex = ? AND identifier = ?", ev.PubKey, identifier).First(&set).Error
+	if err == nil && !set.EventCreatedAt.Before(ev.CreatedAt.Time()) {
+		return
+	}
+
+	set.PubkeyHex = ev.PubKey
+	set.Identifier = identifier
+	set.Title = identifier
+	set.Content = ev.Content
+	set.EventCreatedAt = ev.CreatedAt.Time()
+	// newer than our deletion, the set was made again
+	set.Deleted = false
+
+	var members []nostr.Tag
+	var extra nostr.Tags
+	for _, tag := range ev.Tags {
+		if len(tag) < 2 {
+			extra = append(extra, tag)
+			continue
+		}
+		switch tag[0] {
+		case "d":
+		case "title":
+			set.Title = tag[1]
+		case "p":
+			if isHex(tag[1]) && len(tag[1]) == 64 {
+				members = append(members, tag)
+			} else {
+				// not a member we can show, but it goes back out as it came
+				extra = append(extra, tag)
+			}
+		default:
+			extra = append(extra, tag)
+		}
+	}
+	extraJSON, _ := json.Marshal(extra)
+	set.ExtraTags = string(extraJSON)
+
+	if err := DB.Save(&set).Error; err != nil {
+		TheLog.Printf("error saving follow set %s: %v", identifier, err)
+		return
+	}
+	DB.Model(&set).Update("deleted", false)
+	DB.Where("follow_set_id = ?", set.ID).Delete(&FollowSetMember{})
+	for _, tag := range members {
+		tagJSON, _ := json.Marshal(tag)
+		DB.Create(&FollowSetMember{FollowSetID: set.ID, PubkeyHex: tag[1], Tag: string(tagJSON)})
+	}
+	TheLog.Printf("saved follow set %s (%d members) for %s", identifier, len(members), ev.PubKey)
+}
+
+// followSetEvent builds the kind 30000 event for a set from the local rows,
+// carrying over tags we don't understand
+func followSetEvent(set FollowSet) nostr.Event {
+	tags := nostr.Tags{{"d", set.Identifier}}
+	if set.Title != "" {
+		tags = append(tags, nostr.Tag{"title", set.Title})
+	}
+	var extra nostr.Tags
+	if set.ExtraTags != "" {
+		json.Unmarshal([]byte(set.ExtraTags), &extra)
+	}
+	tags = append(tags, extra...)
+	var members []FollowSetMember
+	DB.Where("follow_set_id = ?", set.ID).Find(&members)
+	for _, m := range members {
+		tags = append(tags, m.pTag())
+	}
+	return nostr.Event{
+		Kind:      30000,
+		PubKey:    set.PubkeyHex,
+		CreatedAt: nostr.Now(),
+		Tags:      tags,
+		Content:   set.Content,
+	}
+}
+
+// pTag is the member's tag as we received it, or a bare p tag for members added here
+func (m FollowSetMember) pTag() nostr.Tag {
+	var tag nostr.Tag
+	if m.Tag != "" && json.Unmarshal([]byte(m.Tag), &tag) == nil && len(tag) >= 2 && tag[1] == m.PubkeyHex {
+		return tag
+	}
+	return nostr.Tag{"p", m.PubkeyHex}
+}
+
+// publishFollowSet signs and publishes a set to our write relays
+func publishFollowSet(account Account, set FollowSet) {
+	ev := followSetEvent(set)
+	sk := Decrypt(string(Password), account.Privatekey)
+	if err := ev.Sign(sk); err != nil {
+		TheLog.Printf("error signing follow set: %v", err)
+		return
+	}
+	DB.Model(&set).Update("event_created_at", ev.CreatedAt.Time())
+	publishToRelays(writeRelayURLs(account.Pubkey), ev)
+}
+
+func activeAccountFollowSets() (Account, []FollowSet) {
+	var account Account
+	DB.Where("active = ?", true).First(&account)
+	var sets []FollowSet
+	DB.Where("pubkey_hex = ? AND deleted = ?", account.Pubkey, false).Order("title").Find(&sets)
+	return account, sets
+}
+
+// followSetsMenu lists our follow sets (contact groups)
+func followSetsMenu(g *gocui.Gui, v *gocui.View) error {
+	if v != nil && v.Name() == "v2" {
+		_, cy := v.Cursor()
+		followSetTarget = ""
+		if cy < len(displayV2Meta) {
+			followSetTarget = displayV2Meta[cy].PubkeyHex
+		}
+	}
+
+	maxX, maxY := g.Size()
+	g.DeleteView("followsets")
+	if v, err := g.SetView("followsets", maxX/2-40, maxY/2-10, maxX/2+40, maxY/2+10, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+
+		v.Title = "Contact Groups"
+		v.Highlight = true
+		v.SelBgColor = activeTheme.HighlightBg
+		v.SelFgColor = activeTheme.HighlightFg
+		v.Editable = false
+		v.BgColor = activeTheme.Bg
+		v.FgColor = activeTheme.Fg
+
+		_, sets := activeAccountFollowSets()
+		if len(sets) == 0 {
+			fmt.Fprintf(v, "No groups yet, press n to create one\n")
+		}
+		for _, set := range sets {
+			count := int64(0)
+			DB.Model(&FollowSetMember{}).Where("follow_set_id = ?", set.ID).Count(&count)
+			member := " "
+			if followSetTarget != "" {
+				var m FollowSetMember
+				if DB.Where("follow_set_id = ? AND pubkey_hex = ?", set.ID, followSetTarget).First(&m).Error == nil {
+					member = "*"
+				}
+			}
+			fmt.Fprintf(v, "%s %-30s (%d)\n", member, set.Title, count)
+		}
+
+		if _, err := g.SetCurrentView("followsets"); err != nil {
+			return err
+		}
+		updateFollowSetsKeybindsView(g)
+	}
+	return nil
+}
+
+func selectedFollowSet(v *gocui.View) (Account, FollowSet, bool) {
+	account, sets := activeAccountFollowSets()
+	_, cy := v.Cursor()
+	if cy >= len(sets) {
+		return account, FollowSet{}, false
+	}
+	return account, sets[cy], true
+}
+
+// viewFollowSet shows the members of the selected set in v2
+func viewFollowSet(g *gocui.Gui, v *gocui.View) error {
+	_, set, ok := selectedFollowSet(v)
+	if !ok {
+		return nil
+	}
+	activeFollowSetID = set.ID
+	v2MetaDisplay = 4
+	CurrOffset = 0
+	closeFollowSets(g, v)
+	return refreshAllViews(g, v)
+}
+
+// addToFollowSet puts the highlighted v2 entry into the selected set
+func addToFollowSet(g *gocui.Gui, v *gocui.View) error {
+	account, set, ok := selectedFollowSet(v)
+	if !ok || followSetTarget == "" {
+		return nil
+	}
+	var m FollowSetMember
+	if DB.Where("follow_set_id = ? AND pubkey_hex = ?", set.ID, followSetTarget).First(&m).Error == nil {
+		return nil
+	}
+	DB.Create(&FollowSetMember{FollowSetID: set.ID, PubkeyHex: followSetTarget})
+	go publishFollowSet(account, set)
+	return followSetsMenu(g, v)
+}
+
+// removeFromFollowSet takes the highlighted v2 entry out of the selected set
+func removeFromFollowSet(g *gocui.Gui, v *gocui.View) error {
+	account, set, ok := selectedFollowSet(v)
+	if !ok || followSetTarget == "" {
+		return nil
+	}
+	rows := DB.Where("follow_set_id = ? AND pubkey_hex = ?", set.ID, followSetTarget).Delete(&FollowSetMember{}).RowsAffected
+	if rows > 0 {
+		go publishFollowSet(account, set)
+	}
+	return followSetsMenu(g, v)
+}
+
+// deleteFollowSet removes a set locally and asks relays to delete it (NIP-09).
+// The row stays behind as a tombstone dated at the deletion, so older copies
+// of the set that relays still hold are ignored.
+func deleteFollowSet(g *gocui.Gui, v *gocui.View) error {
+	account, set, ok := selectedFollowSet(v)
+	if !ok {
+		return nil
+	}
+	deletedAt := nostr.Now()
+	DB.Where("follow_set_id = ?", set.ID).Delete(&FollowSetMember{})
+	DB.Model(&set).Updates(map[string]interface{}{"deleted": true, "event_created_at": deletedAt.Time()})
+	if activeFollowSetID == set.ID && v2MetaDisplay == 4 {
+		v2MetaDisplay = 0
+	}
+
+	go func() {
+		ev := nostr.Event{
+			Kind:      5,
+			PubKey:    account.Pubkey,
+			CreatedAt: deletedAt,
+			Tags:      nostr.Tags{{"a", fmt.Sprintf("30000:%s:%s", account.Pubkey, set.Identifier)}},
+		}
+		sk := Decrypt(string(Password), account.Privatekey)
+		if err := ev.Sign(sk); err != nil {
+			TheLog.Printf("error signing follow set deletion: %v", err)
+			return
+		}
+		publishToRelays(writeRelayURLs(account.Pubkey), ev)
+	}()
+	return followSetsMenu(g, v)
+}
+
+// newFollowSet opens an input for the name of a new set
+func newFollowSet(g *gocui.Gui, v *gocui.View) error {
+	maxX, maxY := g.Size()
+	if v, err := g.SetView("followsetnew", maxX/2-30, maxY/2, maxX/2+30, maxY/2+2, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+		v.Title = "New group name - [Enter] to save, [Esc] to cancel"
+		v.Editable = true
+		v.KeybindOnEdit = true
+		v.BgColor = activeTheme.Bg
+		v.FgColor = activeTheme.Fg
+		if _, err := g.SetCurrentView("followsetnew"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var followSetIdentifierChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+func doNewFollowSet(g *gocui.Gui, v *gocui.View) error {
+	title := strings.TrimSpace(v.Buffer())
+	g.DeleteView("followsetnew")
+	if title == "" {
+		return followSetsMenu(g, v)
+	}
+
+	var account Account
+	DB.Where("active = ?", true).First(&account)
+	if account.Pubkey == "" {
+		return showError(g, "No active account found")
+	}
+
+	identifier := strings.Trim(followSetIdentifierChars.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if identifier == "" {
+		identifier = fmt.Sprintf("group-%d", time.Now().Unix())
+	}
+	var existing FollowSet
+	if DB.Where("pubkey_hex = ? AND identifier = ?", account.Pubkey, identifier).First(&existing).Error == nil && !existing.Deleted {
+		return showError(g, fmt.Sprintf("A group named %s already exists", identifier))
+	}
+
+	// a deleted group of the same name is brought back from its tombstone
+	set := existing
+	set.PubkeyHex = account.Pubkey
+	set.Identifier = identifier
+	set.Title = title
+	set.Content = ""
+	set.ExtraTags = ""
+	set.EventCreatedAt = time.Now()
+	if err := DB.Save(&set).Error; err != nil {
+		TheLog.Printf("error creating follow set: %v", err)
+		return nil
+	}
+	DB.Model(&set).Update("deleted", false)
+	if followSetTarget != "" {
+		DB.Create(&FollowSetMember{FollowSetID: set.ID, PubkeyHex: followSetTarget})
+	}
+	go publishFollowSet(account, set)
+	return followSetsMenu(g, v)
+}
+
+func cancelNewFollowSet(g *gocui.Gui, v *gocui.View) error {
+	g.DeleteView("followsetnew")
+	return followSetsMenu(g, v)
+}
+
+func closeFollowSets(g *gocui.Gui, v *gocui.View) error {
+	g.DeleteView("followsets")
+	updateKeybindsView(g)
+	g.SetCurrentView("v2")
+	return nil
+}
+
+// refreshV2FollowSet displays the members of the active follow set in v2
+func refreshV2FollowSet(g *gocui.Gui, v *gocui.View) error {
+	v2, err := g.View("v2")
+	if err != nil {
+		return err
+	}
+	v2.Clear()
+
+	var account Account
+	DB.First(&account, "active = ?", true)
+
+	var set FollowSet
+	if err := DB.First(&set, "id = ?", activeFollowSetID).Error; err != nil {
+		v2.Title = "Pubkey navigator - group not found"
+		v2Meta = []Metadata{}
+		displayV2Meta = v2Meta
+		return nil
+	}
+
+	var members []FollowSetMember
+	DB.Where("follow_set_id = ?", set.ID).Find(&members)
+	var pubkeys []string
+	for _, m := range members {
+		pubkeys = append(pubkeys, m.PubkeyHex)
+	}
+	var metas []Metadata
+	if len(pubkeys) > 0 {
+		DB.Where("pubkey_hex IN ?", pubkeys).Find(&metas)
+	}
+	// members we have never seen metadata for still get a row
+	known := make(map[string]bool)
+	for _, m := range metas {
+		known[m.PubkeyHex] = true
+	}
+	for _, p := range pubkeys {
+		if !known[p] {
+			metas = append(metas, Metadata{PubkeyHex: p})
+		}
+	}
+
+	if searchTerm != "" {
+		searchTermTrimmed := strings.ToLower(strings.Trim(searchTerm, "%"))
+		var filtered []Metadata
+		for _, m := range metas {
+			if strings.Contains(strings.ToLower(m.Name), searchTermTrimmed) ||
+				strings.Contains(strings.ToLower(m.Nip05), searchTermTrimmed) ||
+				strings.Contains(strings.ToLower(m.DisplayName), searchTermTrimmed) {
+				filtered = append(filtered, m)
+			}
+		}
+		metas = filtered
+	}
+
+	v2.Title = fmt.Sprintf("Pubkey navigator - group: %s (%d)", set.Title, len(metas))
+
+	scores := loadWotScores(account.Pubkey, metadataPubkeys(metas))
+	if v2SortByWot {
+		sortByWot(metas, scores)
+	}
+	v2Meta = metas
+
+	_, vSizeY := v2.Size()
+	maxDisplay := vSizeY - 1
+
+	// Calculate the slice of metadata to display based on current offset
+	endIdx := CurrOffset + maxDisplay
+	if endIdx > len(v2Meta) {
+		endIdx = len(v2Meta)
+	}
+	displayV2Meta = v2Meta[CurrOffset:endIdx]
+
+	// Display the metadata
+	printV2Rows(v2, displayV2Meta, scores)
+
+	return nil
+}
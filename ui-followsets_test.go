@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestFollowSetKeepsInvalidPTags(t *testing.T) {
+	pubkey, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	member := strings.Repeat("ab", 32)
+	ev := &nostr.Event{
+		Kind:      30000,
+		PubKey:    pubkey,
+		CreatedAt: nostr.Now(),
+		Tags: nostr.Tags{
+			{"d", "friends"},
+			{"p", member, "wss://relay.example.com", "bob"},
+			{"p", "npub1notahexkey"},
+			{"p", "abcd"},
+		},
+	}
+	saveFollowSetEvent(ev)
+
+	var set FollowSet
+	if err := DB.Where("pubkey_hex = ? AND identifier = ?", pubkey, "friends").First(&set).Error; err != nil {
+		t.Fatalf("follow set not saved: %v", err)
+	}
+	out := followSetEvent(set)
+	for _, want := range ev.Tags {
+		found := false
+		for _, tag := range out.Tags {
+			if strings.Join(tag, "\x00") == strings.Join(want, "\x00") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("republished follow set lost %v, has %v", want, out.Tags)
+		}
+	}
+}
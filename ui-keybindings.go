@@ -50,11 +50,44 @@ func keybindings(g *gocui.Gui) error {
 		log.Panicln(err)
 	}
 
+	// w key toggles sorting by web-of-trust score
+	if err := g.SetKeybinding("v2", rune(0x77), gocui.ModNone, toggleWotSort); err != nil {
+		log.Panicln(err)
+	}
+
+	// o key follows the highlighted pubkey
+	if err := g.SetKeybinding("v2", rune(0x6f), gocui.ModNone, followSelected); err != nil {
+		log.Panicln(err)
+	}
+	// u key unfollows the highlighted pubkey
+	if err := g.SetKeybinding("v2", rune(0x75), gocui.ModNone, unfollowSelected); err != nil {
+		log.Panicln(err)
+	}
+
+	// g key opens the contact groups (NIP-51 follow sets) menu
+	if err := g.SetKeybinding("v2", rune(0x67), gocui.ModNone, followSetsMenu); err != nil {
+		log.Panicln(err)
+	}
+
 	// z key for zaps
 	if err := g.SetKeybinding("v2", rune(0x7a), gocui.ModNone, zapUserMenu); err != nil {
 		log.Panicln(err)
 	}
 
+	/* message requests (v2 requests page) */
+	// y key accepts the request
+	if err := g.SetKeybinding("v2", rune(0x79), gocui.ModNone, acceptRequest); err != nil {
+		log.Panicln(err)
+	}
+	// b key mutes the sender
+	if err := g.SetKeybinding("v2", rune(0x62), gocui.ModNone, muteRequest); err != nil {
+		log.Panicln(err)
+	}
+	// d key deletes the request
+	if err := g.SetKeybinding("v2", rune(0x64), gocui.ModNone, deleteRequest); err != nil {
+		log.Panicln(err)
+	}
+
 	/* addrelay view */
 	if err := g.SetKeybinding("v2", rune(0x61), gocui.ModNone, addRelay); err != nil {
 		log.Panicln(err)
@@ -68,6 +101,29 @@ func keybindings(g *gocui.Gui) error {
 		log.Panicln(err)
 	}
 
+	/* v3 link selection */
+	if err := g.SetKeybinding("v3", gocui.KeyArrowDown, gocui.ModNone, nextEntityV3); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("v3", gocui.KeyArrowUp, gocui.ModNone, prevEntityV3); err != nil {
+		log.Panicln(err)
+	}
+	// rune for "j"
+	if err := g.SetKeybinding("v3", rune(0x6a), gocui.ModNone, nextEntityV3); err != nil {
+		log.Panicln(err)
+	}
+	// rune for "k"
+	if err := g.SetKeybinding("v3", rune(0x6b), gocui.ModNone, prevEntityV3); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("v3", gocui.KeyEnter, gocui.ModNone, openEntityV3); err != nil {
+		log.Panicln(err)
+	}
+	// z key zaps the selected link
+	if err := g.SetKeybinding("v3", rune(0x7a), gocui.ModNone, zapEntityV3); err != nil {
+		log.Panicln(err)
+	}
+
 	/* v4 View (relays) */
 	/* v4 View (Relay List) */
 	// d key (delete)
@@ -94,6 +150,45 @@ func keybindings(g *gocui.Gui) error {
 	if err := g.SetKeybinding("v4", rune(0x61), gocui.ModNone, addRelay); err != nil {
 		log.Panicln(err)
 	}
+	// i key or Enter shows the relay's NIP-11 information
+	if err := g.SetKeybinding("v4", rune(0x69), gocui.ModNone, showRelayInfo); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("v4", gocui.KeyEnter, gocui.ModNone, showRelayInfo); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("relayinfo", gocui.KeyEsc, gocui.ModNone, closeRelayInfo); err != nil {
+		log.Panicln(err)
+	}
+	// o key sets the selected relay's proxy
+	if err := g.SetKeybinding("v4", rune(0x6f), gocui.ModNone, editRelayProxy); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("relayproxy", gocui.KeyEnter, gocui.ModNone, saveRelayProxy); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("relayproxy", gocui.KeyEsc, gocui.ModNone, cancelRelayProxy); err != nil {
+		log.Panicln(err)
+	}
+	// e key edits the selected relay's roles and policies
+	if err := g.SetKeybinding("v4", rune(0x65), gocui.ModNone, editRelayPolicy); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("relaypolicy", gocui.KeyEnter, gocui.ModNone, changeRelayPolicy); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("relaypolicy", gocui.KeySpace, gocui.ModNone, changeRelayPolicy); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("relaypolicy", gocui.KeyEsc, gocui.ModNone, cancelRelayPolicy); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("relaypolicy", gocui.KeyArrowDown, gocui.ModNone, cursorDown); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("relaypolicy", gocui.KeyArrowUp, gocui.ModNone, cursorUp); err != nil {
+		log.Panicln(err)
+	}
 
 	// add relay
 	if err := g.SetKeybinding("addrelay", gocui.KeyEnter, gocui.ModNone, doAddRelay); err != nil {
@@ -118,11 +213,40 @@ func keybindings(g *gocui.Gui) error {
 		log.Panicln(err)
 	}
 
+	// rune for "i" - toggle profile pictures
+	if err := g.SetKeybinding("v2", rune(0x69), gocui.ModNone, toggleAvatars); err != nil {
+		log.Panicln(err)
+	}
+
 	// rune for "p" - fetch by pubkey/npub
 	if err := g.SetKeybinding("", rune(0x70), gocui.ModNone, fetchByPubkey); err != nil {
 		log.Panicln(err)
 	}
 
+	// rune for "h" - relay health dashboard
+	if err := g.SetKeybinding("", rune(0x68), gocui.ModNone, relayDashboard); err != nil {
+		log.Panicln(err)
+	}
+	// s key cycles the sort column
+	if err := g.SetKeybinding("relayhealth", rune(0x73), gocui.ModNone, cycleRelayDashboardSort); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("relayhealth", rune(0x6a), gocui.ModNone, cursorDownRelayDashboard); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("relayhealth", rune(0x6b), gocui.ModNone, cursorUpRelayDashboard); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("relayhealth", gocui.KeyArrowDown, gocui.ModNone, cursorDownRelayDashboard); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("relayhealth", gocui.KeyArrowUp, gocui.ModNone, cursorUpRelayDashboard); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("relayhealth", gocui.KeyEsc, gocui.ModNone, closeRelayDashboard); err != nil {
+		log.Panicln(err)
+	}
+
 	// Enter key in fetchpubkey view
 	if err := g.SetKeybinding("fetchpubkey", gocui.KeyEnter, gocui.ModNone, doFetchByPubkey); err != nil {
 		log.Panicln(err)
@@ -137,6 +261,10 @@ func keybindings(g *gocui.Gui) error {
 	if err := g.SetKeybinding("fetchresults", gocui.KeyEsc, gocui.ModNone, closeFetchResults); err != nil {
 		log.Panicln(err)
 	}
+	// z key zaps the person or event being shown
+	if err := g.SetKeybinding("fetchresults", rune(0x7a), gocui.ModNone, zapFetchResults); err != nil {
+		log.Panicln(err)
+	}
 
 	/* config view for accounts */
 	//cancel key
@@ -178,6 +306,43 @@ func keybindings(g *gocui.Gui) error {
 	if err := g.SetKeybinding("config", rune(0x70), gocui.ModNone, configShowPrivateKey); err != nil {
 		log.Panicln(err)
 	}
+
+	// rune for "w" - wallet connect string
+	if err := g.SetKeybinding("config", rune(0x77), gocui.ModNone, configWallet); err != nil {
+		log.Panicln(err)
+	}
+
+	// rune for "b" - wallet balance and transactions
+	if err := g.SetKeybinding("config", rune(0x62), gocui.ModNone, walletInfo); err != nil {
+		log.Panicln(err)
+	}
+
+	if err := g.SetKeybinding("confignwc", gocui.KeyEnter, gocui.ModNone, doConfigWallet); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("confignwc", gocui.KeyEsc, gocui.ModNone, cancelConfigWallet); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("wallet", gocui.KeyEsc, gocui.ModNone, closeWallet); err != nil {
+		log.Panicln(err)
+	}
+
+	// rune for "z" - zap amount presets and default comment
+	if err := g.SetKeybinding("config", rune(0x7a), gocui.ModNone, configZapPresets); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("configzappresets", gocui.KeyEnter, gocui.ModNone, doConfigZapPresets); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("configzappresets", gocui.KeyEsc, gocui.ModNone, cancelConfigZap); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("configzapcomment", gocui.KeyEnter, gocui.ModNone, doConfigZapComment); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("configzapcomment", gocui.KeyEsc, gocui.ModNone, cancelConfigZap); err != nil {
+		log.Panicln(err)
+	}
 	/* config submenu (new/edit) */
 	//cancel key
 	if err := g.SetKeybinding("confignew", gocui.KeyEsc, gocui.ModNone, cancelConfigNew); err != nil {
@@ -209,11 +374,26 @@ func keybindings(g *gocui.Gui) error {
 		log.Panicln(err)
 	}
 
+	// r key (Edit Relay List)
+	if err := g.SetKeybinding("profile", rune(0x72), gocui.ModNone, editRelayList); err != nil {
+		log.Panicln(err)
+	}
+
+	// z key (Zap History)
+	if err := g.SetKeybinding("profile", rune(0x7a), gocui.ModNone, zapHistory); err != nil {
+		log.Panicln(err)
+	}
+
 	// ESC key (Cancel Profile Menu)
 	if err := g.SetKeybinding("profile", gocui.KeyEsc, gocui.ModNone, cancelProfile); err != nil {
 		log.Panicln(err)
 	}
 
+	// ESC key (Close Zap History)
+	if err := g.SetKeybinding("zaphistory", gocui.KeyEsc, gocui.ModNone, closeZapHistory); err != nil {
+		log.Panicln(err)
+	}
+
 	/* profile fields selection */
 	// Enter key (Select Field)
 	if err := g.SetKeybinding("profilefields", gocui.KeyEnter, gocui.ModNone, selectProfileField); err != nil {
@@ -286,6 +466,91 @@ func keybindings(g *gocui.Gui) error {
 
 	/* Remove old DM relays edit keybindings - these are no longer needed */
 
+	/* relay list (NIP-65) */
+	// n key (Add Relay)
+	if err := g.SetKeybinding("relaylist", rune(0x6e), gocui.ModNone, addRelayListEntry); err != nil {
+		log.Panicln(err)
+	}
+
+	// d key (Delete Relay)
+	if err := g.SetKeybinding("relaylist", rune(0x64), gocui.ModNone, deleteRelayListEntry); err != nil {
+		log.Panicln(err)
+	}
+
+	// m key (Cycle Read/Write Mode)
+	if err := g.SetKeybinding("relaylist", rune(0x6d), gocui.ModNone, cycleRelayListMode); err != nil {
+		log.Panicln(err)
+	}
+
+	// s key (Save and Publish Relay List)
+	if err := g.SetKeybinding("relaylist", rune(0x73), gocui.ModNone, saveRelayListChanges); err != nil {
+		log.Panicln(err)
+	}
+
+	// c key (Sync Relay Connections)
+	if err := g.SetKeybinding("relaylist", rune(0x63), gocui.ModNone, syncRelayStatuses); err != nil {
+		log.Panicln(err)
+	}
+
+	// ESC key (Cancel Relay List Edit)
+	if err := g.SetKeybinding("relaylist", gocui.KeyEsc, gocui.ModNone, cancelRelayListEdit); err != nil {
+		log.Panicln(err)
+	}
+
+	// Arrow keys for navigation
+	if err := g.SetKeybinding("relaylist", gocui.KeyArrowDown, gocui.ModNone, cursorDown); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("relaylist", gocui.KeyArrowUp, gocui.ModNone, cursorUp); err != nil {
+		log.Panicln(err)
+	}
+
+	// Enter key (Save New Relay)
+	if err := g.SetKeybinding("addrelaylist", gocui.KeyEnter, gocui.ModNone, saveNewRelayListEntry); err != nil {
+		log.Panicln(err)
+	}
+
+	// ESC key (Cancel Add Relay)
+	if err := g.SetKeybinding("addrelaylist", gocui.KeyEsc, gocui.ModNone, cancelAddRelayListEntry); err != nil {
+		log.Panicln(err)
+	}
+
+	/* contact groups menu */
+	if err := g.SetKeybinding("followsets", gocui.KeyEnter, gocui.ModNone, viewFollowSet); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("followsets", gocui.KeyEsc, gocui.ModNone, closeFollowSets); err != nil {
+		log.Panicln(err)
+	}
+	// a key (add highlighted person)
+	if err := g.SetKeybinding("followsets", rune(0x61), gocui.ModNone, addToFollowSet); err != nil {
+		log.Panicln(err)
+	}
+	// r key (remove highlighted person)
+	if err := g.SetKeybinding("followsets", rune(0x72), gocui.ModNone, removeFromFollowSet); err != nil {
+		log.Panicln(err)
+	}
+	// n key (new group)
+	if err := g.SetKeybinding("followsets", rune(0x6e), gocui.ModNone, newFollowSet); err != nil {
+		log.Panicln(err)
+	}
+	// d key (delete group)
+	if err := g.SetKeybinding("followsets", rune(0x64), gocui.ModNone, deleteFollowSet); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("followsets", gocui.KeyArrowDown, gocui.ModNone, cursorDown); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("followsets", gocui.KeyArrowUp, gocui.ModNone, cursorUp); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("followsetnew", gocui.KeyEnter, gocui.ModNone, doNewFollowSet); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("followsetnew", gocui.KeyEsc, gocui.ModNone, cancelNewFollowSet); err != nil {
+		log.Panicln(err)
+	}
+
 	/* posting view */
 	//cancel key
 	if err := g.SetKeybinding("v5", gocui.KeyEsc, gocui.ModNone, cancelInput); err != nil {
@@ -58,6 +58,25 @@ func profileMenu(g *gocui.Gui, v *gocui.View) error {
 		} else {
 			for _, relay := range dmRelays {
 				fmt.Fprintf(v, "  %s\n", relay.Url)
+				bf := giftWrapBackfill(relay.Url, account.Pubkey)
+				switch {
+				case bf.Done:
+					fmt.Fprintf(v, "    history loaded, %d gift wraps\n", bf.Fetched)
+				case bf.LastError != "":
+					fmt.Fprintf(v, "    history stopped at %s: %s\n", time.Unix(bf.Until, 0).Format("2006-01-02"), bf.LastError)
+				case bf.Pages > 0:
+					fmt.Fprintf(v, "    loading history, %d gift wraps back to %s\n", bf.Fetched, time.Unix(bf.Until, 0).Format("2006-01-02"))
+				}
+			}
+		}
+
+		fmt.Fprintf(v, "\nRelays (NIP-65):\n")
+		relays := ownRelayList(account.Pubkey)
+		if len(relays) == 0 {
+			fmt.Fprintf(v, "  No relay list published\n")
+		} else {
+			for _, relay := range relays {
+				fmt.Fprintf(v, "  %s (%s)\n", relay.Url, relayListMode(relay))
 			}
 		}
 
@@ -346,9 +365,13 @@ func saveProfileChanges(g *gocui.Gui, v *gocui.View) error {
 
 	// Publish to relays
 	TheLog.Println("Publishing metadata to relays...")
-	for _, relay := range nostrRelays {
+	for _, relay := range nostrPool.Relays() {
+		if !relayHasRole(relay.URL, relayRoleWrite) {
+			continue
+		}
 		ctx := context.Background()
 		err := relay.Publish(ctx, ev)
+		recordRelayPublish(relay.URL, err)
 		if err != nil {
 			TheLog.Printf("Error publishing metadata to relay %s: %v", relay.URL, err)
 		} else {
@@ -578,9 +601,13 @@ func saveDMRelaysChanges(g *gocui.Gui, v *gocui.View) error {
 
 	// Publish to relays
 	TheLog.Println("Publishing DM relay list to relays...")
-	for _, relay := range nostrRelays {
+	for _, relay := range nostrPool.Relays() {
+		if !relayHasRole(relay.URL, relayRoleWrite) {
+			continue
+		}
 		ctx := context.Background()
 		err := relay.Publish(ctx, ev)
+		recordRelayPublish(relay.URL, err)
 		if err != nil {
 			TheLog.Printf("Error publishing relay list to relay %s: %v", relay.URL, err)
 		} else {
@@ -13,7 +13,8 @@ import (
 // current page?
 var displayV2Meta []Metadata
 
-// 0 is the conversations results page, 1 is the search results page, 2 is the follows page
+// 0 is the conversations results page, 1 is the search results page, 2 is the follows page,
+// 3 is the message requests page, 4 is the members of activeFollowSetID
 var v2MetaDisplay = 0
 
 // wrapText wraps text to fit within a given width, preserving words
@@ -47,6 +48,16 @@ func refreshAll(g *gocui.Gui, v *gocui.View) error {
 
 func refreshV2Conversations(g *gocui.Gui, v *gocui.View) error {
 	v2MetaDisplay = 0
+	return refreshV2ConversationList(g, false)
+}
+
+// refreshV2Requests displays conversations from senders outside our network
+func refreshV2Requests(g *gocui.Gui, v *gocui.View) error {
+	v2MetaDisplay = 3
+	return refreshV2ConversationList(g, true)
+}
+
+func refreshV2ConversationList(g *gocui.Gui, showRequests bool) error {
 	v2, _ := g.View("v2")
 	_, oldCursor := v2.Cursor()
 	v2.Clear()
@@ -65,13 +76,27 @@ func refreshV2Conversations(g *gocui.Gui, v *gocui.View) error {
 		conversations[message.FromPubkey] = append(conversations[message.FromPubkey], message)
 	}
 
+	trusted := trustedSenders(account)
+	states := conversationStates(account)
+
 	// print the pubkeys we have conversations with
 	newV2meta := []Metadata{}
+	requestCount := 0
 	for pubkey, _ := range conversations {
 		if pubkey == account.Pubkey {
 			// skip ourselves
 			continue
 		}
+		if s, ok := states[pubkey]; ok && s.State == conversationMuted {
+			continue
+		}
+		isRequest := isRequestSender(pubkey, trusted, states)
+		if isRequest {
+			requestCount++
+		}
+		if isRequest != showRequests {
+			continue
+		}
 		m := Metadata{}
 		if err := DB.First(&m, "pubkey_hex = ?", pubkey).Error; err != nil {
 			TheLog.Printf("error getting metadata for pubkey: %s, %s", pubkey, err)
@@ -85,7 +110,11 @@ func refreshV2Conversations(g *gocui.Gui, v *gocui.View) error {
 		newV2meta = append(newV2meta, m)
 	}
 
-	v2.Title = fmt.Sprintf("Pubkey navigator - active conversations (%d)", len(newV2meta))
+	if showRequests {
+		v2.Title = fmt.Sprintf("Pubkey navigator - message requests (%d)", len(newV2meta))
+	} else {
+		v2.Title = fmt.Sprintf("Pubkey navigator - active conversations (%d) - requests (%d)", len(newV2meta), requestCount)
+	}
 
 	// sort by most recent chatMessage
 	sort.Slice(newV2meta, func(i, j int) bool {
@@ -100,6 +129,13 @@ func refreshV2Conversations(g *gocui.Gui, v *gocui.View) error {
 		return conversationLatest1[len(conversationLatest1)-1].Timestamp.After(conversationLatest2[len(conversationLatest2)-1].Timestamp)
 	})
 
+	// sorting needs every score, otherwise only the page shown is loaded
+	var scores map[string]WotScore
+	if v2SortByWot {
+		scores = loadWotScores(account.Pubkey, metadataPubkeys(newV2meta))
+		sortByWot(newV2meta, scores)
+	}
+
 	v2Meta = newV2meta
 
 	_, vSizeY := v2.Size()
@@ -113,17 +149,10 @@ func refreshV2Conversations(g *gocui.Gui, v *gocui.View) error {
 	displayV2Meta = v2Meta[CurrOffset:endIdx]
 
 	// Display the metadata
-	for _, metadata := range displayV2Meta {
-		if metadata.Nip05 != "" {
-			fmt.Fprintf(v2, "%-30s %-30s\n", metadata.Name, metadata.Nip05)
-		} else if metadata.Name != "" {
-			fmt.Fprintf(v2, "%-30s\n", metadata.Name)
-		} else if metadata.DisplayName != "" {
-			fmt.Fprintf(v2, "%-30s\n", metadata.DisplayName)
-		} else {
-			fmt.Fprintf(v2, "%-30s\n", metadata.PubkeyHex)
-		}
+	if scores == nil {
+		scores = loadWotScores(account.Pubkey, metadataPubkeys(displayV2Meta))
 	}
+	printV2Rows(v2, displayV2Meta, scores)
 
 	v2.SetCursor(0, oldCursor)
 
@@ -139,6 +168,35 @@ func refreshV2Conversations(g *gocui.Gui, v *gocui.View) error {
 	return nil
 }
 
+// printV2Rows writes one navigator line per metadata: name, nip-05 with its
+// verification marker (✓ verified, ✗ failed, ? unchecked), then wot
+func printV2Rows(v2 *gocui.View, metas []Metadata, scores map[string]WotScore) {
+	pubkeys := metadataPubkeys(metas)
+	checks := loadNip05Checks(pubkeys)
+	nip05Want(pubkeys...)
+	for _, metadata := range metas {
+		label := metadata.PubkeyHex
+		if metadata.Name != "" {
+			label = metadata.Name
+		} else if metadata.DisplayName != "" {
+			label = metadata.DisplayName
+		}
+		nip05 := ""
+		if metadata.Nip05 != "" {
+			nip05 = nip05Marker(nip05Status(checks, metadata)) + " " + metadata.Nip05
+		}
+		fmt.Fprintf(v2, "%-30s %-32s %s\n", label, nip05, wotLabel(scores, metadata.PubkeyHex))
+	}
+}
+
+func metadataPubkeys(metas []Metadata) []string {
+	pubkeys := make([]string, 0, len(metas))
+	for _, m := range metas {
+		pubkeys = append(pubkeys, m.PubkeyHex)
+	}
+	return pubkeys
+}
+
 func onlyRefreshConversation() {
 	g := TheGui
 	v2, _ := g.View("v2")
@@ -164,6 +222,10 @@ func refreshUIAfterNewMessage() {
 
 // Helper function to perform the actual refresh
 func refreshNow() {
+	// background jobs may finish before the UI is up
+	if TheGui == nil {
+		return
+	}
 	TheGui.Update(func(g *gocui.Gui) error {
 		// Refresh the conversation view
 		v2, err := g.View("v2")
@@ -176,6 +238,37 @@ func refreshNow() {
 	})
 }
 
+// relayStatusSymbol is the short form of a RelayStatus.Status
+func relayStatusSymbol(status string) string {
+	if status == "connection established" {
+		return "⌛✅"
+	} else if status == "connection established: EOSE" {
+		return "✅"
+	} else if status == "waiting" {
+		return "⌛"
+	} else if status == "idle" {
+		return "💤"
+	} else if status == "disabled" {
+		return "⏸️"
+	}
+	return "❌"
+}
+
+// refreshV4Retries redraws v4 from a goroutine, keeping relay retry countdowns current
+func refreshV4Retries() {
+	if TheGui == nil {
+		return
+	}
+	TheGui.Update(func(g *gocui.Gui) error {
+		v2, err := g.View("v2")
+		if err != nil {
+			return nil
+		}
+		_, cy := v2.Cursor()
+		return refreshV4(g, cy)
+	})
+}
+
 func refreshV2(g *gocui.Gui, v *gocui.View) error {
 	v2, err := g.View("v2")
 	if err != nil {
@@ -214,7 +307,12 @@ func refreshV2(g *gocui.Gui, v *gocui.View) error {
 		}
 	}
 
-	// sort by recent ChatMessages
+	// rank by web-of-trust so impersonators sharing a name sink to the bottom
+	var scores map[string]WotScore
+	if searchTerm != "" || v2SortByWot {
+		scores = loadWotScores(account.Pubkey, metadataPubkeys(curFollows))
+		sortByWot(curFollows, scores)
+	}
 
 	v2Meta = curFollows
 
@@ -229,15 +327,10 @@ func refreshV2(g *gocui.Gui, v *gocui.View) error {
 	displayV2Meta = v2Meta[CurrOffset:endIdx]
 
 	// Display the metadata
-	for _, metadata := range displayV2Meta {
-		if metadata.Nip05 != "" {
-			fmt.Fprintf(v2, "%-30s %-30s\n", metadata.Name, metadata.Nip05)
-		} else if metadata.Name != "" {
-			fmt.Fprintf(v2, "%-30s\n", metadata.Name)
-		} else {
-			fmt.Fprintf(v2, "%-30s\n", metadata.PubkeyHex)
-		}
+	if scores == nil {
+		scores = loadWotScores(account.Pubkey, metadataPubkeys(displayV2Meta))
 	}
+	printV2Rows(v2, displayV2Meta, scores)
 
 	return nil
 }
@@ -303,6 +396,12 @@ func refreshV2Follows(g *gocui.Gui, v *gocui.View) error {
 		v2Meta = curFollows
 	}
 
+	var scores map[string]WotScore
+	if v2SortByWot {
+		scores = loadWotScores(account.Pubkey, metadataPubkeys(v2Meta))
+		sortByWot(v2Meta, scores)
+	}
+
 	_, vSizeY := v2.Size()
 	maxDisplay := vSizeY - 1
 
@@ -314,15 +413,10 @@ func refreshV2Follows(g *gocui.Gui, v *gocui.View) error {
 	displayV2Meta = v2Meta[CurrOffset:endIdx]
 
 	// Display the metadata
-	for _, metadata := range displayV2Meta {
-		if metadata.Nip05 != "" {
-			fmt.Fprintf(v2, "%-30s %-30s\n", metadata.Name, metadata.Nip05)
-		} else if metadata.Name != "" {
-			fmt.Fprintf(v2, "%-30s\n", metadata.Name)
-		} else {
-			fmt.Fprintf(v2, "%-30s\n", metadata.PubkeyHex)
-		}
+	if scores == nil {
+		scores = loadWotScores(account.Pubkey, metadataPubkeys(displayV2Meta))
 	}
+	printV2Rows(v2, displayV2Meta, scores)
 
 	return nil
 }
@@ -347,8 +441,11 @@ func refreshV3(g *gocui.Gui, cy int) error {
 
 	// If there are no items or cursor is out of bounds, return
 	if len(displayV2Meta) == 0 || cy >= len(displayV2Meta) {
+		resetV3Entities("")
 		return nil
 	}
+	resetV3Entities(displayV2Meta[cy].PubkeyHex)
+	selecting := g.CurrentView() != nil && g.CurrentView().Name() == "v3"
 
 	var account Account
 	DB.First(&account, "active = ?", true)
@@ -376,26 +473,78 @@ func refreshV3(g *gocui.Gui, cy int) error {
 	contentWidth := width - 10
 
 	var buffer strings.Builder
+	writeConversationHeader(g, &buffer, account, displayV2Meta[cy])
 	for _, message := range allMessages {
 		humanTime := message.Timestamp.Format("Jan _2 3:04 PM")
 		if message.FromPubkey == displayV2Meta[cy].PubkeyHex {
 			header := fmt.Sprintf("\x1b[1;40m%s (%s):\x1b[0m\n", displayV2Meta[cy].Name, humanTime)
 			buffer.WriteString(header)
-			wrappedContent := wrapText(message.Content, contentWidth)
+			wrappedContent := renderMessageContent(g, message.Content, contentWidth, selecting)
 			buffer.WriteString(wrappedContent)
 			buffer.WriteString("\n\n")
 		} else {
 			header := fmt.Sprintf("\x1b[1;104m-> (%s)\x1b[0m\n", humanTime)
 			buffer.WriteString(header)
-			wrappedContent := wrapText(message.Content, contentWidth)
+			wrappedContent := renderMessageContent(g, message.Content, contentWidth, selecting)
 			buffer.WriteString(wrappedContent)
 			buffer.WriteString("\n\n")
 		}
 	}
 	v3.Write([]byte(buffer.String()))
+
+	if len(v3Entities) > 0 {
+		v3.Title = fmt.Sprintf("Conversation - %d links, TAB here then ↑/↓ to select, ENTER to open, Z to zap", len(v3Entities))
+	} else {
+		v3.Title = "Conversation"
+	}
 	return nil
 }
 
+// writeConversationHeader puts the contact's avatar, name and the zaps
+// exchanged above the messages
+func writeConversationHeader(g *gocui.Gui, buffer *strings.Builder, account Account, meta Metadata) {
+	writeConversationAvatar(g, buffer, meta)
+
+	sent, received := conversationZapTotals(account.Pubkey, meta.PubkeyHex)
+	if sent > 0 || received > 0 {
+		fmt.Fprintf(buffer, "⚡ you zapped %d sats, they zapped you %d sats\n\n", sent/1000, received/1000)
+	}
+}
+
+// writeConversationAvatar draws the contact's avatar. v3 is redrawn on every
+// message, so it always uses half blocks rather than a graphics protocol.
+func writeConversationAvatar(g *gocui.Gui, buffer *strings.Builder, meta Metadata) {
+	if !avatarsEnabled || meta.Picture == "" {
+		return
+	}
+	img := cachedAvatar(meta.PubkeyHex, meta.Picture)
+	if img == nil {
+		requestAvatar(meta.PubkeyHex, meta.Picture, func() {
+			g.Update(func(g *gocui.Gui) error {
+				v2, err := g.View("v2")
+				if err != nil {
+					return nil
+				}
+				_, cy := v2.Cursor()
+				if cy < len(displayV2Meta) && displayV2Meta[cy].PubkeyHex == meta.PubkeyHex {
+					return refreshV3(g, cy)
+				}
+				return nil
+			})
+		})
+		return
+	}
+	info := []string{"", meta.Name, meta.DisplayName, meta.Nip05}
+	for i, line := range halfBlockAvatar(img, 8, 4) {
+		buffer.WriteString(line)
+		if i < len(info) && info[i] != "" {
+			buffer.WriteString("  " + info[i])
+		}
+		buffer.WriteString("\n")
+	}
+	buffer.WriteString("\n")
+}
+
 func refreshV4(g *gocui.Gui, cursor int) error {
 	v4, err := g.View("v4")
 	if err != nil {
@@ -416,6 +565,8 @@ func refreshV4(g *gocui.Gui, cursor int) error {
 	fmt.Fprintf(v4, "My DM relays:\n")
 	for _, relay := range myDMRelays {
 		fmt.Fprintf(v4, "%s\n", relay.Url)
+		// one word, the delete key reads the second word of a line as a relay
+		fmt.Fprintf(v4, "  %s\n", backfillProgress(giftWrapBackfill(relay.Url, account.Pubkey)))
 	}
 
 	if len(displayV2Meta) == 0 || cursor >= len(displayV2Meta) {
@@ -432,36 +583,38 @@ func refreshV4(g *gocui.Gui, cursor int) error {
 
 	var RelayStatuses []RelayStatus
 	DB.Find(&RelayStatuses)
-	fmt.Fprintf(v4, "\nConnected relays:\n")
+	switch {
+	case globalProxy != "" && proxyStrict:
+		fmt.Fprintf(v4, "\nConnected relays (via %s, strict):\n", globalProxy)
+	case globalProxy != "":
+		fmt.Fprintf(v4, "\nConnected relays (via %s):\n", globalProxy)
+	case proxyStrict:
+		fmt.Fprintf(v4, "\nConnected relays (strict, no proxy set):\n")
+	default:
+		fmt.Fprintf(v4, "\nConnected relays:\n")
+	}
 	for _, relayStatus := range RelayStatuses {
-		var shortStatus string
-		if relayStatus.Status == "connection established" {
-			shortStatus = "⌛✅"
-		} else if relayStatus.Status == "connection established: EOSE" {
-			shortStatus = "✅"
-		} else if relayStatus.Status == "waiting" {
-			shortStatus = "⌛"
-		} else {
-			shortStatus = "❌"
+		shortStatus := relayStatusSymbol(relayStatus.Status)
+		retry := ""
+		if wait := time.Until(relayStatus.NextRetry); !relayStatus.NextRetry.IsZero() {
+			if wait < 0 {
+				wait = 0
+			}
+			retry = fmt.Sprintf(" (retry %d in %s)", relayStatus.RetryCount, wait.Round(time.Second))
+		}
+		if label := relayProxyLabel(relayStatus); label != "" {
+			retry += " " + label
+		}
+		if label := relayPolicyLabel(relayStatus); label != "" {
+			retry += " " + label
 		}
-		fmt.Fprintf(v4, "%s %s\n", shortStatus, relayStatus.Url)
+		fmt.Fprintf(v4, "%s %s%s\n", shortStatus, relayStatus.Url, retry)
 	}
 
 	/*
-		fmt.Fprintf(v4, "nostrRelays\n")
-		for _, r := range nostrRelays {
-			fmt.Fprintf(v4, "%s:%v\n", r.URL, r.IsConnected())
-		}
-
-		fmt.Fprintf(v4, "num subs %d\n", len(nostrSubs))
-		for _, s := range nostrSubs {
-
-			fmt.Fprintf(v4, "numfilters: %d", len(s.Filters))
-			for _, f := range s.Filters {
-				fmt.Fprintf(v4, "kinds %v\n", f.Kinds)
-			}
-
-			//fmt.Fprintf(v4, "%s, %v\n", s.GetID(), s.Filters)
+		fmt.Fprintf(v4, "nostrPool\n")
+		for _, url := range nostrPool.URLs() {
+			fmt.Fprintf(v4, "%s:%v subs %d\n", url, nostrPool.Relay(url) != nil, nostrPool.SubscriptionCount(url))
 		}
 	*/
 
@@ -547,7 +700,25 @@ func updateKeybindsView(g *gocui.Gui) error {
 	m := fmt.Sprintf("(%s)anage profile", fmt.Sprintf(ActionColor, "M"))
 	theme := fmt.Sprintf("(%s)witch theme: %s", fmt.Sprintf(ActionColor, "X"), activeTheme.Name)
 
-	fmt.Fprintf(v5, "%-40s%-40s%-40s-%40s\n\n", w, tt, m, theme)
+	wot := fmt.Sprintf("(%s)oT sort: %v", fmt.Sprintf(ActionColor, "W"), v2SortByWot)
+
+	fmt.Fprintf(v5, "%-40s%-40s%-40s%-40s%-40s\n", w, tt, m, theme, wot)
+
+	// Fourth row only applies to the message requests page
+	if v2MetaDisplay == 3 {
+		accept := fmt.Sprintf("(%s) accept request", fmt.Sprintf(ActionColor, "Y"))
+		mute := fmt.Sprintf("(%s) mute sender", fmt.Sprintf(ActionColor, "B"))
+		del := fmt.Sprintf("(%s)elete request", fmt.Sprintf(ActionColor, "D"))
+		health := fmt.Sprintf("relay (%s)ealth", fmt.Sprintf(ActionColor, "H"))
+		fmt.Fprintf(v5, "%-40s%-40s%-40s%-40s\n", accept, mute, del, health)
+	} else {
+		follow := fmt.Sprintf("f(%s)llow", fmt.Sprintf(ActionColor, "O"))
+		unfollow := fmt.Sprintf("(%s)nfollow", fmt.Sprintf(ActionColor, "U"))
+		groups := fmt.Sprintf("(%s)roups", fmt.Sprintf(ActionColor, "G"))
+		images := fmt.Sprintf("(%s)mages: %v", fmt.Sprintf(ActionColor, "I"), avatarsEnabled)
+		health := fmt.Sprintf("relay (%s)ealth", fmt.Sprintf(ActionColor, "H"))
+		fmt.Fprintf(v5, "%-40s%-40s%-40s%-40s%-40s\n", follow, unfollow, groups, images, health)
+	}
 
 	return nil
 }
@@ -594,6 +765,11 @@ func updateMainConfigKeybindsView(g *gocui.Gui) error {
 	fmt.Fprintf(v5, "%-40s%-40s%-40s\n", use, cancel, new)
 	fmt.Fprintf(v5, "%-40s%-40s%-40s\n", delete, generate, reveal)
 
+	wallet := fmt.Sprintf("(%s)allet connect", fmt.Sprintf(ActionColor, "W"))
+	balance := fmt.Sprintf("(%s)alance", fmt.Sprintf(ActionColor, "B"))
+	zaps := fmt.Sprintf("(%s)ap presets", fmt.Sprintf(ActionColor, "Z"))
+	fmt.Fprintf(v5, "%-40s%-40s%-40s\n", wallet, balance, zaps)
+
 	return nil
 }
 
@@ -630,9 +806,12 @@ func updateProfileKeybindsView(g *gocui.Gui) error {
 	// Profile menu keybinds
 	edit := fmt.Sprintf("(%s)dit Metadata", fmt.Sprintf(ActionColor, "e"))
 	dmRelays := fmt.Sprintf("(%s)m Relays", fmt.Sprintf(ActionColor, "d"))
+	relayList := fmt.Sprintf("(%s)elay List", fmt.Sprintf(ActionColor, "r"))
+	zaps := fmt.Sprintf("(%s)ap History", fmt.Sprintf(ActionColor, "z"))
 	cancel := fmt.Sprintf("(%s) Cancel", fmt.Sprintf(ActionColor, "Esc"))
 
-	fmt.Fprintf(v5, "%-40s%-40s%-40s\n", edit, dmRelays, cancel)
+	fmt.Fprintf(v5, "%-40s%-40s%-40s\n", edit, dmRelays, relayList)
+	fmt.Fprintf(v5, "%-40s%-40s\n", zaps, cancel)
 
 	return nil
 }
@@ -701,6 +880,31 @@ func updateDMRelaysKeybindsView(g *gocui.Gui) error {
 	return nil
 }
 
+// updateRelayListKeybindsView updates the keybinds view (v5) with keybinds for the relay list (NIP-65)
+func updateRelayListKeybindsView(g *gocui.Gui) error {
+	v5, err := g.View("v5")
+	if err != nil {
+		return err
+	}
+
+	v5.Clear()
+	// Use the action highlight color (orange-yellow #ffaf00) instead of cyan
+	ActionColor := fmt.Sprintf("\033[38;2;%d;%d;%dm%%s\033[0m", 0xff, 0xaf, 0x00)
+
+	// Relay list keybinds
+	add := fmt.Sprintf("(%s)ew Relay", fmt.Sprintf(ActionColor, "n"))
+	delete := fmt.Sprintf("(%s)elete Relay", fmt.Sprintf(ActionColor, "d"))
+	mode := fmt.Sprintf("(%s)ode read/write", fmt.Sprintf(ActionColor, "m"))
+	save := fmt.Sprintf("(%s)ave and Publish", fmt.Sprintf(ActionColor, "s"))
+	sync := fmt.Sprintf("(%s)onnect to these relays only", fmt.Sprintf(ActionColor, "c"))
+	cancel := fmt.Sprintf("(%s) Cancel", fmt.Sprintf(ActionColor, "Esc"))
+
+	fmt.Fprintf(v5, "%-40s%-40s%-40s\n", add, delete, mode)
+	fmt.Fprintf(v5, "%-40s%-40s%-40s\n", save, sync, cancel)
+
+	return nil
+}
+
 // updateAddDMRelayKeybindsView updates the keybinds view (v5) with keybinds for adding a new DM relay
 func updateAddDMRelayKeybindsView(g *gocui.Gui) error {
 	v5, err := g.View("v5")
@@ -721,12 +925,41 @@ func updateAddDMRelayKeybindsView(g *gocui.Gui) error {
 	return nil
 }
 
+// updateFollowSetsKeybindsView updates the keybinds view (v5) with keybinds for the contact groups menu
+func updateFollowSetsKeybindsView(g *gocui.Gui) error {
+	v5, err := g.View("v5")
+	if err != nil {
+		return err
+	}
+
+	v5.Clear()
+	// Use the action highlight color (orange-yellow #ffaf00) instead of cyan
+	ActionColor := fmt.Sprintf("\033[38;2;%d;%d;%dm%%s\033[0m", 0xff, 0xaf, 0x00)
+
+	// Contact groups keybinds
+	show := fmt.Sprintf("(%s) Show members", fmt.Sprintf(ActionColor, "Enter"))
+	add := fmt.Sprintf("(%s)dd highlighted person", fmt.Sprintf(ActionColor, "a"))
+	remove := fmt.Sprintf("(%s)emove highlighted person", fmt.Sprintf(ActionColor, "r"))
+	newSet := fmt.Sprintf("(%s)ew group", fmt.Sprintf(ActionColor, "n"))
+	del := fmt.Sprintf("(%s)elete group", fmt.Sprintf(ActionColor, "d"))
+	cancel := fmt.Sprintf("(%s) Cancel", fmt.Sprintf(ActionColor, "Esc"))
+
+	fmt.Fprintf(v5, "%-40s%-40s%-40s\n", show, add, remove)
+	fmt.Fprintf(v5, "%-40s%-40s%-40s\n", newSet, del, cancel)
+
+	return nil
+}
+
 func refreshAllViews(g *gocui.Gui, v *gocui.View) error {
 	// Refresh v2 based on current display mode
 	if v2MetaDisplay == 0 {
 		refreshV2Conversations(g, v)
 	} else if v2MetaDisplay == 2 {
 		refreshV2Follows(g, v)
+	} else if v2MetaDisplay == 3 {
+		refreshV2Requests(g, v)
+	} else if v2MetaDisplay == 4 {
+		refreshV2FollowSet(g, v)
 	} else {
 		refreshV2(g, v)
 	}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// relayHealthSorts are the orders the relay dashboard cycles through
+var relayHealthSorts = []string{"url", "connect time", "EOSE time", "events", "errors", "drops"}
+
+var relayHealthSort int
+var relayHealthCursor int
+
+// relayHealthRow is one relay on the dashboard: this session's counters and
+// its daily history, newest day first
+type relayHealthRow struct {
+	url    string
+	status string
+	health relayHealth
+	days   []RelayHealthDay
+	drops  int
+	errors int
+}
+
+// relayHealthRows gathers every configured relay and every relay seen this session
+func relayHealthRows() []relayHealthRow {
+	// counters still in memory go into the history first, so it is complete
+	flushRelayHealth()
+
+	snapshot := relayHealthSnapshot()
+	rows := make(map[string]*relayHealthRow)
+	var statuses []RelayStatus
+	DB.Find(&statuses)
+	for _, rs := range statuses {
+		url := normalizeRelayURL(rs.Url)
+		if url == "" {
+			continue
+		}
+		rows[url] = &relayHealthRow{url: url, status: rs.Status}
+	}
+	for url := range snapshot {
+		if _, ok := rows[url]; !ok {
+			rows[url] = &relayHealthRow{url: url}
+		}
+	}
+
+	urls := make([]string, 0, len(rows))
+	for url, row := range rows {
+		row.health = snapshot[url]
+		urls = append(urls, url)
+	}
+	var days []RelayHealthDay
+	DB.Where("url IN ?", urls).Order("day desc").Find(&days)
+	for _, day := range days {
+		if row, ok := rows[day.Url]; ok {
+			row.days = append(row.days, day)
+			row.drops += day.Disconnects
+			row.errors += day.Errors
+		}
+	}
+
+	sorted := make([]relayHealthRow, 0, len(rows))
+	for _, row := range rows {
+		sorted = append(sorted, *row)
+	}
+	sortRelayHealthRows(sorted)
+	return sorted
+}
+
+// sortRelayHealthRows orders rows by the selected column, worst first
+func sortRelayHealthRows(rows []relayHealthRow) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		switch relayHealthSorts[relayHealthSort] {
+		case "connect time":
+			if a.health.ConnectLatency != b.health.ConnectLatency {
+				return a.health.ConnectLatency > b.health.ConnectLatency
+			}
+		case "EOSE time":
+			if a.health.EOSELatency != b.health.EOSELatency {
+				return a.health.EOSELatency > b.health.EOSELatency
+			}
+		case "events":
+			if a.health.Events != b.health.Events {
+				return a.health.Events > b.health.Events
+			}
+		case "errors":
+			if a.errors != b.errors {
+				return a.errors > b.errors
+			}
+		case "drops":
+			if a.drops != b.drops {
+				return a.drops > b.drops
+			}
+		}
+		return a.url < b.url
+	})
+}
+
+// formatMillis shows a duration in ms, or - when nothing was measured
+func formatMillis(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%dms", d.Milliseconds())
+}
+
+// averageMillis shows total/count in ms, or - when count is 0
+func averageMillis(total int64, count int) string {
+	if count == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%dms", total/int64(count))
+}
+
+// relayDashboard shows the health of every relay
+func relayDashboard(g *gocui.Gui, v *gocui.View) error {
+	maxX, maxY := g.Size()
+	dv, err := g.SetView("relayhealth", 1, 1, maxX-2, maxY-7, 0)
+	if err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+		dv.Wrap = false
+		dv.BgColor = activeTheme.Bg
+		dv.FgColor = activeTheme.Fg
+		relayHealthCursor = 0
+	}
+	if _, err := g.SetCurrentView("relayhealth"); err != nil {
+		return err
+	}
+	return refreshRelayDashboard(g)
+}
+
+func refreshRelayDashboard(g *gocui.Gui) error {
+	dv, err := g.View("relayhealth")
+	if err != nil {
+		return err
+	}
+	dv.Clear()
+	dv.Title = fmt.Sprintf("Relay health, sorted by %s - (S)ort (J/K) select (ESC) close", relayHealthSorts[relayHealthSort])
+
+	rows := relayHealthRows()
+	if len(rows) == 0 {
+		fmt.Fprintf(dv, "No relays yet\n")
+		return nil
+	}
+	if relayHealthCursor >= len(rows) {
+		relayHealthCursor = len(rows) - 1
+	}
+
+	fmt.Fprintf(dv, "  %-40s %-4s %8s %8s %7s %9s %6s %6s %9s %5s %5s\n", "Relay", "St", "Connect", "EOSE",
+		"Events", "Publish", "CLOSED", "NOTICE", "Auth", "Drops", "Errs")
+	fmt.Fprintf(dv, "  %-40s %-4s %8s %8s %7s %9s %6s %6s %9s %5s %5s\n", "", "", "", "", "", "ok/fail",
+		"", "", "ok/fail", fmt.Sprintf("%dd", relayHealthDays), fmt.Sprintf("%dd", relayHealthDays))
+	for i, row := range rows {
+		marker := " "
+		if i == relayHealthCursor {
+			marker = ">"
+		}
+		h := row.health
+		fmt.Fprintf(dv, "%s %-40s %-4s %8s %8s %7d %9s %6d %6d %9s %5d %5d\n", marker,
+			previewText(row.url, 40), relayStatusSymbol(row.status), formatMillis(h.ConnectLatency),
+			formatMillis(h.EOSELatency), h.Events, fmt.Sprintf("%d/%d", h.PublishOK, h.PublishFail),
+			h.Closed, h.Notices, fmt.Sprintf("%d/%d", h.AuthOK, h.AuthFail), row.drops, row.errors)
+	}
+
+	writeRelayHealthDetail(dv, rows[relayHealthCursor])
+	return nil
+}
+
+// writeRelayHealthDetail prints the selected relay's messages, event kinds and history
+func writeRelayHealthDetail(dv *gocui.View, row relayHealthRow) {
+	h := row.health
+	fmt.Fprintf(dv, "\n%s\n", row.url)
+	if row.status != "" {
+		fmt.Fprintf(dv, "  status:      %s\n", row.status)
+	}
+	if h.LastError != "" {
+		fmt.Fprintf(dv, "  last error:  %s (%s)\n", h.LastError, h.LastErrorAt.Format("2006-01-02 15:04:05"))
+	} else if len(row.days) > 0 && row.days[0].LastError != "" {
+		fmt.Fprintf(dv, "  last error:  %s (%s)\n", row.days[0].LastError, row.days[0].Day)
+	}
+	if h.LastNotice != "" {
+		fmt.Fprintf(dv, "  last NOTICE: %s\n", h.LastNotice)
+	}
+	if h.LastClosed != "" {
+		fmt.Fprintf(dv, "  last CLOSED: %s\n", h.LastClosed)
+	}
+	fmt.Fprintf(dv, "  connects:    %d ok, %d failed, %d dropped this session\n", h.Connects, h.ConnectFails, h.Disconnects)
+
+	if len(h.EventsByKind) > 0 {
+		kinds := make([]int, 0, len(h.EventsByKind))
+		for kind := range h.EventsByKind {
+			kinds = append(kinds, kind)
+		}
+		sort.Slice(kinds, func(i, j int) bool {
+			if h.EventsByKind[kinds[i]] != h.EventsByKind[kinds[j]] {
+				return h.EventsByKind[kinds[i]] > h.EventsByKind[kinds[j]]
+			}
+			return kinds[i] < kinds[j]
+		})
+		var parts []string
+		for _, kind := range kinds {
+			parts = append(parts, fmt.Sprintf("%d:%d", kind, h.EventsByKind[kind]))
+		}
+		fmt.Fprintf(dv, "  events by kind: %s\n", strings.Join(parts, "  "))
+	}
+
+	if len(row.days) == 0 {
+		return
+	}
+	fmt.Fprintf(dv, "\n  %-10s %8s %5s %5s %8s %8s %7s %9s %6s %6s %9s %5s\n", "Day", "Connects", "Fails",
+		"Drops", "Connect", "EOSE", "Events", "Publish", "CLOSED", "NOTICE", "Auth", "Errs")
+	for _, day := range row.days {
+		fmt.Fprintf(dv, "  %-10s %8d %5d %5d %8s %8s %7d %9s %6d %6d %9s %5d\n", day.Day, day.Connects,
+			day.ConnectFails, day.Disconnects, averageMillis(day.ConnectMillis, day.Connects),
+			averageMillis(day.EOSEMillis, day.EOSEs), day.Events, fmt.Sprintf("%d/%d", day.PublishOK, day.PublishFail),
+			day.Closed, day.Notices, fmt.Sprintf("%d/%d", day.AuthOK, day.AuthFail), day.Errors)
+	}
+}
+
+func cursorDownRelayDashboard(g *gocui.Gui, v *gocui.View) error {
+	relayHealthCursor++
+	return refreshRelayDashboard(g)
+}
+
+func cursorUpRelayDashboard(g *gocui.Gui, v *gocui.View) error {
+	if relayHealthCursor > 0 {
+		relayHealthCursor--
+	}
+	return refreshRelayDashboard(g)
+}
+
+// cycleRelayDashboardSort switches to the next sort column
+func cycleRelayDashboardSort(g *gocui.Gui, v *gocui.View) error {
+	relayHealthSort = (relayHealthSort + 1) % len(relayHealthSorts)
+	relayHealthCursor = 0
+	return refreshRelayDashboard(g)
+}
+
+func closeRelayDashboard(g *gocui.Gui, v *gocui.View) error {
+	g.DeleteView("relayhealth")
+	g.SetCurrentView("v2")
+	return nil
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/awesome-gocui/gocui"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ownRelayList is the NIP-65 relay list of pubkey, in the order it is shown
+func ownRelayList(pubkey string) []RelayList {
+	var relays []RelayList
+	DB.Where("pubkey_hex = ?", pubkey).Order("id").Find(&relays)
+	return relays
+}
+
+// relayListMode describes the read/write marker of a relay list entry
+func relayListMode(r RelayList) string {
+	switch {
+	case r.Read && !r.Write:
+		return "read"
+	case r.Write && !r.Read:
+		return "write"
+	}
+	return "read+write"
+}
+
+// touchOwnRelayList marks our stored list as newer than anything on the
+// relays, so unpublished edits aren't replaced by our previous kind 10002
+func touchOwnRelayList(pubkey string) {
+	DB.Model(&RelayList{}).Where("pubkey_hex = ?", pubkey).Update("event_created_at", time.Now())
+}
+
+// editRelayList opens our read/write relay list (NIP-65)
+func editRelayList(g *gocui.Gui, v *gocui.View) error {
+	maxX, maxY := g.Size()
+	g.DeleteView("profile")
+	g.DeleteView("relaylist")
+	// Position the view from the top of the screen (y=0) to above the keybinds view (v5)
+	if v, err := g.SetView("relaylist", maxX/2-40, 0, maxX/2+40, maxY-7, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+
+		var account Account
+		DB.Where("active = ?", true).First(&account)
+		if account.Pubkey == "" {
+			return fmt.Errorf("no active account found")
+		}
+
+		v.Title = "Relays (NIP-65)"
+		v.Highlight = true
+		v.SelBgColor = activeTheme.HighlightBg
+		v.SelFgColor = activeTheme.HighlightFg
+		v.Editable = false
+		v.BgColor = activeTheme.Bg
+		v.FgColor = activeTheme.Fg
+
+		relays := ownRelayList(account.Pubkey)
+		if len(relays) == 0 {
+			fmt.Fprintf(v, "No relays in your relay list\n")
+		} else {
+			for _, relay := range relays {
+				fmt.Fprintf(v, "%-60s %s\n", relay.Url, relayListMode(relay))
+			}
+		}
+
+		if _, err := g.SetCurrentView("relaylist"); err != nil {
+			return err
+		}
+
+		updateRelayListKeybindsView(g)
+	}
+	return nil
+}
+
+// selectedRelayListEntry is the entry under the cursor of the relay list view
+func selectedRelayListEntry(v *gocui.View) (Account, RelayList, bool) {
+	var account Account
+	DB.Where("active = ?", true).First(&account)
+	if v == nil || account.Pubkey == "" {
+		return account, RelayList{}, false
+	}
+	_, oy := v.Origin()
+	_, cy := v.Cursor()
+	relays := ownRelayList(account.Pubkey)
+	if oy+cy >= len(relays) {
+		return account, RelayList{}, false
+	}
+	return account, relays[oy+cy], true
+}
+
+// addRelayListEntry opens an input for a new relay
+func addRelayListEntry(g *gocui.Gui, v *gocui.View) error {
+	maxX, maxY := g.Size()
+	g.DeleteView("relaylist")
+	if v, err := g.SetView("addrelaylist", maxX/2-40, 0, maxX/2+40, maxY-7, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+
+		v.Title = "Add Relay (wss://...)"
+		v.Highlight = false
+		v.Editable = true
+		v.KeybindOnEdit = true
+		v.Wrap = true
+		v.BgColor = activeTheme.Bg
+		v.FgColor = activeTheme.Fg
+
+		v.SetOrigin(0, 0)
+		v.SetCursor(0, 0)
+
+		if _, err := g.SetCurrentView("addrelaylist"); err != nil {
+			return err
+		}
+
+		updateAddDMRelayKeybindsView(g)
+	}
+	return nil
+}
+
+// saveNewRelayListEntry adds the typed relay as read+write
+func saveNewRelayListEntry(g *gocui.Gui, v *gocui.View) error {
+	relayUrl := strings.TrimSpace(v.Buffer())
+	if relayUrl == "" {
+		return cancelAddRelayListEntry(g, v)
+	}
+	if !validateRelayURL(relayUrl) {
+		v.Title = "Invalid relay URL, it must start with wss:// or ws://"
+		return nil
+	}
+	relayUrl = normalizeRelayURL(relayUrl)
+
+	var account Account
+	DB.Where("active = ?", true).First(&account)
+	if account.Pubkey == "" {
+		return fmt.Errorf("no active account found")
+	}
+
+	for _, existing := range ownRelayList(account.Pubkey) {
+		if normalizeRelayURL(existing.Url) == relayUrl {
+			v.Title = "That relay is already in your relay list"
+			return nil
+		}
+	}
+
+	relay := RelayList{
+		PubkeyHex: account.Pubkey,
+		Url:       relayUrl,
+		Read:      true,
+		Write:     true,
+	}
+	if err := DB.Create(&relay).Error; err != nil {
+		TheLog.Printf("Error adding relay to relay list: %v", err)
+		return err
+	}
+	touchOwnRelayList(account.Pubkey)
+
+	g.DeleteView("addrelaylist")
+	return editRelayList(g, v)
+}
+
+func cancelAddRelayListEntry(g *gocui.Gui, v *gocui.View) error {
+	g.DeleteView("addrelaylist")
+	return editRelayList(g, v)
+}
+
+// deleteRelayListEntry removes the selected relay from our list
+func deleteRelayListEntry(g *gocui.Gui, v *gocui.View) error {
+	account, relay, ok := selectedRelayListEntry(v)
+	if !ok {
+		return nil
+	}
+	TheLog.Printf("removing %s from relay list", relay.Url)
+	DB.Delete(&relay)
+	touchOwnRelayList(account.Pubkey)
+	return editRelayList(g, v)
+}
+
+// cycleRelayListMode switches the selected relay between read+write, read and write
+func cycleRelayListMode(g *gocui.Gui, v *gocui.View) error {
+	account, relay, ok := selectedRelayListEntry(v)
+	if !ok {
+		return nil
+	}
+	read, write := true, false
+	switch relayListMode(relay) {
+	case "read":
+		read, write = false, true
+	case "write":
+		read, write = true, true
+	}
+	DB.Model(&relay).Updates(map[string]interface{}{"read": read, "write": write})
+	touchOwnRelayList(account.Pubkey)
+
+	_, cy := v.Cursor()
+	if err := editRelayList(g, v); err != nil {
+		return err
+	}
+	if nv, err := g.View("relaylist"); err == nil {
+		nv.SetCursor(0, cy)
+	}
+	return nil
+}
+
+// relayListEvent builds our kind 10002 from the stored list
+func relayListEvent(account Account) nostr.Event {
+	var tags nostr.Tags
+	for _, relay := range ownRelayList(account.Pubkey) {
+		switch relayListMode(relay) {
+		case "read+write":
+			tags = append(tags, nostr.Tag{"r", relay.Url})
+		default:
+			tags = append(tags, nostr.Tag{"r", relay.Url, relayListMode(relay)})
+		}
+	}
+	return nostr.Event{
+		Kind:      10002,
+		PubKey:    account.Pubkey,
+		CreatedAt: nostr.Now(),
+		Tags:      tags,
+	}
+}
+
+// saveRelayListChanges signs our kind 10002 and publishes it to our write
+// relays and every relay we are connected to
+func saveRelayListChanges(g *gocui.Gui, v *gocui.View) error {
+	var account Account
+	DB.Where("active = ?", true).First(&account)
+	if account.Pubkey == "" {
+		return fmt.Errorf("no active account found")
+	}
+
+	ev := relayListEvent(account)
+	sk := Decrypt(string(Password), account.Privatekey)
+	if err := ev.Sign(sk); err != nil {
+		TheLog.Printf("Error signing relay list event: %v", err)
+		return err
+	}
+	DB.Model(&RelayList{}).Where("pubkey_hex = ?", account.Pubkey).Update("event_created_at", ev.CreatedAt.Time())
+
+	urls := uniqueRelayURLs(append(writeRelayURLs(account.Pubkey), nostrPool.URLs()...))
+	go func() {
+		TheLog.Println("Publishing relay list to relays...")
+		ok := publishToRelays(urls, ev)
+		TheLog.Printf("Published relay list to %d of %d relays", ok, len(urls))
+	}()
+
+	g.DeleteView("relaylist")
+	updateKeybindsView(g)
+	g.SetCurrentView("v2")
+	return nil
+}
+
+// syncRelayStatuses makes the relays we connect to match our relay list:
+// listed relays are added and the others are disconnected and removed
+func syncRelayStatuses(g *gocui.Gui, v *gocui.View) error {
+	var account Account
+	DB.Where("active = ?", true).First(&account)
+	relays := ownRelayList(account.Pubkey)
+	if len(relays) == 0 {
+		// an empty list would leave us without any relay
+		return nil
+	}
+
+	listed := make(map[string]RelayList)
+	for _, relay := range relays {
+		listed[normalizeRelayURL(relay.Url)] = relay
+	}
+
+	var statuses []RelayStatus
+	DB.Find(&statuses)
+	configured := make(map[string]bool)
+	for _, status := range statuses {
+		url := normalizeRelayURL(status.Url)
+		configured[url] = true
+		if _, ok := listed[url]; !ok && status.Status != "deleting" {
+			TheLog.Printf("relay %s is not in our relay list, removing it", status.Url)
+			DB.Model(&status).Update("status", "deleting")
+		}
+	}
+	for url, relay := range listed {
+		if configured[url] {
+			continue
+		}
+		TheLog.Printf("relay %s from our relay list added", url)
+		// a read-only relay isn't published to, a write-only one isn't read from
+		if err := DB.Create(&RelayStatus{Url: url, Status: "waiting", LastEOSE: time.Unix(0, 0), LastDisco: time.Unix(0, 0), Roles: relayRolesFromList(relay)}).Error; err != nil {
+			TheLog.Printf("error adding relay %s: %v", url, err)
+		}
+	}
+
+	refreshV4(g, 0)
+	v.Title = "Relays (NIP-65) - connections synced"
+	return nil
+}
+
+func cancelRelayListEdit(g *gocui.Gui, v *gocui.View) error {
+	g.DeleteView("relaylist")
+	updateKeybindsView(g)
+	g.SetCurrentView("v2")
+	return nil
+}
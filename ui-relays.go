@@ -2,6 +2,8 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
@@ -134,3 +136,347 @@ func delRelay(g *gocui.Gui, v *gocui.View) error {
 	}
 	return nil
 }
+
+// selectedV4RelayURL is the relay on the v4 line under the cursor, if any
+func selectedV4RelayURL(v *gocui.View) string {
+	_, cy := v.Cursor()
+	_, oy := v.Origin()
+	line, err := v.Line(cy + oy)
+	if err != nil {
+		return ""
+	}
+	for _, field := range strings.Fields(line) {
+		if strings.HasPrefix(field, "ws://") || strings.HasPrefix(field, "wss://") {
+			return field
+		}
+	}
+	return ""
+}
+
+// showRelayInfo opens the NIP-11 document of the relay selected in v4,
+// refreshing it in the background when the cached copy is stale
+func showRelayInfo(g *gocui.Gui, v *gocui.View) error {
+	url := selectedV4RelayURL(v)
+	if url == "" {
+		return nil
+	}
+	maxX, maxY := g.Size()
+	iv, err := g.SetView("relayinfo", maxX/2-45, 2, maxX/2+45, maxY-7, 0)
+	if err != nil && !errors.Is(err, gocui.ErrUnknownView) {
+		return err
+	}
+	iv.Title = fmt.Sprintf("Relay info: %s - [ESC] to close", url)
+	iv.Wrap = true
+	iv.BgColor = activeTheme.Bg
+	iv.FgColor = activeTheme.Fg
+	if _, err := g.SetCurrentView("relayinfo"); err != nil {
+		return err
+	}
+	writeRelayInfo(iv, url, cachedRelayInfo(url))
+
+	go func() {
+		info := getRelayInfo(url)
+		g.Update(func(g *gocui.Gui) error {
+			iv, err := g.View("relayinfo")
+			if err != nil || !strings.Contains(iv.Title, url) {
+				return nil
+			}
+			writeRelayInfo(iv, url, info)
+			return nil
+		})
+	}()
+	return nil
+}
+
+// writeRelayInfo renders a NIP-11 document, or why we don't have one
+func writeRelayInfo(iv *gocui.View, url string, info *RelayInfo) {
+	iv.Clear()
+	var cached RelayInfoCache
+	DB.Where("url = ?", normalizeRelayURL(url)).First(&cached)
+	if info == nil {
+		if cached.Error != "" {
+			fmt.Fprintf(iv, "No relay information document: %s\n", cached.Error)
+		} else {
+			fmt.Fprintf(iv, "Fetching relay information document...\n")
+		}
+		return
+	}
+
+	fmt.Fprintf(iv, "Name:        %s\n", info.Name)
+	if info.Description != "" {
+		fmt.Fprintf(iv, "Description: %s\n", info.Description)
+	}
+	fmt.Fprintf(iv, "Software:    %s %s\n", info.Software, info.Version)
+	if info.Contact != "" {
+		fmt.Fprintf(iv, "Contact:     %s\n", info.Contact)
+	}
+	if info.PubKey != "" {
+		fmt.Fprintf(iv, "Operator:    @%s\n", authorName(info.PubKey))
+	}
+	if info.Icon != "" {
+		fmt.Fprintf(iv, "Icon:        %s\n", info.Icon)
+	}
+	if info.PostingPolicy != "" {
+		fmt.Fprintf(iv, "Policy:      %s\n", info.PostingPolicy)
+	}
+	nips := make([]string, 0, len(info.Supported))
+	for _, nip := range info.Supported {
+		nips = append(nips, fmt.Sprintf("%d", nip))
+	}
+	fmt.Fprintf(iv, "NIPs:        %s\n", strings.Join(nips, " "))
+
+	l := info.Limitation
+	fmt.Fprintf(iv, "\nLimitations:\n")
+	fmt.Fprintf(iv, "  auth required: %v  payment required: %v  restricted writes: %v\n",
+		l.AuthRequired, l.PaymentRequired, l.RestrictedWrites)
+	limits := []struct {
+		name  string
+		value int
+	}{
+		{"max limit", l.MaxLimit},
+		{"default limit", l.DefaultLimit},
+		{"max subscriptions", l.MaxSubscriptions},
+		{"max filters", l.MaxFilters},
+		{"max message length", l.MaxMessageLength},
+		{"max content length", l.MaxContentLength},
+		{"max event tags", l.MaxEventTags},
+		{"min pow difficulty", l.MinPowDifficulty},
+	}
+	for _, limit := range limits {
+		if limit.value > 0 {
+			fmt.Fprintf(iv, "  %s: %d\n", limit.name, limit.value)
+		}
+	}
+
+	fees := []struct {
+		name string
+		fees []RelayFee
+	}{
+		{"admission", info.Fees.Admission},
+		{"subscription", info.Fees.Subscription},
+		{"publication", info.Fees.Publication},
+	}
+	for _, f := range fees {
+		for _, fee := range f.fees {
+			fmt.Fprintf(iv, "Fee (%s): %d %s", f.name, fee.Amount, fee.Unit)
+			if fee.Period > 0 {
+				fmt.Fprintf(iv, " per %s", time.Duration(fee.Period)*time.Second)
+			}
+			fmt.Fprintf(iv, "\n")
+		}
+	}
+	if info.PaymentsURL != "" {
+		fmt.Fprintf(iv, "Payments:    %s\n", info.PaymentsURL)
+	}
+
+	fmt.Fprintf(iv, "\nFetched %s", cached.FetchedAt.Format("2006-01-02 15:04"))
+	if cached.Error != "" {
+		fmt.Fprintf(iv, ", last refresh failed: %s", cached.Error)
+	}
+	fmt.Fprintf(iv, "\n")
+}
+
+func closeRelayInfo(g *gocui.Gui, v *gocui.View) error {
+	g.DeleteView("relayinfo")
+	g.SetCurrentView("v4")
+	return nil
+}
+
+// relayProxyURL is the relay whose proxy is being edited
+var relayProxyURL string
+
+// editRelayProxy asks for the proxy of the configured relay selected in v4
+func editRelayProxy(g *gocui.Gui, v *gocui.View) error {
+	url := selectedV4RelayURL(v)
+	if url == "" {
+		return nil
+	}
+	var status RelayStatus
+	if err := DB.Where("url = ?", url).First(&status).Error; err != nil {
+		// only the configured relays have settings of their own
+		return nil
+	}
+	relayProxyURL = status.Url
+
+	maxX, maxY := g.Size()
+	pv, err := g.SetView("relayproxy", maxX/2-40, maxY/2, maxX/2+40, maxY/2+2, 0)
+	if err != nil && !errors.Is(err, gocui.ErrUnknownView) {
+		return err
+	}
+	pv.Title = "Proxy for " + status.Url
+	pv.Subtitle = "socks5://host:port, direct, or empty for the default - [enter] save / [ESC] cancel"
+	pv.Editable = true
+	pv.KeybindOnEdit = true
+	pv.Clear()
+	fmt.Fprint(pv, status.Proxy)
+	pv.SetCursor(len(status.Proxy), 0)
+	g.Cursor = true
+	_, err = g.SetCurrentView("relayproxy")
+	return err
+}
+
+// saveRelayProxy stores the typed proxy and reconnects the relay through it
+func saveRelayProxy(g *gocui.Gui, v *gocui.View) error {
+	value := strings.TrimSpace(v.Buffer())
+	if value != "" && value != proxyDirect {
+		if err := checkProxyURL(value); err != nil {
+			v.Subtitle = err.Error()
+			return nil
+		}
+	}
+	if err := DB.Model(&RelayStatus{}).Where("url = ?", relayProxyURL).Update("proxy", value).Error; err != nil {
+		TheLog.Printf("error saving proxy for %s: %v", relayProxyURL, err)
+	} else {
+		TheLog.Printf("proxy for %s set to %q", relayProxyURL, value)
+		// the relay status manager redials waiting relays
+		nostrPool.Close(relayProxyURL)
+		http.DefaultTransport.(*http.Transport).CloseIdleConnections()
+		DB.Model(&RelayStatus{}).Where("url = ?", relayProxyURL).Update("status", "waiting")
+	}
+	return cancelRelayProxy(g, v)
+}
+
+func cancelRelayProxy(g *gocui.Gui, v *gocui.View) error {
+	g.DeleteView("relayproxy")
+	g.Cursor = false
+	g.SetCurrentView("v4")
+	v2, err := g.View("v2")
+	if err != nil {
+		return nil
+	}
+	_, cy := v2.Cursor()
+	return refreshV4(g, cy)
+}
+
+// relayPolicyURL is the relay whose roles and policies are being edited
+var relayPolicyURL string
+
+// relayPolicyChanged is set when an edit needs the relay reconnected
+var relayPolicyChanged bool
+
+// editRelayPolicy opens the roles and policies of the configured relay selected in v4
+func editRelayPolicy(g *gocui.Gui, v *gocui.View) error {
+	url := selectedV4RelayURL(v)
+	if url == "" {
+		return nil
+	}
+	var status RelayStatus
+	if err := DB.Where("url = ?", url).First(&status).Error; err != nil {
+		return nil
+	}
+	relayPolicyURL = status.Url
+	relayPolicyChanged = false
+	return showRelayPolicy(g, 0)
+}
+
+// showRelayPolicy draws the policy view with the cursor on line cy
+func showRelayPolicy(g *gocui.Gui, cy int) error {
+	var status RelayStatus
+	if err := DB.Where("url = ?", relayPolicyURL).First(&status).Error; err != nil {
+		return cancelRelayPolicy(g, nil)
+	}
+	maxX, maxY := g.Size()
+	pv, err := g.SetView("relaypolicy", maxX/2-35, maxY/2-6, maxX/2+35, maxY/2+6, 0)
+	if err != nil && !errors.Is(err, gocui.ErrUnknownView) {
+		return err
+	}
+	pv.Title = "Relay roles and policies: " + status.Url
+	pv.Subtitle = "[enter] change / [ESC] close"
+	pv.Highlight = true
+	pv.SelBgColor = activeTheme.HighlightBg
+	pv.SelFgColor = activeTheme.HighlightFg
+	pv.BgColor = activeTheme.Bg
+	pv.FgColor = activeTheme.Fg
+	pv.Clear()
+
+	roles := status.roles()
+	for _, role := range relayRoles {
+		state := "off"
+		if roles[role] {
+			state = "on"
+		}
+		fmt.Fprintf(pv, "%-20s %s\n", "role: "+role, state)
+	}
+	fmt.Fprintf(pv, "%-20s %s\n", "auth", relayAuthLabel(status.AuthMode))
+	limit := "none"
+	if status.MaxSubscriptions > 0 {
+		limit = fmt.Sprintf("%d", status.MaxSubscriptions)
+	}
+	if info := cachedRelayInfo(status.Url); info != nil && info.Limitation.MaxSubscriptions > 0 {
+		limit += fmt.Sprintf(" (relay allows %d)", info.Limitation.MaxSubscriptions)
+	}
+	fmt.Fprintf(pv, "%-20s %s\n", "max subscriptions", limit)
+	enabled := "yes"
+	if status.Disabled {
+		enabled = "no"
+	}
+	fmt.Fprintf(pv, "%-20s %s\n", "enabled", enabled)
+
+	pv.SetCursor(0, cy)
+	_, err = g.SetCurrentView("relaypolicy")
+	return err
+}
+
+// changeRelayPolicy toggles the role, or cycles the policy, under the cursor
+func changeRelayPolicy(g *gocui.Gui, v *gocui.View) error {
+	var status RelayStatus
+	if err := DB.Where("url = ?", relayPolicyURL).First(&status).Error; err != nil {
+		return cancelRelayPolicy(g, v)
+	}
+	_, cy := v.Cursor()
+	updates := map[string]interface{}{}
+	switch {
+	case cy < len(relayRoles):
+		roles := status.roles()
+		roles[relayRoles[cy]] = !roles[relayRoles[cy]]
+		updates["roles"] = encodeRelayRoles(roles)
+		// subscriptions follow the read roles, publishing looks the role up each time
+		relayPolicyChanged = relayPolicyChanged || relayRoles[cy] != relayRoleWrite
+	case cy == len(relayRoles):
+		next := 0
+		for i, mode := range relayAuthModes {
+			if mode == status.AuthMode {
+				next = (i + 1) % len(relayAuthModes)
+			}
+		}
+		updates["auth_mode"] = relayAuthModes[next]
+	case cy == len(relayRoles)+1:
+		next := 0
+		for i, limit := range relaySubscriptionLimits {
+			if limit == status.MaxSubscriptions {
+				next = (i + 1) % len(relaySubscriptionLimits)
+			}
+		}
+		updates["max_subscriptions"] = relaySubscriptionLimits[next]
+		relayPolicyChanged = true
+	case cy == len(relayRoles)+2:
+		updates["disabled"] = !status.Disabled
+		relayPolicyChanged = true
+	default:
+		return nil
+	}
+	if err := DB.Model(&RelayStatus{}).Where("url = ?", relayPolicyURL).Updates(updates).Error; err != nil {
+		TheLog.Printf("error saving policy for %s: %v", relayPolicyURL, err)
+	}
+	return showRelayPolicy(g, cy)
+}
+
+// cancelRelayPolicy closes the policy view, reconnecting the relay when its
+// subscriptions have to change
+func cancelRelayPolicy(g *gocui.Gui, v *gocui.View) error {
+	g.DeleteView("relaypolicy")
+	if relayPolicyChanged {
+		relayPolicyChanged = false
+		TheLog.Printf("roles or policies of %s changed, reconnecting", relayPolicyURL)
+		nostrPool.Close(relayPolicyURL)
+		// the relay status manager redials waiting relays, doRelay marks disabled ones
+		DB.Model(&RelayStatus{}).Where("url = ?", relayPolicyURL).Update("status", "waiting")
+	}
+	g.SetCurrentView("v4")
+	v2, err := g.View("v2")
+	if err != nil {
+		return nil
+	}
+	_, cy := v2.Cursor()
+	return refreshV4(g, cy)
+}
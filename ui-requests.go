@@ -0,0 +1,144 @@
+package main
+
+import (
+	"time"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// requestsMaxHops is how far out in metadata_follows a sender can be and still
+// land in Conversations instead of Requests (1 = people we follow)
+var requestsMaxHops = 2
+
+const (
+	conversationAccepted = "accepted"
+	conversationMuted    = "muted"
+	conversationDeleted  = "deleted"
+)
+
+// trustedSenders returns the pubkeys within requestsMaxHops of the account in
+// the follow graph, plus everyone we have written to ourselves
+func trustedSenders(account Account) map[string]bool {
+	trusted := make(map[string]bool)
+	if account.Pubkey == "" {
+		return trusted
+	}
+
+	for p := range followHops(account.Pubkey, requestsMaxHops) {
+		trusted[p] = true
+	}
+
+	// a conversation we started is never a request
+	var sentTo []string
+	DB.Model(&ChatMessage{}).Where("account_id = ? AND from_pubkey = ?", account.ID, account.Pubkey).Distinct().Pluck("to_pubkey", &sentTo)
+	for _, p := range sentTo {
+		trusted[p] = true
+	}
+
+	return trusted
+}
+
+// conversationStates loads the accept/mute/delete decisions for the account keyed by pubkey
+func conversationStates(account Account) map[string]ConversationState {
+	var states []ConversationState
+	DB.Where("account_id = ?", account.ID).Find(&states)
+	byPubkey := make(map[string]ConversationState)
+	for _, s := range states {
+		byPubkey[s.PubkeyHex] = s
+	}
+	return byPubkey
+}
+
+// isRequestSender decides if messages from pubkey belong in the Requests tab
+func isRequestSender(pubkey string, trusted map[string]bool, states map[string]ConversationState) bool {
+	if s, ok := states[pubkey]; ok && s.State == conversationAccepted {
+		return false
+	}
+	return !trusted[pubkey]
+}
+
+// messageCleared reports if a message was deleted from the requests inbox, so
+// refetching the gift wrap from a relay doesn't bring it back
+func messageCleared(accountID int64, pubkey string, ts time.Time) bool {
+	var s ConversationState
+	if err := DB.Where("account_id = ? AND pubkey_hex = ?", accountID, pubkey).First(&s).Error; err != nil {
+		return false
+	}
+	return !s.ClearedAt.IsZero() && !ts.After(s.ClearedAt)
+}
+
+func setConversationState(account Account, pubkey string, state string) error {
+	var s ConversationState
+	if err := DB.Where("account_id = ? AND pubkey_hex = ?", account.ID, pubkey).First(&s).Error; err != nil {
+		s = ConversationState{AccountID: account.ID, PubkeyHex: pubkey}
+	}
+	s.State = state
+	if state == conversationDeleted {
+		s.ClearedAt = time.Now()
+	}
+	return DB.Save(&s).Error
+}
+
+// selectedRequest returns the highlighted sender when v2 is showing Requests
+func selectedRequest(g *gocui.Gui) (Account, string, bool) {
+	var account Account
+	if v2MetaDisplay != 3 {
+		return account, "", false
+	}
+	v2, err := g.View("v2")
+	if err != nil {
+		return account, "", false
+	}
+	_, cy := v2.Cursor()
+	if cy >= len(displayV2Meta) {
+		return account, "", false
+	}
+	DB.Where("active = ?", true).First(&account)
+	if account.Pubkey == "" {
+		return account, "", false
+	}
+	return account, displayV2Meta[cy].PubkeyHex, true
+}
+
+// acceptRequest moves the highlighted request into the main conversations list
+func acceptRequest(g *gocui.Gui, v *gocui.View) error {
+	account, pubkey, ok := selectedRequest(g)
+	if !ok {
+		return nil
+	}
+	if err := setConversationState(account, pubkey, conversationAccepted); err != nil {
+		TheLog.Printf("error accepting message request from %s: %v", pubkey, err)
+		return nil
+	}
+	TheLog.Printf("accepted message request from %s", pubkey)
+	return refreshAllViews(g, v)
+}
+
+// muteRequest hides the highlighted sender from the requests inbox
+func muteRequest(g *gocui.Gui, v *gocui.View) error {
+	account, pubkey, ok := selectedRequest(g)
+	if !ok {
+		return nil
+	}
+	if err := setConversationState(account, pubkey, conversationMuted); err != nil {
+		TheLog.Printf("error muting %s: %v", pubkey, err)
+		return nil
+	}
+	TheLog.Printf("muted message requests from %s", pubkey)
+	return refreshAllViews(g, v)
+}
+
+// deleteRequest removes the highlighted request and its messages
+func deleteRequest(g *gocui.Gui, v *gocui.View) error {
+	account, pubkey, ok := selectedRequest(g)
+	if !ok {
+		return nil
+	}
+	rows := DB.Where("account_id = ? AND ((from_pubkey = ? AND to_pubkey = ?) OR (from_pubkey = ? AND to_pubkey = ?))",
+		account.ID, pubkey, account.Pubkey, account.Pubkey, pubkey).Delete(&ChatMessage{}).RowsAffected
+	if err := setConversationState(account, pubkey, conversationDeleted); err != nil {
+		TheLog.Printf("error deleting message request from %s: %v", pubkey, err)
+	}
+	TheLog.Printf("deleted message request from %s (%d messages)", pubkey, rows)
+	return refreshAllViews(g, v)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// walletAccountID is the account whose wallet or zap settings are being edited or shown
+var walletAccountID int64
+
+// selectedConfigAccount returns the account highlighted in the config view
+func selectedConfigAccount(g *gocui.Gui) (Account, bool) {
+	cView, err := g.View("config")
+	if err != nil {
+		return Account{}, false
+	}
+	_, cy := cView.Cursor()
+	var accounts []Account
+	DB.Find(&accounts)
+	if cy >= len(accounts) {
+		return Account{}, false
+	}
+	return accounts[cy], true
+}
+
+// configWallet asks for the selected account's nostr+walletconnect:// string
+func configWallet(g *gocui.Gui, v *gocui.View) error {
+	account, ok := selectedConfigAccount(g)
+	if !ok {
+		return nil
+	}
+	walletAccountID = account.ID
+
+	maxX, maxY := g.Size()
+	g.DeleteView("config")
+	if v, err := g.SetView("confignwc", maxX/2-40, maxY/2-1, maxX/2+40, maxY/2+1, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+		v.Title = "Wallet Connect string (empty to remove)"
+		v.Editable = true
+		v.KeybindOnEdit = true
+		if _, err := g.SetCurrentView("confignwc"); err != nil {
+			return err
+		}
+		updateConfigKeybindsView(g)
+	}
+	return nil
+}
+
+// doConfigWallet validates and stores the connection string, encrypted like the private key
+func doConfigWallet(g *gocui.Gui, v *gocui.View) error {
+	line := strings.TrimSpace(v.Buffer())
+	g.DeleteView("confignwc")
+
+	stored := ""
+	if line != "" {
+		if _, err := parseNWC(line); err != nil {
+			TheLog.Printf("wallet connection not saved: %v", err)
+			return showError(g, fmt.Sprintf("Wallet connection not saved: %v", err))
+		}
+		stored = Encrypt(string(Password), line)
+	}
+	if err := DB.Model(&Account{}).Where("id = ?", walletAccountID).Update("nwc_connection", stored).Error; err != nil {
+		TheLog.Printf("error saving wallet connection: %v", err)
+	}
+	return config(g, v)
+}
+
+func cancelConfigWallet(g *gocui.Gui, v *gocui.View) error {
+	g.DeleteView("confignwc")
+	return config(g, v)
+}
+
+// walletInfo shows the balance and recent transactions of the selected account's wallet
+func walletInfo(g *gocui.Gui, v *gocui.View) error {
+	account, ok := selectedConfigAccount(g)
+	if !ok {
+		return nil
+	}
+	conn, configured, err := accountNWC(account)
+	if !configured {
+		return showError(g, "No wallet connected to this account, press W to add one")
+	}
+	if err != nil {
+		return showError(g, fmt.Sprintf("Stored wallet connection is invalid: %v", err))
+	}
+
+	maxX, maxY := g.Size()
+	g.DeleteView("config")
+	if v, err := g.SetView("wallet", maxX/2-40, maxY/2-12, maxX/2+40, maxY/2+12, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+		v.Title = "Wallet"
+		v.Wrap = true
+		v.BgColor = activeTheme.Bg
+		v.FgColor = activeTheme.Fg
+		fmt.Fprintf(v, "Asking the wallet via %s...\n", strings.Join(conn.Relays, ", "))
+		if _, err := g.SetCurrentView("wallet"); err != nil {
+			return err
+		}
+	}
+
+	go func() {
+		balance, balanceErr := nwcGetBalance(conn)
+		txs, txErr := nwcListTransactions(conn, 10)
+		g.Update(func(g *gocui.Gui) error {
+			v, err := g.View("wallet")
+			if err != nil {
+				return nil
+			}
+			v.Clear()
+			if conn.Lud16 != "" {
+				fmt.Fprintf(v, "Lightning Address: %s\n", conn.Lud16)
+			}
+			if balanceErr != nil {
+				fmt.Fprintf(v, "Balance: unavailable (%v)\n", balanceErr)
+			} else {
+				fmt.Fprintf(v, "Balance: %d sats\n", balance/1000)
+			}
+
+			fmt.Fprintf(v, "\n===== RECENT TRANSACTIONS =====\n")
+			if txErr != nil {
+				fmt.Fprintf(v, "  unavailable (%v)\n", txErr)
+			} else if len(txs) == 0 {
+				fmt.Fprintf(v, "  None\n")
+			}
+			for _, tx := range txs {
+				sign := "+"
+				if tx.Type == "outgoing" {
+					sign = "-"
+				}
+				when := time.Unix(tx.CreatedAt, 0).Format("2006-01-02 15:04")
+				fmt.Fprintf(v, "  %s %s%d sats  %s\n", when, sign, tx.Amount/1000, previewText(tx.Description, 40))
+			}
+			fmt.Fprintf(v, "\n[Press ESC to close]\n")
+			return nil
+		})
+	}()
+	return nil
+}
+
+func closeWallet(g *gocui.Gui, v *gocui.View) error {
+	g.DeleteView("wallet")
+	return config(g, v)
+}
+
+// payZapInvoice pays the invoices on screen with the active account's wallet,
+// one after another for a split zap
+func payZapInvoice(g *gocui.Gui, v *gocui.View) error {
+	zapReq := CurrentZapRequest
+	if zapReq == nil || zapReq.Paying {
+		return nil
+	}
+	var unpaid []*ZapRequest
+	for _, part := range zapReq.invoices() {
+		if part.Invoice != "" && !part.PayUnknown {
+			unpaid = append(unpaid, part)
+		}
+	}
+	if len(unpaid) == 0 {
+		return nil
+	}
+	var account Account
+	DB.Where("active = ?", true).First(&account)
+	conn, configured, err := accountNWC(account)
+	if !configured {
+		return nil
+	}
+	if err != nil {
+		return showError(g, fmt.Sprintf("Stored wallet connection is invalid: %v", err))
+	}
+
+	v.Autoscroll = true
+	var payable []*ZapRequest
+	for _, part := range unpaid {
+		if time.Now().After(part.InvoiceExpires) {
+			fmt.Fprintf(v, "\nInvoice for @%s has expired, close this and zap again\n", authorName(part.RecipientPubkey))
+			continue
+		}
+		payable = append(payable, part)
+	}
+	if len(payable) == 0 {
+		return nil
+	}
+
+	zapReq.Paying = true
+	fmt.Fprintf(v, "\nPaying with wallet...\n")
+	go func() {
+		for _, part := range payable {
+			preimage, err := nwcPayInvoice(conn, part.Invoice)
+			g.Update(func(g *gocui.Gui) error {
+				v, verr := g.View("zapinvoice")
+				if verr != nil {
+					if errors.Is(err, errNwcNoAnswer) {
+						part.PayUnknown = true
+						return showError(g, "No answer from the wallet, zap payment status unknown")
+					}
+					if err != nil {
+						return showError(g, fmt.Sprintf("Zap payment failed: %v", err))
+					}
+					return nil
+				}
+				prefix := ""
+				if len(payable) > 1 {
+					prefix = fmt.Sprintf("@%s: ", authorName(part.RecipientPubkey))
+				}
+				if errors.Is(err, errNwcNoAnswer) {
+					// don't offer to pay again, that could pay twice
+					part.PayUnknown = true
+					TheLog.Printf("zap payment status unknown: %v", err)
+					fmt.Fprintf(v, "%sNo answer from the wallet, payment status unknown. Check your wallet before zapping again.\n", prefix)
+					return nil
+				}
+				if err != nil {
+					TheLog.Printf("zap payment failed: %v", err)
+					fmt.Fprintf(v, "%sPayment failed: %v\n", prefix, err)
+					return nil
+				}
+				part.Invoice = ""
+				TheLog.Printf("zap paid, preimage %s", preimage)
+				fmt.Fprintf(v, "%sPaid! Preimage: %s\n", prefix, preimage)
+				if !part.SuccessShown {
+					part.SuccessShown = true
+					fmt.Fprint(v, part.SuccessAction.describe(preimage))
+				}
+				return nil
+			})
+		}
+		g.Update(func(g *gocui.Gui) error {
+			zapReq.Paying = false
+			return nil
+		})
+	}()
+	return nil
+}
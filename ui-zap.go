@@ -4,8 +4,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
@@ -21,19 +19,30 @@ type ZapRequest struct {
 	EventID         string
 	Amount          int64
 	Comment         string
-	Lud16           string
+	Address         string // lud16 lightning address or lud06 lnurl
 	RecipientPubkey string
+	EventAddress    string // kind:pubkey:d of an addressable event being zapped
+	CommentAllowed  int    // from the LNURL-pay endpoint, 0 until it's known
+	Invoice         string // the invoice on screen, until it's paid
+	SuccessAction   *LNURLSuccessAction
+	SuccessShown    bool
+	PayUnknown      bool // sent to the wallet without an answer, it may be paid
+	Splits          []zapSplit    // zap tags of the event being zapped
+	Parts           []*ZapRequest // one per split recipient that returned an invoice
+	InvoiceExpires  time.Time
+	Paying          bool
 }
 
 // LNURLPayResponse represents the response from a LNURL-pay request
 type LNURLPayResponse struct {
-	Callback    string `json:"callback"`
-	Tag         string `json:"tag"`
-	MaxSendable int64  `json:"maxSendable"`
-	MinSendable int64  `json:"minSendable"`
-	Metadata    string `json:"metadata"`
-	AllowsNostr bool   `json:"allowsNostr"`
-	NostrPubkey string `json:"nostrPubkey"`
+	Callback       string `json:"callback"`
+	Tag            string `json:"tag"`
+	MaxSendable    int64  `json:"maxSendable"`
+	MinSendable    int64  `json:"minSendable"`
+	Metadata       string `json:"metadata"`
+	CommentAllowed int    `json:"commentAllowed"`
+	AllowsNostr    bool   `json:"allowsNostr"`
+	NostrPubkey    string `json:"nostrPubkey"`
 }
 
 // LNURLPayValues represents the query parameters for a LNURL-pay callback
@@ -45,28 +54,69 @@ type LNURLPayValues struct {
 
 // LNURLPayInvoiceResponse represents the response from a LNURL-pay callback
 type LNURLPayInvoiceResponse struct {
-	PR            string `json:"pr"`
-	SuccessAction *struct {
-		Tag     string `json:"tag"`
-		Message string `json:"message,omitempty"`
-	} `json:"successAction,omitempty"`
-	Routes []interface{} `json:"routes,omitempty"`
+	PR            string              `json:"pr"`
+	SuccessAction *LNURLSuccessAction `json:"successAction,omitempty"`
+	Routes        []interface{}       `json:"routes,omitempty"`
 }
 
 // CurrentZapRequest stores the active zap request data
 var CurrentZapRequest *ZapRequest
 
+// zapMenuPresets are the amounts listed in the open zap menu, in sats
+var zapMenuPresets []int64
+
+// zapMenuHeader is how many lines of the zap menu come before the amounts
+var zapMenuHeader int
+
+// invoices are the zap requests that each carry one invoice: the parts of a
+// split zap, or the zap itself
+func (zr *ZapRequest) invoices() []*ZapRequest {
+	if len(zr.Parts) > 0 {
+		return zr.Parts
+	}
+	return []*ZapRequest{zr}
+}
+
+// fetchLNURLPay resolves a lightning address or lnurl to its LNURL-pay parameters
+func fetchLNURLPay(address string) (LNURLPayResponse, error) {
+	var lnurlPayResp LNURLPayResponse
+
+	lnurlEndpoint, err := lnurlPayURL(address)
+	if err != nil {
+		return lnurlPayResp, err
+	}
+	if err := lnurlGet(lnurlEndpoint, &lnurlPayResp); err != nil {
+		return lnurlPayResp, err
+	}
+	if lnurlPayResp.Tag != "payRequest" {
+		return lnurlPayResp, fmt.Errorf("%s is not an LNURL-pay endpoint", displayZapAddress(address))
+	}
+	if err := checkLnurlURL(lnurlPayResp.Callback); err != nil {
+		return lnurlPayResp, fmt.Errorf("bad LNURL callback: %w", err)
+	}
+	if lnurlPayResp.AllowsNostr && lnurlPayResp.NostrPubkey != "" {
+		rememberZapProvider(address, lnurlPayResp.NostrPubkey)
+	}
+	return lnurlPayResp, nil
+}
+
 // zapUserMenu opens a menu to send a zap to a user
 func zapUserMenu(g *gocui.Gui, v *gocui.View) error {
 	// Get the highlighted user's pubkey
 	_, cy := v.Cursor()
+	if cy >= len(displayV2Meta) {
+		return nil
+	}
+	return openZapMenu(g, displayV2Meta[cy], nil)
+}
 
-	// Find the pubkey from the highlighted line
-
-	// Check if the user has a lightning address
-	metadata := displayV2Meta[cy]
-	if metadata.Lud16 == "" {
-		return fmt.Errorf("selected user does not have a lightning address")
+// openZapMenu starts a zap to a person, or to one of their events when ce is set
+func openZapMenu(g *gocui.Gui, metadata Metadata, ce *CachedEvent) error {
+	// Check if the user has a lightning address or lnurl, split zaps go to
+	// the event's zap tags instead
+	address := zapAddress(metadata)
+	if address == "" && (ce == nil || len(eventZapSplits(ce)) == 0) {
+		return showError(g, "Selected user does not have a lightning address")
 	}
 
 	// Create the zap menu
@@ -77,6 +127,9 @@ func zapUserMenu(g *gocui.Gui, v *gocui.View) error {
 		}
 
 		v.Title = "Zap Menu"
+		if ce != nil {
+			v.Title = fmt.Sprintf("Zap Menu - %s: %s", kindName(ce.Kind), previewText(ce.Content, 40))
+		}
 		v.Highlight = true
 		v.SelBgColor = activeTheme.HighlightBg
 		v.SelFgColor = activeTheme.HighlightFg
@@ -84,26 +137,64 @@ func zapUserMenu(g *gocui.Gui, v *gocui.View) error {
 		v.BgColor = activeTheme.Bg
 		v.FgColor = activeTheme.Fg
 
-		// Display user information
-		fmt.Fprintf(v, "Sending zap to: %s\n", metadata.Name)
-		fmt.Fprintf(v, "Lightning Address: %s\n\n", metadata.Lud16)
-
-		// Display amount options
-		fmt.Fprintf(v, "1. 1,000 sats\n")
-		fmt.Fprintf(v, "2. 5,000 sats\n")
-		fmt.Fprintf(v, "3. 10,000 sats\n")
-		fmt.Fprintf(v, "4. 21,000 sats\n")
-		fmt.Fprintf(v, "5. 50,000 sats\n")
-		fmt.Fprintf(v, "6. 100,000 sats\n")
-		fmt.Fprintf(v, "7. Custom amount\n")
-		fmt.Fprintf(v, "8. Cancel\n")
+		var account Account
+		DB.Where("active = ?", true).First(&account)
 
 		// Store pubkey and lightning address in the global variable
-		CurrentZapRequest = &ZapRequest{
+		zapReq := &ZapRequest{
 			RecipientPubkey: metadata.PubkeyHex,
-			Lud16:           metadata.Lud16,
+			Address:         address,
+			Comment:         account.ZapComment,
+		}
+		if ce != nil {
+			zapReq.EventID = ce.ID
+			zapReq.EventAddress = eventAddress(ce)
+			zapReq.Splits = eventZapSplits(ce)
+		}
+		CurrentZapRequest = zapReq
+
+		// Display user information
+		zapMenuHeader = 3
+		if len(zapReq.Splits) > 0 {
+			var sum float64
+			for _, split := range zapReq.Splits {
+				sum += split.Weight
+			}
+			fmt.Fprintf(v, "Split between %d recipients:\n", len(zapReq.Splits))
+			for _, split := range zapReq.Splits {
+				fmt.Fprintf(v, "  @%s %.0f%%\n", authorName(split.Pubkey), split.Weight*100/sum)
+			}
+			fmt.Fprintf(v, "\n")
+			zapMenuHeader = len(zapReq.Splits) + 2
+		} else {
+			fmt.Fprintf(v, "Sending zap to: %s\n", metadata.Name)
+			fmt.Fprintf(v, "Lightning Address: %s\n\n", displayZapAddress(address))
 		}
 
+		// Display amount options
+		zapMenuPresets = zapPresets(account)
+		for i, amount := range zapMenuPresets {
+			fmt.Fprintf(v, "%d. %s sats\n", i+1, formatSats(amount))
+		}
+		fmt.Fprintf(v, "%d. Custom amount\n", len(zapMenuPresets)+1)
+		fmt.Fprintf(v, "%d. Cancel\n", len(zapMenuPresets)+2)
+		v.SetCursor(0, zapMenuHeader)
+
+		// Learn the comment limit while an amount is being picked
+		go func() {
+			if zapReq.Address == "" {
+				return
+			}
+			resp, err := fetchLNURLPay(zapReq.Address)
+			if err != nil {
+				return
+			}
+			g.Update(func(g *gocui.Gui) error {
+				zapReq.CommentAllowed = resp.CommentAllowed
+				return nil
+			})
+		}()
+
 		// Set keybindings for the zap menu
 		g.SetKeybinding("zapmenu", gocui.KeyEsc, gocui.ModNone, cancelZap)
 		g.SetKeybinding("zapmenu", gocui.KeyEnter, gocui.ModNone, selectZapAmount)
@@ -136,34 +227,31 @@ func selectZapAmount(g *gocui.Gui, v *gocui.View) error {
 	zapReq := CurrentZapRequest
 
 	// Set amount based on selection
-	switch cy {
-	case 0: // 1,000 sats
-		zapReq.Amount = 1000 * 1000 // Convert to millisats
-		return processZap(g, v, zapReq)
-	case 1: // 5,000 sats
-		zapReq.Amount = 5000 * 1000
-		return processZap(g, v, zapReq)
-	case 2: // 10,000 sats
-		zapReq.Amount = 10000 * 1000
-		return processZap(g, v, zapReq)
-	case 3: // 21,000 sats
-		zapReq.Amount = 21000 * 1000
-		return processZap(g, v, zapReq)
-	case 4: // 50,000 sats
-		zapReq.Amount = 50000 * 1000
-		return processZap(g, v, zapReq)
-	case 5: // 100,000 sats
-		zapReq.Amount = 100000 * 1000
-		return processZap(g, v, zapReq)
-	case 6: // Custom amount
+	option := cy - zapMenuHeader
+	switch {
+	case option < 0:
+		return nil
+	case option < len(zapMenuPresets):
+		zapReq.Amount = zapMenuPresets[option] * 1000 // Convert to millisats
+		return openZapCommentInput(g, zapReq)
+	case option == len(zapMenuPresets): // Custom amount
 		return openCustomAmountInput(g, v, zapReq)
-	case 7: // Cancel
+	case option == len(zapMenuPresets)+1: // Cancel
 		return cancelZap(g, v)
 	default:
 		return nil
 	}
 }
 
+// formatSats writes an amount with thousands separators, 21000 -> 21,000
+func formatSats(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
 // openCustomAmountInput opens an input for a custom zap amount
 func openCustomAmountInput(g *gocui.Gui, v *gocui.View, zapReq *ZapRequest) error {
 	maxX, maxY := g.Size()
@@ -215,8 +303,65 @@ func submitZapAmount(g *gocui.Gui, v *gocui.View) error {
 	// Convert to millisats
 	zapReq.Amount = amount * 1000
 
-	// Process the zap
 	g.DeleteView("zapamount")
+	return openZapCommentInput(g, zapReq)
+}
+
+// openZapCommentInput asks for an optional comment to send with the zap
+func openZapCommentInput(g *gocui.Gui, zapReq *ZapRequest) error {
+	maxX, maxY := g.Size()
+	g.DeleteView("zapmenu")
+
+	if v, err := g.SetView("zapcomment", maxX/2-40, maxY/2-3, maxX/2+40, maxY/2+3, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+
+		v.Title = "Comment (optional, ENTER to zap)"
+		if zapReq.CommentAllowed > 0 {
+			v.Title = fmt.Sprintf("Comment (optional, up to %d characters, ENTER to zap)", zapReq.CommentAllowed)
+		}
+		v.Editable = true
+		v.Wrap = true
+		v.BgColor = activeTheme.Bg
+		v.FgColor = activeTheme.Fg
+		if zapReq.Comment != "" {
+			fmt.Fprint(v, zapReq.Comment)
+			v.SetCursor(len([]rune(zapReq.Comment)), 0)
+		}
+
+		g.SetKeybinding("zapcomment", gocui.KeyEsc, gocui.ModNone, cancelZapComment)
+		g.SetKeybinding("zapcomment", gocui.KeyEnter, gocui.ModNone, submitZapComment)
+
+		if _, err := g.SetCurrentView("zapcomment"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cancelZapComment abandons the zap at the comment step
+func cancelZapComment(g *gocui.Gui, v *gocui.View) error {
+	g.DeleteView("zapcomment")
+	g.SetCurrentView("v2")
+	return nil
+}
+
+// submitZapComment stores the comment and starts the zap
+func submitZapComment(g *gocui.Gui, v *gocui.View) error {
+	zapReq := CurrentZapRequest
+	if zapReq == nil {
+		return fmt.Errorf("invalid zap request data")
+	}
+
+	comment := strings.TrimSpace(v.Buffer())
+	if n := len([]rune(comment)); zapReq.CommentAllowed > 0 && n > zapReq.CommentAllowed {
+		v.Title = fmt.Sprintf("Comment too long: %d of %d characters", n, zapReq.CommentAllowed)
+		return nil
+	}
+	zapReq.Comment = comment
+
+	g.DeleteView("zapcomment")
 	return processZap(g, v, zapReq)
 }
 
@@ -230,12 +375,26 @@ func processZap(g *gocui.Gui, v *gocui.View, zapReq *ZapRequest) error {
 		}
 
 		v.Title = "Processing Zap"
+		v.Autoscroll = true
 		v.BgColor = activeTheme.Bg
 		v.FgColor = activeTheme.Fg
 
-		fmt.Fprintf(v, "Sending %d sats to %s\n\n", zapReq.Amount/1000, zapReq.Lud16)
+		if len(zapReq.Splits) > 0 {
+			fmt.Fprintf(v, "Sending %d sats split between %d recipients\n\n", zapReq.Amount/1000, len(zapReq.Splits))
+		} else {
+			fmt.Fprintf(v, "Sending %d sats to %s\n\n", zapReq.Amount/1000, displayZapAddress(zapReq.Address))
+		}
 		fmt.Fprintf(v, "Resolving lightning address...\n")
 
+		progress := func(format string, args ...interface{}) {
+			g.Update(func(g *gocui.Gui) error {
+				if v, err := g.View("zapprocessing"); err == nil {
+					fmt.Fprintf(v, format, args...)
+				}
+				return nil
+			})
+		}
+
 		// Process in a goroutine to avoid blocking the UI
 		go func() {
 			// Get active account for signing
@@ -248,213 +407,263 @@ func processZap(g *gocui.Gui, v *gocui.View, zapReq *ZapRequest) error {
 				return
 			}
 
-			// Parse the lightning address
-			parts := strings.Split(zapReq.Lud16, "@")
-			if len(parts) != 2 {
-				g.Update(func(g *gocui.Gui) error {
-					return showError(g, "Invalid lightning address format")
-				})
-				return
-			}
-			username, domain := parts[0], parts[1]
-
-			// Construct the LNURL-pay endpoint
-			lnurlEndpoint := fmt.Sprintf("https://%s/.well-known/lnurlp/%s", domain, username)
+			// Get relays for the zap request, where the receipt should go
+			relays := configuredRelayURLs(relayRoleZaps)
 
-			// 1. Fetch the LNURL-pay data
-			g.Update(func(g *gocui.Gui) error {
-				if v, err := g.View("zapprocessing"); err == nil {
-					fmt.Fprintf(v, "Fetching LNURL-pay data...\n")
-				}
-				return nil
-			})
-
-			resp, err := http.Get(lnurlEndpoint)
-			if err != nil {
-				g.Update(func(g *gocui.Gui) error {
-					return showError(g, fmt.Sprintf("Error fetching LNURL-pay data: %v", err))
-				})
-				return
-			}
-			defer resp.Body.Close()
-
-			body, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				g.Update(func(g *gocui.Gui) error {
-					return showError(g, fmt.Sprintf("Error reading LNURL-pay response: %v", err))
-				})
-				return
+			parts := []*ZapRequest{zapReq}
+			var failures []string
+			if len(zapReq.Splits) > 0 {
+				parts, failures = splitZapRequest(g, zapReq, relays)
 			}
 
-			var lnurlPayResp LNURLPayResponse
-			if err := json.Unmarshal(body, &lnurlPayResp); err != nil {
-				g.Update(func(g *gocui.Gui) error {
-					return showError(g, fmt.Sprintf("Error parsing LNURL-pay response: %v", err))
-				})
-				return
+			var ready []*ZapRequest
+			for i, part := range parts {
+				if len(parts) > 1 {
+					progress("\n%d/%d: %d sats to @%s\n", i+1, len(parts), part.Amount/1000, authorName(part.RecipientPubkey))
+				}
+				if err := requestZapInvoice(g, account, part, relays, progress); err != nil {
+					TheLog.Printf("zap to %s failed: %v", displayZapAddress(part.Address), err)
+					if len(zapReq.Splits) == 0 {
+						g.Update(func(g *gocui.Gui) error {
+							g.DeleteView("zapprocessing")
+							return showError(g, err.Error())
+						})
+						return
+					}
+					failures = append(failures, fmt.Sprintf("@%s: %v", authorName(part.RecipientPubkey), err))
+					continue
+				}
+				ready = append(ready, part)
 			}
-
-			// Check if the amount is within allowed range
-			if zapReq.Amount < lnurlPayResp.MinSendable || zapReq.Amount > lnurlPayResp.MaxSendable {
+			if len(ready) == 0 {
 				g.Update(func(g *gocui.Gui) error {
-					return showError(g, fmt.Sprintf("Amount out of range. Min: %d, Max: %d millisats",
-						lnurlPayResp.MinSendable, lnurlPayResp.MaxSendable))
+					g.DeleteView("zapprocessing")
+					return showError(g, "No recipient of the split returned an invoice:\n"+strings.Join(failures, "\n"))
 				})
 				return
 			}
-
-			// Check if Nostr is allowed
-			if !lnurlPayResp.AllowsNostr || lnurlPayResp.NostrPubkey == "" {
-				g.Update(func(g *gocui.Gui) error {
-					return showError(g, "This lightning address does not support Nostr zaps")
-				})
-				return
+			if len(zapReq.Splits) > 0 {
+				zapReq.Parts = ready
 			}
 
-			// 2. Create a zap request event (kind 9734)
+			// Display the invoices
 			g.Update(func(g *gocui.Gui) error {
-				if v, err := g.View("zapprocessing"); err == nil {
-					fmt.Fprintf(v, "Creating zap request...\n")
-				}
-				return nil
+				g.DeleteView("zapprocessing")
+				return showZapInvoices(g, account, zapReq, failures)
 			})
+		}()
 
-			// Get relays for the zap request
-			var relayStatuses []RelayStatus
-			DB.Find(&relayStatuses)
-			var relays []string
-			for _, relay := range relayStatuses {
-				relays = append(relays, relay.Url)
-			}
-
-			// Create zap request event
-			var tags nostr.Tags
-			tags = append(tags, nostr.Tag{"p", zapReq.RecipientPubkey})
-			tags = append(tags, nostr.Tag{"relays"})
-			for _, r := range relays {
-				tags[len(tags)-1] = append(tags[len(tags)-1], r)
-			}
-			tags = append(tags, nostr.Tag{"amount", fmt.Sprintf("%d", zapReq.Amount)})
-
-			zapRequestEvent := nostr.Event{
-				Kind:      9734, // Zap Request
-				CreatedAt: nostr.Timestamp(time.Now().Unix()),
-				Tags:      tags,
-				Content:   zapReq.Comment,
-			}
+		// Set keybinding to cancel the processing
+		g.SetKeybinding("zapprocessing", gocui.KeyEsc, gocui.ModNone, cancelZapProcessing)
 
-			// Sign the zap request with the active account's private key
-			decryptedPrivateKey := Decrypt(string(Password), account.Privatekey)
+		if _, err := g.SetCurrentView("zapprocessing"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-			zapRequestEvent.PubKey = account.Pubkey
-			err = zapRequestEvent.Sign(decryptedPrivateKey)
-			if err != nil {
-				g.Update(func(g *gocui.Gui) error {
-					return showError(g, fmt.Sprintf("Error signing zap request: %v", err))
-				})
-				return
+// splitZapRequest makes one zap request per zap tag recipient, sharing the
+// amount by weight. Recipients without a lightning address are reported.
+func splitZapRequest(g *gocui.Gui, zapReq *ZapRequest, relays []string) ([]*ZapRequest, []string) {
+	var parts []*ZapRequest
+	var failures []string
+	amounts := splitZapAmount(zapReq.Amount, zapReq.Splits)
+	for i, split := range zapReq.Splits {
+		if amounts[i] == 0 {
+			failures = append(failures, fmt.Sprintf("@%s: share is less than 1 sat", authorName(split.Pubkey)))
+			continue
+		}
+		var m Metadata
+		if err := DB.First(&m, "pubkey_hex = ?", split.Pubkey).Error; err != nil {
+			urls := relays
+			if hint := relayHints([]string{split.Relay}); len(hint) > 0 {
+				urls = append(hint, relays...)
 			}
-
-			// Serialize the zap request event
-			zapRequestJSON, err := json.Marshal(zapRequestEvent)
-			if err != nil {
-				g.Update(func(g *gocui.Gui) error {
-					return showError(g, fmt.Sprintf("Error serializing zap request: %v", err))
-				})
-				return
+			if ev := fetchNewestEvent(uniqueRelayURLs(urls), nostr.Filter{Kinds: []int{0}, Authors: []string{split.Pubkey}, Limit: 1}); ev != nil && ev.PubKey == split.Pubkey {
+				processMetadataEvent(g, ev, split.Pubkey)
 			}
+			DB.First(&m, "pubkey_hex = ?", split.Pubkey)
+		}
+		address := zapAddress(m)
+		if address == "" {
+			failures = append(failures, fmt.Sprintf("@%s: no lightning address", authorName(split.Pubkey)))
+			continue
+		}
+		parts = append(parts, &ZapRequest{
+			EventID:         zapReq.EventID,
+			EventAddress:    zapReq.EventAddress,
+			Amount:          amounts[i],
+			Comment:         zapReq.Comment,
+			Address:         address,
+			RecipientPubkey: split.Pubkey,
+		})
+	}
+	return parts, failures
+}
 
-			// 3. Send the zap request to the LNURL-pay callback
-			g.Update(func(g *gocui.Gui) error {
-				if v, err := g.View("zapprocessing"); err == nil {
-					fmt.Fprintf(v, "Requesting invoice...\n")
-				}
-				return nil
-			})
+// requestZapInvoice signs a zap request for one recipient, fetches its
+// invoice and checks it, then starts listening for the receipt
+func requestZapInvoice(g *gocui.Gui, account Account, zapReq *ZapRequest, relays []string, progress func(string, ...interface{})) error {
+	// 1. Fetch the LNURL-pay data
+	progress("Fetching LNURL-pay data...\n")
+	lnurlPayResp, err := fetchLNURLPay(zapReq.Address)
+	if err != nil {
+		return fmt.Errorf("Error fetching LNURL-pay data: %v", err)
+	}
 
-			// Prepare callback URL with parameters
-			callbackURL, err := url.Parse(lnurlPayResp.Callback)
-			if err != nil {
-				g.Update(func(g *gocui.Gui) error {
-					return showError(g, fmt.Sprintf("Error parsing callback URL: %v", err))
-				})
-				return
-			}
+	// Check if the amount is within allowed range
+	if zapReq.Amount < lnurlPayResp.MinSendable || zapReq.Amount > lnurlPayResp.MaxSendable {
+		return fmt.Errorf("Amount out of range. Min: %d, Max: %d millisats",
+			lnurlPayResp.MinSendable, lnurlPayResp.MaxSendable)
+	}
 
-			query := callbackURL.Query()
-			query.Set("amount", fmt.Sprintf("%d", zapReq.Amount))
-			query.Set("nostr", string(zapRequestJSON))
-			if zapReq.Comment != "" {
-				query.Set("comment", zapReq.Comment)
-			}
-			callbackURL.RawQuery = query.Encode()
+	// Servers that don't set commentAllowed still get the comment in
+	// the zap request content, just not as an LNURL comment
+	zapReq.CommentAllowed = lnurlPayResp.CommentAllowed
+	if n := len([]rune(zapReq.Comment)); zapReq.CommentAllowed > 0 && n > zapReq.CommentAllowed {
+		return fmt.Errorf("Comment is %d characters, %s allows %d",
+			n, displayZapAddress(zapReq.Address), zapReq.CommentAllowed)
+	}
 
-			// Send the request to get the invoice
-			invoiceResp, err := http.Get(callbackURL.String())
-			if err != nil {
-				g.Update(func(g *gocui.Gui) error {
-					return showError(g, fmt.Sprintf("Error fetching invoice: %v", err))
-				})
-				return
-			}
-			defer invoiceResp.Body.Close()
+	// Check if Nostr is allowed
+	if !lnurlPayResp.AllowsNostr || lnurlPayResp.NostrPubkey == "" {
+		return fmt.Errorf("This lightning address does not support Nostr zaps")
+	}
 
-			invoiceBody, err := ioutil.ReadAll(invoiceResp.Body)
-			if err != nil {
-				g.Update(func(g *gocui.Gui) error {
-					return showError(g, fmt.Sprintf("Error reading invoice response: %v", err))
-				})
-				return
-			}
+	// 2. Create a zap request event (kind 9734)
+	progress("Creating zap request...\n")
+	var tags nostr.Tags
+	tags = append(tags, nostr.Tag{"p", zapReq.RecipientPubkey})
+	tags = append(tags, nostr.Tag{"relays"})
+	for _, r := range relays {
+		tags[len(tags)-1] = append(tags[len(tags)-1], r)
+	}
+	tags = append(tags, nostr.Tag{"amount", fmt.Sprintf("%d", zapReq.Amount)})
+	if zapReq.EventID != "" {
+		tags = append(tags, nostr.Tag{"e", zapReq.EventID})
+	}
+	if zapReq.EventAddress != "" {
+		tags = append(tags, nostr.Tag{"a", zapReq.EventAddress})
+	}
 
-			var invoiceData LNURLPayInvoiceResponse
-			if err := json.Unmarshal(invoiceBody, &invoiceData); err != nil {
-				g.Update(func(g *gocui.Gui) error {
-					return showError(g, fmt.Sprintf("Error parsing invoice response: %v", err))
-				})
-				return
-			}
+	zapRequestEvent := nostr.Event{
+		Kind:      9734, // Zap Request
+		CreatedAt: nostr.Timestamp(time.Now().Unix()),
+		Tags:      tags,
+		Content:   zapReq.Comment,
+	}
 
-			// 4. Display the invoice
-			g.Update(func(g *gocui.Gui) error {
-				g.DeleteView("zapprocessing")
+	// Sign the zap request with the active account's private key
+	decryptedPrivateKey := Decrypt(string(Password), account.Privatekey)
+	zapRequestEvent.PubKey = account.Pubkey
+	if err := zapRequestEvent.Sign(decryptedPrivateKey); err != nil {
+		return fmt.Errorf("Error signing zap request: %v", err)
+	}
 
-				maxX, maxY := g.Size()
-				if v, err := g.SetView("zapinvoice", maxX/2-40, maxY/2-12, maxX/2+40, maxY/2+12, 0); err != nil {
-					if !errors.Is(err, gocui.ErrUnknownView) {
-						return err
-					}
+	// Serialize the zap request event
+	zapRequestJSON, err := json.Marshal(zapRequestEvent)
+	if err != nil {
+		return fmt.Errorf("Error serializing zap request: %v", err)
+	}
 
-					v.Title = "Lightning Invoice"
-					v.BgColor = activeTheme.Bg
-					v.FgColor = activeTheme.Fg
+	// 3. Send the zap request to the LNURL-pay callback
+	progress("Requesting invoice...\n")
+	callbackURL, err := url.Parse(lnurlPayResp.Callback)
+	if err != nil {
+		return fmt.Errorf("Error parsing callback URL: %v", err)
+	}
+	query := callbackURL.Query()
+	query.Set("amount", fmt.Sprintf("%d", zapReq.Amount))
+	query.Set("nostr", string(zapRequestJSON))
+	if zapReq.Comment != "" && zapReq.CommentAllowed > 0 {
+		query.Set("comment", zapReq.Comment)
+	}
+	callbackURL.RawQuery = query.Encode()
 
-					// Display the invoice details
-					fmt.Fprintf(v, "Amount: %d sats\n\n", zapReq.Amount/1000)
-					
-					// Display ASCII QR code representation
-					fmt.Fprintf(v, "QR Code:\n")
-					fmt.Fprintf(v, generateTextQRCode(invoiceData.PR))
-					fmt.Fprintf(v, "\nInvoice:\n%s\n\n", invoiceData.PR)
-					fmt.Fprintf(v, "[Press ESC to close]\n")
+	var invoiceData LNURLPayInvoiceResponse
+	if err := lnurlGet(callbackURL.String(), &invoiceData); err != nil {
+		return fmt.Errorf("Error fetching invoice: %v", err)
+	}
 
-					// Set keybinding to close the invoice view
-					g.SetKeybinding("zapinvoice", gocui.KeyEsc, gocui.ModNone, closeZapInvoice)
+	// 4. Check the invoice is really for this zap before showing it
+	invoice, err := checkZapInvoice(invoiceData.PR, zapReq.Amount, zapRequestJSON)
+	if err != nil {
+		return fmt.Errorf("Refusing invoice from %s: %v", displayZapAddress(zapReq.Address), err)
+	}
+	zapReq.Invoice = invoiceData.PR
+	zapReq.InvoiceExpires = invoice.ExpiresAt()
+	zapReq.SuccessAction = invoiceData.SuccessAction
+	if err := checkSuccessAction(invoiceData.SuccessAction, lnurlPayResp.Callback); err != nil {
+		TheLog.Printf("ignoring success action from %s: %v", displayZapAddress(zapReq.Address), err)
+		zapReq.SuccessAction = nil
+	}
+	zapReq.SuccessShown = false
+	zapReq.PayUnknown = false
 
-					if _, err := g.SetCurrentView("zapinvoice"); err != nil {
-						return err
-					}
-				}
-				return nil
-			})
-		}()
+	// 5. Listen for the receipt while the invoice is on screen
+	recordZapRequest(zapRequestEvent, zapReq, invoiceData.PR, lnurlPayResp.NostrPubkey)
+	go watchZapReceipt(g, zapReq, zapRequestEvent, relays, lnurlPayResp.NostrPubkey)
+	return nil
+}
 
-		// Set keybinding to cancel the processing
-		g.SetKeybinding("zapprocessing", gocui.KeyEsc, gocui.ModNone, cancelZapProcessing)
+// showZapInvoices displays the invoices of a zap, one per split recipient
+func showZapInvoices(g *gocui.Gui, account Account, zapReq *ZapRequest, failures []string) error {
+	maxX, maxY := g.Size()
+	v, err := g.SetView("zapinvoice", maxX/2-40, maxY/2-12, maxX/2+40, maxY/2+12, 0)
+	if err != nil && !errors.Is(err, gocui.ErrUnknownView) {
+		return err
+	}
+	v.Clear()
+	v.Title = "Lightning Invoice"
+	v.Wrap = true
+	v.BgColor = activeTheme.Bg
+	v.FgColor = activeTheme.Fg
+
+	invoices := zapReq.invoices()
+	if len(zapReq.Splits) == 0 {
+		// Display the invoice details
+		fmt.Fprintf(v, "Amount: %d sats\n", zapReq.Amount/1000)
+		fmt.Fprintf(v, "Expires: %s\n", zapReq.InvoiceExpires.Format("15:04:05"))
+		if zapReq.Comment != "" {
+			fmt.Fprintf(v, "Comment: %s\n", zapReq.Comment)
+		}
+		fmt.Fprintf(v, "\n")
+
+		// Display ASCII QR code representation
+		fmt.Fprintf(v, "QR Code:\n")
+		fmt.Fprint(v, generateTextQRCode(zapReq.Invoice))
+		fmt.Fprintf(v, "\nInvoice:\n%s\n\n", zapReq.Invoice)
+	} else {
+		v.Title = fmt.Sprintf("Lightning Invoices - split zap, %d invoices", len(invoices))
+		if zapReq.Comment != "" {
+			fmt.Fprintf(v, "Comment: %s\n", zapReq.Comment)
+		}
+		for i, part := range invoices {
+			fmt.Fprintf(v, "\n%d. %d sats to @%s, expires %s\n%s\n", i+1, part.Amount/1000,
+				authorName(part.RecipientPubkey), part.InvoiceExpires.Format("15:04:05"), part.Invoice)
+		}
+		for _, failure := range failures {
+			fmt.Fprintf(v, "\nSkipped %s\n", failure)
+		}
+		fmt.Fprintf(v, "\n")
+	}
 
-		if _, err := g.SetCurrentView("zapprocessing"); err != nil {
-			return err
+	if _, hasWallet, _ := accountNWC(account); hasWallet {
+		if len(invoices) > 1 {
+			fmt.Fprintf(v, "[Press P to pay all %d with your connected wallet]\n", len(invoices))
+		} else {
+			fmt.Fprintf(v, "[Press P to pay with your connected wallet]\n")
 		}
+		g.SetKeybinding("zapinvoice", rune(0x70), gocui.ModNone, payZapInvoice)
+	}
+	fmt.Fprintf(v, "[Press ESC to close]\n")
+
+	// Set keybinding to close the invoice view
+	g.SetKeybinding("zapinvoice", gocui.KeyEsc, gocui.ModNone, closeZapInvoice)
+
+	if _, err := g.SetCurrentView("zapinvoice"); err != nil {
+		return err
 	}
 	return nil
 }
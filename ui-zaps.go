@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// fetchResultsEvent and fetchResultsPubkey are what the fetchresults view is
+// showing, so Z there knows what to zap
+var fetchResultsEvent *nostrEntity
+var fetchResultsPubkey string
+
+// zapFetchResults zaps the event or person in the fetchresults view
+func zapFetchResults(g *gocui.Gui, v *gocui.View) error {
+	if fetchResultsEvent != nil {
+		ce := cachedEntityEvent(*fetchResultsEvent)
+		if ce == nil {
+			return nil
+		}
+		closeFetchResults(g, v)
+		return zapEvent(g, ce)
+	}
+	if fetchResultsPubkey == "" {
+		return nil
+	}
+	var m Metadata
+	if err := DB.First(&m, "pubkey_hex = ?", fetchResultsPubkey).Error; err != nil {
+		return nil
+	}
+	closeFetchResults(g, v)
+	return openZapMenu(g, m, nil)
+}
+
+// zapEntityV3 zaps the link selected in the conversation
+func zapEntityV3(g *gocui.Gui, v *gocui.View) error {
+	idx := selectedV3Entity()
+	if idx < 0 {
+		return nil
+	}
+	e := v3Entities[idx]
+	if e.isProfile() {
+		var m Metadata
+		if err := DB.First(&m, "pubkey_hex = ?", e.Pubkey).Error; err != nil {
+			return showError(g, "That profile hasn't loaded yet")
+		}
+		return openZapMenu(g, m, nil)
+	}
+	ce := cachedEntityEvent(e)
+	if ce == nil {
+		return showError(g, "That event hasn't loaded yet")
+	}
+	return zapEvent(g, ce)
+}
+
+// zapEvent zaps the author of ce, tagging the event
+func zapEvent(g *gocui.Gui, ce *CachedEvent) error {
+	var m Metadata
+	if err := DB.First(&m, "pubkey_hex = ?", ce.PubkeyHex).Error; err != nil {
+		return showError(g, fmt.Sprintf("No profile known for @%s yet", authorName(ce.PubkeyHex)))
+	}
+	return openZapMenu(g, m, ce)
+}
+
+// zapHistory lists the zaps the active account sent and received, with their comments
+func zapHistory(g *gocui.Gui, v *gocui.View) error {
+	var account Account
+	DB.Where("active = ?", true).First(&account)
+	if account.Pubkey == "" {
+		return fmt.Errorf("no active account found")
+	}
+
+	maxX, maxY := g.Size()
+	g.DeleteView("profile")
+	if v, err := g.SetView("zaphistory", maxX/2-50, 0, maxX/2+50, maxY-7, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+		v.Title = "Zap History"
+		v.Wrap = true
+		v.BgColor = activeTheme.Bg
+		v.FgColor = activeTheme.Fg
+
+		received, receivedCount, sent, sentCount := zapTotals(account.Pubkey)
+		fmt.Fprintf(v, "Received: %d sats (%d zaps)   Sent: %d sats (%d zaps)\n\n",
+			received/1000, receivedCount, sent/1000, sentCount)
+
+		var zaps []Zap
+		DB.Where("sender_pubkey = ? OR recipient_pubkey = ?", account.Pubkey, account.Pubkey).
+			Order("created_at desc").Limit(200).Find(&zaps)
+		if len(zaps) == 0 {
+			fmt.Fprintf(v, "No zaps yet\n")
+		}
+		for _, zap := range zaps {
+			when := zap.PaidAt
+			if when.IsZero() {
+				when = zap.CreatedAt
+			}
+			direction, other := "from", zap.SenderPubkey
+			if zap.SenderPubkey == account.Pubkey {
+				direction, other = "to", zap.RecipientPubkey
+			}
+			status := "✓"
+			if zap.Pending {
+				status = "waiting for receipt"
+			} else if zap.Unchecked {
+				status = "? signer not checked yet"
+			} else if !zap.Verified {
+				status = "✗ " + zap.Error
+			}
+			fmt.Fprintf(v, "%s  %7d sats %-4s @%-20s %s\n", when.Format("2006-01-02 15:04"),
+				zap.AmountMsat/1000, direction, previewText(authorName(other), 20), status)
+			if zap.Comment != "" {
+				fmt.Fprintf(v, "    \"%s\"\n", zap.Comment)
+			}
+		}
+		fmt.Fprintf(v, "\n[Press ESC to close]\n")
+
+		if _, err := g.SetCurrentView("zaphistory"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// closeZapHistory returns to the profile menu
+func closeZapHistory(g *gocui.Gui, v *gocui.View) error {
+	g.DeleteView("zaphistory")
+	return profileMenu(g, v)
+}
+
+// configZapPresets edits the selected account's zap amounts, then its default comment
+func configZapPresets(g *gocui.Gui, v *gocui.View) error {
+	account, ok := selectedConfigAccount(g)
+	if !ok {
+		return nil
+	}
+	walletAccountID = account.ID
+
+	maxX, maxY := g.Size()
+	g.DeleteView("config")
+	if v, err := g.SetView("configzappresets", maxX/2-40, maxY/2-1, maxX/2+40, maxY/2+1, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+		v.Title = fmt.Sprintf("Zap amounts in sats, comma separated (up to %d, empty for defaults)", maxZapPresets)
+		v.Editable = true
+		v.KeybindOnEdit = true
+		if account.ZapPresets != "" {
+			fmt.Fprint(v, account.ZapPresets)
+			v.SetCursor(len(account.ZapPresets), 0)
+		}
+		if _, err := g.SetCurrentView("configzappresets"); err != nil {
+			return err
+		}
+		updateConfigKeybindsView(g)
+	}
+	return nil
+}
+
+// doConfigZapPresets checks the amounts and moves on to the default comment
+func doConfigZapPresets(g *gocui.Gui, v *gocui.View) error {
+	presets, err := parseZapPresets(v.Buffer())
+	if err != nil {
+		v.Title = fmt.Sprintf("Not saved: %v", err)
+		return nil
+	}
+	stored := ""
+	if len(presets) > 0 {
+		stored = formatZapPresets(presets)
+	}
+	if err := DB.Model(&Account{}).Where("id = ?", walletAccountID).Update("zap_presets", stored).Error; err != nil {
+		TheLog.Printf("error saving zap presets: %v", err)
+	}
+	g.DeleteView("configzappresets")
+
+	var account Account
+	DB.First(&account, "id = ?", walletAccountID)
+	maxX, maxY := g.Size()
+	if v, err := g.SetView("configzapcomment", maxX/2-40, maxY/2-1, maxX/2+40, maxY/2+1, 0); err != nil {
+		if !errors.Is(err, gocui.ErrUnknownView) {
+			return err
+		}
+		v.Title = "Default zap comment (empty for none)"
+		v.Editable = true
+		v.KeybindOnEdit = true
+		if account.ZapComment != "" {
+			fmt.Fprint(v, account.ZapComment)
+			v.SetCursor(len([]rune(account.ZapComment)), 0)
+		}
+		if _, err := g.SetCurrentView("configzapcomment"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func doConfigZapComment(g *gocui.Gui, v *gocui.View) error {
+	comment := strings.TrimSpace(v.Buffer())
+	if err := DB.Model(&Account{}).Where("id = ?", walletAccountID).Update("zap_comment", comment).Error; err != nil {
+		TheLog.Printf("error saving zap comment: %v", err)
+	}
+	g.DeleteView("configzapcomment")
+	return config(g, v)
+}
+
+func cancelConfigZap(g *gocui.Gui, v *gocui.View) error {
+	g.DeleteView("configzappresets")
+	g.DeleteView("configzapcomment")
+	return config(g, v)
+}
@@ -100,7 +100,9 @@ func next(g *gocui.Gui, v *gocui.View) error {
 	newV.Highlight = true
 	newV.SelBgColor = gocui.ColorCyan
 	newV.SelFgColor = gocui.ColorBlack
-	return nil
+
+	// show or hide the selected link in the conversation
+	return refreshV3Current(g)
 }
 
 func search(g *gocui.Gui, v *gocui.View) error {
@@ -123,8 +125,8 @@ func search(g *gocui.Gui, v *gocui.View) error {
 
 func doSearch(g *gocui.Gui, v *gocui.View) error {
 	followSearch = false
-	// default to search view if it's in conversations
-	if v2MetaDisplay == 0 {
+	// default to search view if it's in conversations or requests
+	if v2MetaDisplay == 0 || v2MetaDisplay == 3 {
 		v2MetaDisplay = 1
 	}
 	// zero out the highlighted list
@@ -141,6 +143,11 @@ func doSearch(g *gocui.Gui, v *gocui.View) error {
 		searchTerm = "%" + searchInput + "%"
 	}
 
+	// relays that support NIP-50 may know profiles we haven't seen yet
+	if searchInput != "" {
+		go searchRelayProfiles(searchInput)
+	}
+
 	// Close search dialog
 	if err := g.DeleteView("msg"); err != nil {
 		return err
@@ -154,12 +161,17 @@ func doSearch(g *gocui.Gui, v *gocui.View) error {
 }
 
 func toggleConversationFollows(g *gocui.Gui, v *gocui.View) error {
-	// Cycle through the three display modes:
+	// Cycle through the display modes:
 	// 0: Conversations
+	// 3: Message requests
 	// 1: All records
 	// 2: Follows only
+	// 4: a contact group, chosen from the groups menu, goes back to conversations
 	if v2MetaDisplay == 0 {
-		// Switch from conversations to all records
+		// Switch from conversations to message requests
+		v2MetaDisplay = 3
+	} else if v2MetaDisplay == 3 {
+		// Switch from message requests to all records
 		v2MetaDisplay = 1
 	} else if v2MetaDisplay == 1 {
 		// Switch from all records to follows only
@@ -168,11 +180,19 @@ func toggleConversationFollows(g *gocui.Gui, v *gocui.View) error {
 		// Switch from follows only back to conversations
 		v2MetaDisplay = 0
 	}
+	CurrOffset = 0
 
 	// Refresh all views with the new display mode
 	return refreshAllViews(g, v)
 }
 
+// toggleWotSort switches the v2 navigator between natural order and web-of-trust order
+func toggleWotSort(g *gocui.Gui, v *gocui.View) error {
+	v2SortByWot = !v2SortByWot
+	CurrOffset = 0
+	return refreshAllViews(g, v)
+}
+
 func askExpand(g *gocui.Gui, cursor int) error {
 	// Set the flag to indicate we're composing a message
 	isComposingMessage = true
@@ -350,51 +370,38 @@ func postInput(g *gocui.Gui, v *gocui.View) error {
 					TheLog.Printf("Error unmarshaling wrapped event: %v", err)
 					return
 				}
-				if err := r.Publish(ctx, ev); err != nil {
+				err := r.Publish(ctx, ev)
+				if err != nil && strings.Contains(err.Error(), "auth-required") {
 					TheLog.Printf("Error publishing giftwrap (%s) to relay %s: %v", wrapLabel, r.URL, err)
-					if strings.Contains(err.Error(), "auth-required") {
-						TheLog.Printf("Relay is requesting that we authenticate to send")
-						performAuth(r)
-						if err := r.Publish(ctx, ev); err != nil {
-							TheLog.Printf("republish after auth failed for %s", r.URL)
-						} else {
-							TheLog.Printf("RE-Published giftwrap (%s) to relay %s, eventID=%s", wrapLabel, r.URL, ev.ID)
-						}
+					TheLog.Printf("Relay is requesting that we authenticate to send")
+					performAuth(r)
+					if err = r.Publish(ctx, ev); err != nil {
+						TheLog.Printf("republish after auth failed for %s", r.URL)
+					} else {
+						TheLog.Printf("RE-Published giftwrap (%s) to relay %s, eventID=%s", wrapLabel, r.URL, ev.ID)
 					}
+				} else if err != nil {
+					TheLog.Printf("Error publishing giftwrap (%s) to relay %s: %v", wrapLabel, r.URL, err)
 				} else {
 					TheLog.Printf("Published giftwrap (%s) to relay %s, eventID=%s", wrapLabel, r.URL, ev.ID)
 				}
+				recordRelayPublish(r.URL, err)
 			}
 
 			for relayUrl, wrapKeys := range relayWrapKeys {
-				var isConnected bool
-				for _, existingRelay := range nostrRelays {
-					if existingRelay != nil && strings.TrimRight(existingRelay.URL, "/") == strings.TrimRight(relayUrl, "/") {
-						if !existingRelay.IsConnected() {
-							existingRelay.Connect(ctx)
-						}
-						for _, wrapKey := range wrapKeys {
-							publishWrap(existingRelay, wrapKey)
-						}
-						isConnected = true
-						break
+				if existingRelay := nostrPool.Relay(relayUrl); existingRelay != nil {
+					for _, wrapKey := range wrapKeys {
+						publishWrap(existingRelay, wrapKey)
 					}
-				}
-
-				if !isConnected {
-					relay, err := nostr.RelayConnect(ctx, relayUrl)
+				} else {
+					relay, err := dialRelay(ctx, relayUrl)
 					if err != nil {
 						fmt.Fprintf(v, "Failed to connect to relay %s: %v\n", relayUrl, err)
 						TheLog.Printf("Failed to connect to relay %s: %v", relayUrl, err)
 						continue
 					}
-					if account.Privatekey != "" && checkRelayRequiresAuth(relayUrl) {
-						err = relay.Auth(ctx, func(evt *nostr.Event) error {
-							return evt.Sign(decryptedKey)
-						})
-						if err != nil {
-							TheLog.Printf("Failed to authenticate with relay %s: %v", relayUrl, err)
-						}
+					if relayWantsAuth(relayUrl, true) {
+						performAuth(relay)
 					}
 					for _, wrapKey := range wrapKeys {
 						publishWrap(relay, wrapKey)
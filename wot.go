@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// wotMaxHops is how deep into metadata_follows the web-of-trust walk goes
+var wotMaxHops = 3
+
+// wotRecomputeInterval is how often the background manager rebuilds scores
+var wotRecomputeInterval = 15 * time.Minute
+
+// v2SortByWot orders the v2 navigator by web-of-trust score instead of the
+// page's natural order
+var v2SortByWot = false
+
+// followHops walks metadata_follows outward from root and returns the hop
+// distance of every pubkey reached within maxHops
+func followHops(root string, maxHops int) map[string]int {
+	hops := make(map[string]int)
+	if root == "" {
+		return hops
+	}
+	frontier := []string{root}
+	seen := map[string]bool{root: true}
+	for hop := 1; hop <= maxHops && len(frontier) > 0; hop++ {
+		var next []string
+		// sqlite has a limit on bound variables, walk the frontier in chunks
+		for i := 0; i < len(frontier); i += 500 {
+			end := i + 500
+			if end > len(frontier) {
+				end = len(frontier)
+			}
+			var follows []string
+			DB.Raw("SELECT follow_pubkey_hex FROM metadata_follows WHERE metadata_pubkey_hex IN ?", frontier[i:end]).Scan(&follows)
+			for _, f := range follows {
+				if seen[f] {
+					continue
+				}
+				seen[f] = true
+				hops[f] = hop
+				next = append(next, f)
+			}
+		}
+		frontier = next
+	}
+	return hops
+}
+
+// wotScoreFor turns hop distance and trusted follower count into one number.
+// Being close to us dominates, trusted followers break ties within a hop.
+func wotScoreFor(hops int, trustedFollowers int) int {
+	bonus := 0
+	switch hops {
+	case 1:
+		bonus = 10000
+	case 2:
+		bonus = 1000
+	case 3:
+		bonus = 100
+	}
+	return bonus + trustedFollowers
+}
+
+// wotComputeMu keeps the manager and an account switch from rebuilding
+// scores at the same time, which would clash on the primary key
+var wotComputeMu sync.Mutex
+
+// computeWotScores rebuilds the wot_scores rows for an account. Trusted
+// followers are the account itself plus everyone it follows directly.
+func computeWotScores(root string) {
+	if root == "" {
+		return
+	}
+	wotComputeMu.Lock()
+	defer wotComputeMu.Unlock()
+	start := time.Now()
+	hops := followHops(root, wotMaxHops)
+
+	trustedSet := []string{root}
+	for p, h := range hops {
+		if h == 1 {
+			trustedSet = append(trustedSet, p)
+		}
+	}
+
+	trustedFollowers := make(map[string]int)
+	for i := 0; i < len(trustedSet); i += 500 {
+		end := i + 500
+		if end > len(trustedSet) {
+			end = len(trustedSet)
+		}
+		var rows []struct {
+			FollowPubkeyHex string
+			Count           int
+		}
+		DB.Raw("SELECT follow_pubkey_hex, COUNT(*) AS count FROM metadata_follows WHERE metadata_pubkey_hex IN ? GROUP BY follow_pubkey_hex", trustedSet[i:end]).Scan(&rows)
+		for _, r := range rows {
+			trustedFollowers[r.FollowPubkeyHex] += r.Count
+		}
+	}
+
+	var scores []WotScore
+	for p, h := range hops {
+		if p == root {
+			continue
+		}
+		scores = append(scores, WotScore{
+			AccountPubkey:    root,
+			PubkeyHex:        p,
+			Hops:             h,
+			TrustedFollowers: trustedFollowers[p],
+			Score:            wotScoreFor(h, trustedFollowers[p]),
+		})
+	}
+
+	tx := DB.Begin()
+	if tx.Error != nil {
+		TheLog.Printf("error saving wot scores: %v", tx.Error)
+		return
+	}
+	if err := tx.Where("account_pubkey = ?", root).Delete(&WotScore{}).Error; err != nil {
+		TheLog.Printf("error clearing old wot scores: %v", err)
+		tx.Rollback()
+		return
+	}
+	if len(scores) > 0 {
+		if err := tx.CreateInBatches(scores, 500).Error; err != nil {
+			TheLog.Printf("error saving wot scores: %v", err)
+			tx.Rollback()
+			return
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		TheLog.Printf("error saving wot scores: %v", err)
+		tx.Rollback()
+		return
+	}
+	TheLog.Printf("computed %d wot scores for %s in %s", len(scores), root, time.Since(start))
+}
+
+// wotScoreManager recomputes scores for the active account on an interval
+func wotScoreManager() {
+	for {
+		var account Account
+		DB.Where("active = ?", true).First(&account)
+		computeWotScores(account.Pubkey)
+		time.Sleep(wotRecomputeInterval)
+	}
+}
+
+// loadWotScores returns the stored scores for the given pubkeys as seen from root
+func loadWotScores(root string, pubkeys []string) map[string]WotScore {
+	scores := make(map[string]WotScore)
+	for i := 0; i < len(pubkeys); i += 500 {
+		end := i + 500
+		if end > len(pubkeys) {
+			end = len(pubkeys)
+		}
+		var rows []WotScore
+		DB.Where("account_pubkey = ? AND pubkey_hex IN ?", root, pubkeys[i:end]).Find(&rows)
+		for _, r := range rows {
+			scores[r.PubkeyHex] = r
+		}
+	}
+	return scores
+}
+
+// sortByWot orders metadata by descending web-of-trust score, keeping the
+// existing order for equal scores
+func sortByWot(metas []Metadata, scores map[string]WotScore) {
+	sort.SliceStable(metas, func(i, j int) bool {
+		return scores[metas[i].PubkeyHex].Score > scores[metas[j].PubkeyHex].Score
+	})
+}
+
+// wotLabel is the v2 column text for a pubkey's score
+func wotLabel(scores map[string]WotScore, pubkey string) string {
+	score, ok := scores[pubkey]
+	if !ok {
+		return "wot -"
+	}
+	return fmt.Sprintf("wot %d (hop %d)", score.Score, score.Hops)
+}
@@ -0,0 +1,581 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/awesome-gocui/gocui"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// defaultZapPresets are offered until an account picks its own, in sats
+var defaultZapPresets = []int64{1000, 5000, 10000, 21000, 50000, 100000}
+
+// maxZapPresets keeps the zap menu on one screen
+const maxZapPresets = 9
+
+// zapSplit is one zap tag of an event (NIP-57 appendix G)
+type zapSplit struct {
+	Pubkey string
+	Relay  string
+	Weight float64
+}
+
+// zapProviderTTL is how long a lightning address's nostrPubkey is trusted
+var zapProviderTTL = time.Hour
+
+// zapReceiptWait is how long the invoice view listens for its receipt
+var zapReceiptWait = 10 * time.Minute
+
+// zapRetryBase is the wait before checking an unchecked receipt's signer
+// again, doubled for each failure up to zapProviderTTL. A failed LNURL fetch
+// is remembered for as long, so receipts to one address share an attempt.
+var zapRetryBase = time.Minute
+
+// errZapProviderUnknown marks a receipt whose signer couldn't be checked yet:
+// the recipient's profile or LNURL endpoint isn't available
+var errZapProviderUnknown = errors.New("zap provider not known yet")
+
+type zapProvider struct {
+	pubkey  string
+	err     error // the fetch failed, retried after zapRetryBase
+	fetched time.Time
+}
+
+// zapProviders caches lightning address -> LNURL nostrPubkey
+var zapProviders sync.Map
+
+// zapVerifyWake starts zapVerifier's next pass early
+var zapVerifyWake = make(chan struct{}, 1)
+
+func rememberZapProvider(lud16 string, pubkey string) {
+	zapProviders.Store(lud16, zapProvider{pubkey: pubkey, fetched: time.Now()})
+}
+
+// zapProviderPubkey is the key that must sign zap receipts for recipient,
+// taken from the nostrPubkey of their LNURL-pay endpoint. Without fetch only
+// the cache is consulted. Errors wrapping errZapProviderUnknown are worth a retry.
+func zapProviderPubkey(recipient string, fetch bool) (string, error) {
+	var m Metadata
+	if err := DB.First(&m, "pubkey_hex = ?", recipient).Error; err != nil || zapAddress(m) == "" {
+		return "", fmt.Errorf("%w: recipient has no lightning address", errZapProviderUnknown)
+	}
+	address := zapAddress(m)
+	if v, ok := zapProviders.Load(address); ok {
+		cached := v.(zapProvider)
+		if cached.err == nil && time.Since(cached.fetched) < zapProviderTTL {
+			return cached.pubkey, nil
+		}
+		if cached.err != nil && time.Since(cached.fetched) < zapRetryBase {
+			return "", cached.err
+		}
+	}
+	if !fetch {
+		return "", errZapProviderUnknown
+	}
+	resp, err := fetchLNURLPay(address)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", errZapProviderUnknown, err)
+		zapProviders.Store(address, zapProvider{err: err, fetched: time.Now()})
+		return "", err
+	}
+	if !resp.AllowsNostr || resp.NostrPubkey == "" {
+		return "", fmt.Errorf("%s does not support nostr zaps", displayZapAddress(address))
+	}
+	return resp.NostrPubkey, nil
+}
+
+// zapReceiptFilters are the receipts for zaps sent to or by pubkey
+func zapReceiptFilters(pubkey string, limit int) []nostr.Filter {
+	return []nostr.Filter{
+		{Kinds: []int{9735}, Tags: nostr.TagMap{"p": []string{pubkey}}, Limit: limit},
+		{Kinds: []int{9735}, Tags: nostr.TagMap{"P": []string{pubkey}}, Limit: limit},
+	}
+}
+
+// processZapReceipt verifies a kind 9735 per NIP-57 appendix F and stores it.
+// Receipts that fail are kept with the reason but never counted. The signer
+// is only checked against a cached provider here, receipts waiting for one
+// are stored unchecked and left to zapVerifier, off the event path.
+func processZapReceipt(ev *nostr.Event) (Zap, error) {
+	var existing Zap
+	found := DB.First(&existing, "id = ?", ev.ID).Error == nil
+	if found && !existing.Unchecked {
+		return existing, nil
+	}
+
+	zap, err := verifyZapReceipt(ev)
+	zap.ID = ev.ID
+	zap.ProviderPubkey = ev.PubKey
+	zap.PaidAt = ev.CreatedAt.Time()
+	zap.Verified = err == nil
+	zap.Unchecked = errors.Is(err, errZapProviderUnknown)
+	if zap.Unchecked {
+		zap.Attempts, zap.RetryAt = existing.Attempts, existing.RetryAt
+		if !found {
+			zap.RetryAt = time.Now()
+		}
+	}
+	if err != nil {
+		zap.Error = err.Error()
+		if !zap.Unchecked {
+			TheLog.Printf("zap receipt %s not verified: %v", ev.ID, err)
+		}
+	}
+	if zap.RecipientPubkey == "" {
+		// not even a parseable zap, don't keep it
+		return zap, err
+	}
+	if dbErr := DB.Save(&zap).Error; dbErr != nil {
+		TheLog.Printf("error saving zap receipt: %v", dbErr)
+	}
+	if zap.RequestID != "" && zap.RequestID != zap.ID {
+		DB.Where("id = ? AND pending = ?", zap.RequestID, true).Delete(&Zap{})
+	}
+	if zap.Unchecked && !found {
+		select {
+		case zapVerifyWake <- struct{}{}:
+		default:
+		}
+	}
+	return zap, err
+}
+
+// zapRetryDelay is the wait after attempts failed checks of a receipt's signer
+func zapRetryDelay(attempts int) time.Duration {
+	wait := zapRetryBase
+	for i := 1; i < attempts && wait < zapProviderTTL; i++ {
+		wait *= 2
+	}
+	if wait > zapProviderTTL {
+		wait = zapProviderTTL
+	}
+	return wait
+}
+
+// checkZapSigner fetches the recipient's zap provider for an unchecked
+// receipt and settles it, or schedules another try if it is still unknown
+func checkZapSigner(zap Zap) {
+	provider, err := zapProviderPubkey(zap.RecipientPubkey, true)
+	if err == nil && provider != zap.ProviderPubkey {
+		err = fmt.Errorf("receipt signed by %s, recipient's zap provider is %s", zap.ProviderPubkey, provider)
+	}
+	updates := map[string]interface{}{"verified": err == nil, "unchecked": false, "error": ""}
+	switch {
+	case errors.Is(err, errZapProviderUnknown):
+		zap.Attempts++
+		updates = map[string]interface{}{
+			"unchecked": true,
+			"attempts":  zap.Attempts,
+			"retry_at":  time.Now().Add(zapRetryDelay(zap.Attempts)),
+			"error":     err.Error(),
+		}
+	case err != nil:
+		updates["error"] = err.Error()
+		TheLog.Printf("zap receipt %s not verified: %v", zap.ID, err)
+	}
+	if err := DB.Model(&Zap{}).Where("id = ?", zap.ID).Updates(updates).Error; err != nil {
+		TheLog.Printf("error saving zap receipt: %v", err)
+	}
+}
+
+// zapVerifier checks the signers of unchecked receipts in the background,
+// fetching each recipient's LNURL endpoint and backing off while it fails
+func zapVerifier() {
+	for {
+		var due []Zap
+		DB.Where("unchecked = ? AND retry_at <= ?", true, time.Now()).Order("retry_at").Limit(20).Find(&due)
+		for _, zap := range due {
+			checkZapSigner(zap)
+		}
+		if len(due) > 0 {
+			refreshNow()
+			continue
+		}
+		select {
+		case <-time.After(zapRetryBase):
+		case <-zapVerifyWake:
+		}
+	}
+}
+
+// recordZapRequest keeps a zap we asked an invoice for in the history until
+// its receipt replaces it
+func recordZapRequest(zapRequest nostr.Event, zapReq *ZapRequest, pr string, provider string) {
+	zap := Zap{
+		ID:              zapRequest.ID,
+		RequestID:       zapRequest.ID,
+		SenderPubkey:    zapRequest.PubKey,
+		RecipientPubkey: zapReq.RecipientPubkey,
+		EventID:         zapReq.EventID,
+		Address:         zapReq.EventAddress,
+		ProviderPubkey:  provider,
+		AmountMsat:      zapReq.Amount,
+		Comment:         zapRequest.Content,
+		Bolt11:          pr,
+		Pending:         true,
+	}
+	if err := DB.Save(&zap).Error; err != nil {
+		TheLog.Printf("error saving zap request: %v", err)
+	}
+}
+
+// verifyZapReceipt checks a receipt against its zap request and invoice, and
+// its signer against the recipient's cached zap provider
+func verifyZapReceipt(ev *nostr.Event) (Zap, error) {
+	var zap Zap
+	if ev.Kind != 9735 {
+		return zap, fmt.Errorf("not a zap receipt")
+	}
+	if ok, err := ev.CheckSignature(); err != nil || !ok {
+		return zap, fmt.Errorf("bad receipt signature")
+	}
+
+	bolt11Tag := ev.Tags.Find("bolt11")
+	descriptionTag := ev.Tags.Find("description")
+	if bolt11Tag == nil || descriptionTag == nil {
+		return zap, fmt.Errorf("receipt is missing bolt11 or description")
+	}
+	description := descriptionTag[1]
+
+	var req nostr.Event
+	if err := json.Unmarshal([]byte(description), &req); err != nil {
+		return zap, fmt.Errorf("description is not a zap request: %w", err)
+	}
+	zap.RequestID = req.ID
+	zap.SenderPubkey = req.PubKey
+	zap.Comment = req.Content
+	zap.Bolt11 = bolt11Tag[1]
+	if p := req.Tags.Find("p"); p != nil {
+		zap.RecipientPubkey = p[1]
+	}
+	if e := req.Tags.Find("e"); e != nil {
+		zap.EventID = e[1]
+	}
+	if a := req.Tags.Find("a"); a != nil {
+		zap.Address = a[1]
+	}
+
+	if req.Kind != 9734 {
+		return zap, fmt.Errorf("description is kind %d, not a zap request", req.Kind)
+	}
+	if ok, err := req.CheckSignature(); err != nil || !ok {
+		return zap, fmt.Errorf("bad zap request signature")
+	}
+	if zap.RecipientPubkey == "" {
+		return zap, fmt.Errorf("zap request has no recipient")
+	}
+	if p := ev.Tags.Find("p"); p == nil || p[1] != zap.RecipientPubkey {
+		return zap, fmt.Errorf("receipt and zap request name different recipients")
+	}
+
+	inv, err := decodeBolt11(zap.Bolt11)
+	if err != nil {
+		return zap, err
+	}
+	zap.AmountMsat = inv.AmountMsat
+	hash := sha256.Sum256([]byte(description))
+	if inv.DescriptionHash != hex.EncodeToString(hash[:]) {
+		return zap, fmt.Errorf("invoice description hash does not match the zap request")
+	}
+	if amount := req.Tags.Find("amount"); amount != nil {
+		want, err := strconv.ParseInt(amount[1], 10, 64)
+		if err != nil || want != inv.AmountMsat {
+			return zap, fmt.Errorf("invoice is for %d msat, zap request asked for %s", inv.AmountMsat, amount[1])
+		}
+	}
+
+	provider, err := zapProviderPubkey(zap.RecipientPubkey, false)
+	if err != nil {
+		return zap, fmt.Errorf("could not check the receipt signer: %w", err)
+	}
+	if provider != ev.PubKey {
+		return zap, fmt.Errorf("receipt signed by %s, recipient's zap provider is %s", ev.PubKey, provider)
+	}
+	return zap, nil
+}
+
+// checkZapInvoice makes sure an invoice from an LNURL callback is the one we
+// asked for: the right amount, committing to our zap request, and still payable
+func checkZapInvoice(pr string, amountMsat int64, zapRequestJSON []byte) (bolt11Invoice, error) {
+	inv, err := decodeBolt11(pr)
+	if err != nil {
+		return inv, err
+	}
+	if inv.AmountMsat != amountMsat {
+		return inv, fmt.Errorf("invoice is for %d msat, we asked for %d msat", inv.AmountMsat, amountMsat)
+	}
+	hash := sha256.Sum256(zapRequestJSON)
+	if inv.DescriptionHash != hex.EncodeToString(hash[:]) {
+		return inv, fmt.Errorf("invoice description hash does not commit to our zap request")
+	}
+	if time.Now().After(inv.ExpiresAt()) {
+		return inv, fmt.Errorf("invoice expired at %s", inv.ExpiresAt().Format("15:04:05"))
+	}
+	return inv, nil
+}
+
+// watchZapReceipt listens for the receipt of a zap request we just made and
+// reports it in the invoice view
+func watchZapReceipt(g *gocui.Gui, zapReq *ZapRequest, zapRequest nostr.Event, relays []string, provider string) {
+	recipient := ""
+	if p := zapRequest.Tags.Find("p"); p != nil {
+		recipient = p[1]
+	}
+	since := nostr.Timestamp(zapRequest.CreatedAt - 60)
+	filter := nostr.Filter{
+		Kinds:   []int{9735},
+		Authors: []string{provider},
+		Tags:    nostr.TagMap{"p": []string{recipient}},
+		Since:   &since,
+	}
+	if e := zapRequest.Tags.Find("e"); e != nil {
+		filter.Tags["e"] = []string{e[1]}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), zapReceiptWait)
+	defer cancel()
+	found := make(chan Zap, 1)
+	preimage := ""
+	var once sync.Once
+	for _, url := range uniqueRelayURLs(relays) {
+		go func(url string) {
+			relay := connectedRelay(url)
+			if relay == nil {
+				var err error
+				if relay, err = dialRelay(ctx, url); err != nil {
+					return
+				}
+				defer relay.Close()
+			}
+			sub, err := relay.Subscribe(ctx, []nostr.Filter{filter})
+			if err != nil {
+				return
+			}
+			defer sub.Unsub()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case ev, ok := <-sub.Events:
+					if !ok {
+						return
+					}
+					zap, err := processZapReceipt(ev)
+					if zap.RequestID != zapRequest.ID {
+						continue
+					}
+					if err != nil {
+						TheLog.Printf("receipt for our zap failed verification: %v", err)
+					}
+					once.Do(func() {
+						if tag := ev.Tags.Find("preimage"); tag != nil {
+							preimage = tag[1]
+						}
+						found <- zap
+					})
+					return
+				}
+			}
+		}(url)
+	}
+
+	select {
+	case zap := <-found:
+		cancel()
+		g.Update(func(g *gocui.Gui) error {
+			if v, err := g.View("zapinvoice"); err == nil {
+				v.Autoscroll = true
+				if zap.Verified {
+					fmt.Fprintf(v, "\nZap receipt received: %d sats ✓\n", zap.AmountMsat/1000)
+					if !zapReq.SuccessShown {
+						zapReq.SuccessShown = true
+						fmt.Fprint(v, zapReq.SuccessAction.describe(preimage))
+					}
+				} else if zap.Unchecked {
+					fmt.Fprintf(v, "\nZap receipt received: %d sats, checking its signer\n", zap.AmountMsat/1000)
+				} else {
+					fmt.Fprintf(v, "\nZap receipt failed verification: %s\n", zap.Error)
+				}
+			}
+			return refreshV3Current(g)
+		})
+	case <-ctx.Done():
+		TheLog.Printf("no receipt for zap request %s after %s", zapRequest.ID, zapReceiptWait)
+	}
+}
+
+// zapTotals sums verified zaps received and sent by pubkey, in msat
+func zapTotals(pubkey string) (received int64, receivedCount int64, sent int64, sentCount int64) {
+	var row struct {
+		Total int64
+		Count int64
+	}
+	DB.Model(&Zap{}).Select("COALESCE(SUM(amount_msat), 0) AS total, COUNT(*) AS count").
+		Where("recipient_pubkey = ? AND verified = ?", pubkey, true).Scan(&row)
+	received, receivedCount = row.Total, row.Count
+	row.Total, row.Count = 0, 0
+	DB.Model(&Zap{}).Select("COALESCE(SUM(amount_msat), 0) AS total, COUNT(*) AS count").
+		Where("sender_pubkey = ? AND verified = ?", pubkey, true).Scan(&row)
+	return received, receivedCount, row.Total, row.Count
+}
+
+// eventZapTotals sums the verified zaps of one event, in msat
+func eventZapTotals(ce *CachedEvent) (int64, int64) {
+	var row struct {
+		Total int64
+		Count int64
+	}
+	q := DB.Model(&Zap{}).Select("COALESCE(SUM(amount_msat), 0) AS total, COUNT(*) AS count").
+		Where("verified = ?", true)
+	if address := eventAddress(ce); address != "" {
+		q = q.Where("event_id = ? OR address = ?", ce.ID, address)
+	} else {
+		q = q.Where("event_id = ?", ce.ID)
+	}
+	q.Scan(&row)
+	return row.Total, row.Count
+}
+
+// eventAddress is the a tag value of an addressable event, empty for others
+func eventAddress(ce *CachedEvent) string {
+	if ce.Kind < 30000 || ce.Kind >= 40000 {
+		return ""
+	}
+	return fmt.Sprintf("%d:%s:%s", ce.Kind, ce.PubkeyHex, ce.Identifier)
+}
+
+// fetchEventZaps loads the receipts of one event from relays
+func fetchEventZaps(ce *CachedEvent, relays []string) {
+	filters := []nostr.Filter{{Kinds: []int{9735}, Tags: nostr.TagMap{"e": []string{ce.ID}}, Limit: 500}}
+	if address := eventAddress(ce); address != "" {
+		filters = append(filters, nostr.Filter{Kinds: []int{9735}, Tags: nostr.TagMap{"a": []string{address}}, Limit: 500})
+	}
+	for _, filter := range filters {
+		for _, ev := range fetchEvents(relays, filter) {
+			processZapReceipt(ev)
+		}
+	}
+}
+
+// zapPresets are the account's zap amounts in sats
+func zapPresets(account Account) []int64 {
+	presets, err := parseZapPresets(account.ZapPresets)
+	if err != nil || len(presets) == 0 {
+		return defaultZapPresets
+	}
+	return presets
+}
+
+// parseZapPresets reads a comma separated list of sat amounts
+func parseZapPresets(s string) ([]int64, error) {
+	var presets []int64
+	for _, field := range strings.Split(s, ",") {
+		field = strings.ReplaceAll(strings.TrimSpace(field), "_", "")
+		if field == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(field, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("%q is not a positive number of sats", field)
+		}
+		presets = append(presets, n)
+	}
+	if len(presets) > maxZapPresets {
+		return nil, fmt.Errorf("at most %d presets", maxZapPresets)
+	}
+	return presets, nil
+}
+
+// formatZapPresets is the inverse of parseZapPresets
+func formatZapPresets(presets []int64) string {
+	fields := make([]string, len(presets))
+	for i, n := range presets {
+		fields[i] = strconv.FormatInt(n, 10)
+	}
+	return strings.Join(fields, ", ")
+}
+
+// eventZapSplits reads the zap tags of an event. When no tag has a weight
+// the zap is split evenly, otherwise tags without one get nothing.
+func eventZapSplits(ce *CachedEvent) []zapSplit {
+	var ev nostr.Event
+	if err := json.Unmarshal([]byte(ce.Raw), &ev); err != nil {
+		return nil
+	}
+	var splits []zapSplit
+	weighted := false
+	for _, tag := range ev.Tags {
+		if len(tag) < 2 || tag[0] != "zap" || len(tag[1]) != 64 || !isHex(tag[1]) {
+			continue
+		}
+		split := zapSplit{Pubkey: strings.ToLower(tag[1]), Weight: -1}
+		if len(tag) > 2 {
+			split.Relay = tag[2]
+		}
+		if len(tag) > 3 {
+			if w, err := strconv.ParseFloat(tag[3], 64); err == nil && w >= 0 {
+				split.Weight = w
+				weighted = true
+			}
+		}
+		splits = append(splits, split)
+	}
+
+	var kept []zapSplit
+	for _, split := range splits {
+		if !weighted {
+			split.Weight = 1
+		}
+		if split.Weight > 0 {
+			kept = append(kept, split)
+		}
+	}
+	return kept
+}
+
+// splitZapAmount shares totalMsat between splits by weight, in whole sats so
+// every invoice is payable. Leftover sats go to the first recipients.
+func splitZapAmount(totalMsat int64, splits []zapSplit) []int64 {
+	var sum float64
+	for _, split := range splits {
+		sum += split.Weight
+	}
+	totalSats := totalMsat / 1000
+	shares := make([]int64, len(splits))
+	if sum <= 0 {
+		return shares
+	}
+	var given int64
+	for i, split := range splits {
+		shares[i] = int64(float64(totalSats) * split.Weight / sum)
+		given += shares[i]
+	}
+	for i := 0; given < totalSats && len(shares) > 0; i = (i + 1) % len(shares) {
+		shares[i]++
+		given++
+	}
+	for i := range shares {
+		shares[i] *= 1000
+	}
+	return shares
+}
+
+// conversationZapTotals sums the verified zaps between two people, in msat
+func conversationZapTotals(from string, to string) (int64, int64) {
+	sum := func(sender, recipient string) int64 {
+		var total int64
+		DB.Model(&Zap{}).Select("COALESCE(SUM(amount_msat), 0)").
+			Where("sender_pubkey = ? AND recipient_pubkey = ? AND verified = ?", sender, recipient, true).Scan(&total)
+		return total
+	}
+	return sum(from, to), sum(to, from)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// testZapReceipt is a 1000 sat receipt for a zap to recipient, signed by provider
+func testZapReceipt(t *testing.T, recipient string, providerSecret string) *nostr.Event {
+	t.Helper()
+	req := nostr.Event{
+		Kind:      9734,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"p", recipient}, {"amount", "1000000"}},
+		Content:   "thanks",
+	}
+	req.Sign(nostr.GeneratePrivateKey())
+	description := req.String()
+	descriptionHash := sha256.Sum256([]byte(description))
+	_, paymentHash := randomPreimage(t)
+	invoice := buildTestInvoice(t, "lnbc10u",
+		testInvoiceField(t, bolt11FieldPaymentHash, paymentHash),
+		testInvoiceField(t, bolt11FieldDescriptionHash, descriptionHash[:]))
+
+	receipt := &nostr.Event{
+		Kind:      9735,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"p", recipient}, {"bolt11", invoice}, {"description", description}},
+	}
+	receipt.Sign(providerSecret)
+	return receipt
+}
+
+func TestZapReceiptUnknownProviderIsRetried(t *testing.T) {
+	providerSecret := nostr.GeneratePrivateKey()
+	providerPubkey, _ := nostr.GetPublicKey(providerSecret)
+	recipient, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	// nothing listens there, so the LNURL fetch fails
+	address := "alice@127.0.0.1:1"
+	DB.Create(&Metadata{PubkeyHex: recipient, Lud16: address})
+	t.Cleanup(func() {
+		DB.Where("pubkey_hex = ?", recipient).Delete(&Metadata{})
+		DB.Where("recipient_pubkey = ?", recipient).Delete(&Zap{})
+		zapProviders.Delete(address)
+	})
+	ev := testZapReceipt(t, recipient, providerSecret)
+
+	zap, err := processZapReceipt(ev)
+	if !zap.Unchecked || zap.Verified || err == nil {
+		t.Fatalf("unchecked %v verified %v err %v, want an unchecked receipt", zap.Unchecked, zap.Verified, err)
+	}
+
+	checkZapSigner(zap)
+	DB.First(&zap, "id = ?", ev.ID)
+	if !zap.Unchecked || zap.Verified || zap.Attempts != 1 {
+		t.Fatalf("after a failed fetch: unchecked %v verified %v attempts %d", zap.Unchecked, zap.Verified, zap.Attempts)
+	}
+	if wait := time.Until(zap.RetryAt); wait < zapRetryBase/2 || wait > zapRetryBase {
+		t.Errorf("retry in %v, want about %v", wait, zapRetryBase)
+	}
+
+	// the endpoint answers on the next try
+	rememberZapProvider(address, providerPubkey)
+	checkZapSigner(zap)
+	DB.First(&zap, "id = ?", ev.ID)
+	if zap.Unchecked || !zap.Verified {
+		t.Fatalf("unchecked %v verified %v (%s), want verified", zap.Unchecked, zap.Verified, zap.Error)
+	}
+	if received, count, _, _ := zapTotals(recipient); received != 1000000 || count != 1 {
+		t.Errorf("totals %d msat in %d zaps", received, count)
+	}
+}
+
+func TestZapReceiptWrongSigner(t *testing.T) {
+	recipient, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	provider, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	address := "bob@127.0.0.1:1"
+	DB.Create(&Metadata{PubkeyHex: recipient, Lud16: address})
+	rememberZapProvider(address, provider)
+	t.Cleanup(func() {
+		DB.Where("pubkey_hex = ?", recipient).Delete(&Metadata{})
+		DB.Where("recipient_pubkey = ?", recipient).Delete(&Zap{})
+		zapProviders.Delete(address)
+	})
+
+	zap, err := processZapReceipt(testZapReceipt(t, recipient, nostr.GeneratePrivateKey()))
+	if err == nil || zap.Verified || zap.Unchecked {
+		t.Fatalf("unchecked %v verified %v err %v, want an invalid receipt", zap.Unchecked, zap.Verified, err)
+	}
+}